@@ -0,0 +1,169 @@
+package application
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// A MethodPolicy declares whether a gRPC method can be called without a JWT and, if not, which scopes the JWT must have
+type MethodPolicy struct {
+	Public bool
+	Scopes []string
+}
+
+// MethodPolicies is the auth policy of each APIGateway method, keyed by full method name
+// Methods missing from this table require a valid JWT
+var MethodPolicies = map[string]MethodPolicy{
+	"/apigateway.APIGateway/loginUser":         {Public: true},
+	"/apigateway.APIGateway/createUser":        {Public: true},
+	"/apigateway.APIGateway/refreshToken":      {Public: true},
+	"/apigateway.APIGateway/getJWKS":           {Public: true},
+	"/grpc.health.v1.Health/Check":             {Public: true},
+	"/grpc.health.v1.Health/Watch":             {Public: true},
+	"/apigateway.APIGateway/logoutUser":        {},
+	"/apigateway.APIGateway/createTweet":       {Scopes: []string{auth.ScopeTweetsWrite}},
+	"/apigateway.APIGateway/editTweet":         {Scopes: []string{auth.ScopeTweetsWrite}},
+	"/apigateway.APIGateway/deleteTweet":       {Scopes: []string{auth.ScopeTweetsWrite}},
+	"/apigateway.APIGateway/getTweetHistory":   {Scopes: []string{auth.ScopeTweetsRead}},
+	"/apigateway.APIGateway/createFollow":      {Scopes: []string{auth.ScopeFollowsWrite}},
+	"/apigateway.APIGateway/unfollowUser":      {Scopes: []string{auth.ScopeFollowsWrite}},
+	"/apigateway.APIGateway/getFollowers":      {Scopes: []string{auth.ScopeFollowsRead}},
+	"/apigateway.APIGateway/getFollowees":      {Scopes: []string{auth.ScopeFollowsRead}},
+	"/apigateway.APIGateway/getUserTweets":     {Scopes: []string{auth.ScopeTweetsRead}},
+	"/apigateway.APIGateway/getTimelineTweets": {Scopes: []string{auth.ScopeTweetsRead}},
+}
+
+// AuthInterceptor authenticates requests once (according to their method's policy) and injects the principal into the request context
+type AuthInterceptor struct {
+	auth.Authorization
+	Policies map[string]MethodPolicy
+}
+
+// Unary returns a unary server interceptor
+func (i *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns a stream server interceptor
+func (i *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedStream{ss, ctx})
+	}
+}
+
+func (i *AuthInterceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	policy := i.Policies[method]
+	if policy.Public {
+		return ctx, nil
+	}
+
+	headers, _ := metadata.FromIncomingContext(ctx)
+	authHeaders := headers.Get("authorization")
+	if len(authHeaders) < 1 {
+		return nil, apperror.NewUnauthenticated("MISSING_TOKEN", "Failed to find JWT")
+	}
+
+	p, err := i.Authenticate(authHeaders[0])
+	if err != nil {
+		// errors from parsing the JWT are not domain errors, while those from dependencies (e.g., revocation checks) keep their kind
+		e := apperror.FromError(err)
+		if e.Kind != apperror.Internal {
+			return nil, e
+		}
+
+		return nil, apperror.Wrap(apperror.Unauthenticated, "INVALID_TOKEN", "Invalid JWT: "+err.Error(), err)
+	}
+
+	for _, scope := range policy.Scopes {
+		if !p.HasScope(scope) {
+			return nil, apperror.NewPermissionDenied("MISSING_SCOPE", "Missing scope: "+scope)
+		}
+	}
+
+	return auth.NewContext(ctx, p), nil
+}
+
+// authenticatedStream overrides the context of a server stream with one carrying the principal
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// principal returns the principal injected into the context by the AuthInterceptor
+func principal(ctx context.Context) (auth.Principal, error) {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return auth.Principal{}, apperror.NewUnauthenticated("MISSING_TOKEN", "Failed to find JWT")
+	}
+
+	return p, nil
+}
+
+// Request metadata keys that are passed on to the event producer
+const (
+	// idempotencyKeyHeader can be set by clients so that a retried write request is only applied once
+	idempotencyKeyHeader = "idempotency-key"
+	// actorHeader is set to the UserID of the current user (clients cannot set it)
+	actorHeader = "actor"
+	// traceparentHeader and tracestateHeader are the W3C trace context of the request (if the client set one)
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// eventContext returns a context that passes the request's idempotency key, actor (the current user) and trace context (if any)
+// on to the event producer. The idempotency key is scoped to the current user, so that different users cannot collide by
+// choosing the same key; without a current user, the key is dropped (see eventContextAs)
+func eventContext(ctx context.Context) context.Context {
+	p, err := principal(ctx)
+	if err != nil {
+		return eventContextAs(ctx, "", "")
+	}
+
+	return eventContextAs(ctx, p.UserID, p.UserID)
+}
+
+// eventContextAs is eventContext with the given actor, and the idempotency key scoped by the given scope (e.g., the username a
+// signup is for, since there is no user yet). The idempotency key is dropped if there is no scope
+func eventContextAs(ctx context.Context, actor string, scope string) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	out := metadata.MD{}
+
+	if actor != "" {
+		out.Set(actorHeader, actor)
+	}
+
+	keys := md.Get(idempotencyKeyHeader)
+	if len(keys) > 0 && keys[0] != "" && scope != "" {
+		out.Set(idempotencyKeyHeader, scope+":"+keys[0])
+	}
+
+	for _, h := range []string{traceparentHeader, tracestateHeader} {
+		values := md.Get(h)
+		if len(values) > 0 {
+			out.Set(h, values[0])
+		}
+	}
+
+	return metadata.NewOutgoingContext(ctx, out)
+}
@@ -2,9 +2,11 @@ package application
 
 import (
 	"context"
-	"errors"
+	"log"
+	"strings"
+	"time"
 
-	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/follow"
@@ -12,6 +14,7 @@ import (
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/user"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/infrastructure/eventproducer"
 	pb "github.com/martinmhan/tweet-app-api/cmd/apigateway/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
 )
 
 // APIGatewayServer contains the fields and gRPC method implementations used by the API Gateway service
@@ -22,40 +25,136 @@ type APIGatewayServer struct {
 	FollowRepository follow.Repository
 	auth.Authorization
 	eventproducer.EventProducer
+
+	// TweetEditWindow is how long after creation a tweet can be edited
+	TweetEditWindow time.Duration
 }
 
 // LoginUser provides a JWT given a valid username/password
 func (s *APIGatewayServer) LoginUser(ctx context.Context, in *pb.LoginUserParam) (*pb.JWT, error) {
-	valid, err := s.ValidatePassword(in.Username, in.Password)
+	userID, needsRehash, err := s.ValidatePassword(in.Username, in.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	if !valid {
-		return nil, errors.New("Invalid username or password")
+	if userID == "" {
+		return nil, apperror.NewUnauthenticated("INVALID_CREDENTIALS", "Invalid username or password")
+	}
+
+	if needsRehash {
+		s.rehashPassword(ctx, userID, in.Username, in.Password)
+	}
+
+	tokens, err := s.CreateTokens(in.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.JWT{
+		JWT:          tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    timestamppb.New(tokens.AccessTokenExpiresAt),
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new JWT and refresh token (the given refresh token can no longer be used)
+func (s *APIGatewayServer) RefreshToken(ctx context.Context, in *pb.RefreshTokenParam) (*pb.JWT, error) {
+	tokens, err := s.RefreshTokens(in.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.JWT{
+		JWT:          tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    timestamppb.New(tokens.AccessTokenExpiresAt),
+	}, nil
+}
+
+// LogoutUser revokes the current JWT and the given refresh token (along with any refresh tokens issued by rotating it)
+func (s *APIGatewayServer) LogoutUser(ctx context.Context, in *pb.LogoutUserParam) (*pb.SimpleResponse, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.RevokeTokens(p, in.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Logged out"}, nil
+}
+
+// GetJWKS returns the public keys that can verify JWTs issued by the API Gateway, so that other services can verify them without the signing keys
+func (s *APIGatewayServer) GetJWKS(ctx context.Context, in *pb.GetJWKSParam) (*pb.JWKS, error) {
+	var jwks pb.JWKS
+	for _, k := range s.Authorization.JWKS() {
+		jwks.Keys = append(jwks.Keys, &pb.JWK{
+			Kty: k.KeyType,
+			Kid: k.KeyID,
+			Use: k.Use,
+			Alg: k.Algorithm,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Curve,
+			X:   k.X,
+		})
 	}
 
-	token, err := s.CreateJWT(in.Username)
+	return &jwks, nil
+}
+
+// rehashPassword replaces a user's stored password hash with one created using the current hashing algorithm and parameters
+// Failures are only logged since the user has already been authenticated and can be rehashed on a later login
+func (s *APIGatewayServer) rehashPassword(ctx context.Context, userID string, username string, password string) {
+	passwordHash, err := s.HashPassword(password)
 	if err != nil {
-		return &pb.JWT{}, err
+		log.Println("Failed to rehash password: ", err)
+		return
 	}
 
-	return &pb.JWT{JWT: token}, nil
+	err = s.ProduceUserPasswordUpdate(eventContextAs(ctx, userID, userID), user.Config{Username: username, PasswordHash: passwordHash})
+	if err != nil {
+		log.Println("Failed to produce password update: ", err)
+	}
 }
 
 // CreateUser validates the new username, then calls the event producer to publish a CreateUser event and responds to the initial gRPC
 func (s *APIGatewayServer) CreateUser(ctx context.Context, in *pb.CreateUserParam) (*pb.SimpleResponse, error) {
+	violations := []apperror.FieldViolation{}
+	if len(in.Username) < 6 || len(in.Username) > 30 {
+		violations = append(violations, apperror.FieldViolation{Field: "Username", Description: "Username must be between 6 and 30 characters"})
+	}
+
+	if len(in.Password) < 8 || len(in.Password) > 72 {
+		violations = append(violations, apperror.FieldViolation{Field: "Password", Description: "Password must be between 8 and 72 characters"})
+	}
+
+	if len(violations) > 0 {
+		return nil, apperror.NewInvalidArgument("INVALID_USER", "Failed to create new user: Invalid username or password", violations...)
+	}
+
 	valid, err := s.ValidateUsername(in.Username)
 	if err != nil {
 		return nil, err
 	}
 
 	if !valid {
-		return &pb.SimpleResponse{Message: "Username already exists"}, errors.New("Failed to create new user: Username already exists")
+		return nil, apperror.NewAlreadyExists("USERNAME_TAKEN", "Failed to create new user: Username already exists")
 	}
 
-	c := user.Config{Username: in.Username, Password: in.Password}
-	s.ProduceUserCreation(c)
+	passwordHash, err := s.HashPassword(in.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	c := user.Config{Username: in.Username, PasswordHash: passwordHash}
+	// the user has no ID yet, so a retried signup is recognized by its idempotency key and username
+	err = s.ProduceUserCreation(eventContextAs(ctx, "", "username:"+in.Username), c)
+	if err != nil {
+		return nil, err
+	}
 
 	return &pb.SimpleResponse{
 		Message: "User Creation accepted",
@@ -64,260 +163,355 @@ func (s *APIGatewayServer) CreateUser(ctx context.Context, in *pb.CreateUserPara
 
 // CreateTweet calls the event producer to create a new tweet, then responds to the initial gRPC
 func (s *APIGatewayServer) CreateTweet(ctx context.Context, in *pb.CreateTweetParam) (*pb.SimpleResponse, error) {
-	headers, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return &pb.SimpleResponse{Message: "Invalid JWT"}, errors.New("Failed to find JWT")
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	authHeaders := headers["authorization"]
-	if len(authHeaders) < 1 {
-		return &pb.SimpleResponse{}, errors.New("Failed to find JWT")
+	userID := p.UserID
+
+	if len(in.TweetText) < 1 || len(in.TweetText) > 100 {
+		return nil, apperror.NewInvalidArgument(
+			"INVALID_TWEET",
+			"Failed to create tweet: Invalid tweet text",
+			apperror.FieldViolation{Field: "TweetText", Description: "Tweet text must be between 1 and 100 characters"},
+		)
 	}
 
-	tokenString := headers["authorization"][0]
-	token, err := s.ValidateJWT(tokenString)
+	c := tweet.Config{UserID: userID, Text: in.TweetText}
+	err = s.ProduceTweetCreation(eventContext(ctx), c)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Invalid JWT"}, err
+		return nil, err
 	}
 
-	claims := token.Claims.(*auth.JWTClaims)
-	userID := claims.UserID
+	return &pb.SimpleResponse{Message: "Tweet Creation accepted"}, nil
+}
 
-	c := tweet.Config{UserID: userID, Text: in.TweetText}
-	err = s.ProduceTweetCreation(c)
+// EditTweet calls the event producer to replace the text of one of the current user's tweets (if it is still within the edit window)
+func (s *APIGatewayServer) EditTweet(ctx context.Context, in *pb.EditTweetParam) (*pb.SimpleResponse, error) {
+	p, err := principal(ctx)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Failed to create tweet"}, err
+		return nil, err
 	}
 
-	return &pb.SimpleResponse{Message: "Tweet Creation accepted"}, nil
+	if len(in.TweetText) < 1 || len(in.TweetText) > 100 {
+		return nil, apperror.NewInvalidArgument(
+			"INVALID_TWEET",
+			"Failed to edit tweet: Invalid tweet text",
+			apperror.FieldViolation{Field: "TweetText", Description: "Tweet text must be between 1 and 100 characters"},
+		)
+	}
+
+	t, err := s.ownTweet(p.UserID, in.TweetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(t.CreatedAt) > s.TweetEditWindow {
+		return nil, apperror.NewPermissionDenied("EDIT_WINDOW_EXPIRED", "Failed to edit tweet: Tweets can only be edited within "+s.TweetEditWindow.String()+" of being created")
+	}
+
+	e := tweet.Edit{TweetID: t.ID, UserID: p.UserID, Text: in.TweetText}
+	err = s.ProduceTweetEdit(eventContext(ctx), e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Tweet Edit accepted"}, nil
 }
 
-// CreateFollow calls the event producer to make the current user a follower of the given UserID
-func (s *APIGatewayServer) CreateFollow(ctx context.Context, in *pb.CreateFollowParam) (*pb.SimpleResponse, error) {
-	headers, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return &pb.SimpleResponse{Message: "Invalid JWT"}, errors.New("Failed to find JWT")
+// DeleteTweet calls the event producer to delete one of the current user's tweets
+func (s *APIGatewayServer) DeleteTweet(ctx context.Context, in *pb.DeleteTweetParam) (*pb.SimpleResponse, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.ownTweet(p.UserID, in.TweetID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := tweet.Deletion{TweetID: t.ID, UserID: p.UserID}
+	err = s.ProduceTweetDeletion(eventContext(ctx), d)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Tweet Deletion accepted"}, nil
+}
+
+// GetTweetHistory returns every version of a tweet's text, oldest first (the last being the current version)
+func (s *APIGatewayServer) GetTweetHistory(ctx context.Context, in *pb.GetTweetHistoryParam) (*pb.TweetRevisions, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.TweetRepository.FindByID(in.TweetID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.canViewTweets(p.UserID, t.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !allowed {
+		return nil, apperror.NewPermissionDenied("NOT_A_FOLLOWER", "Unauthorized: You must be a follower to view this user's tweets")
+	}
+
+	var pbRevisions pb.TweetRevisions
+	for _, r := range t.Revisions {
+		pbRevisions.Revisions = append(pbRevisions.Revisions, &pb.TweetRevision{
+			Text:      r.Text,
+			CreatedAt: toPBTimestamp(r.CreatedAt),
+		})
 	}
 
-	authHeaders := headers["authorization"]
-	if len(authHeaders) < 1 {
-		return &pb.SimpleResponse{}, errors.New("Failed to find JWT")
+	current := t.CreatedAt
+	if !t.EditedAt.IsZero() {
+		current = t.EditedAt
 	}
+	pbRevisions.Revisions = append(pbRevisions.Revisions, &pb.TweetRevision{
+		Text:      t.Text,
+		CreatedAt: toPBTimestamp(current),
+	})
 
-	tokenString := headers["authorization"][0]
-	token, err := s.ValidateJWT(tokenString)
+	return &pbRevisions, nil
+}
+
+// ownTweet fetches a tweet, checking that it belongs to the given user
+func (s *APIGatewayServer) ownTweet(userID string, tweetID string) (tweet.Tweet, error) {
+	t, err := s.TweetRepository.FindByID(tweetID)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Invalid JWT"}, err
+		return tweet.Tweet{}, err
+	}
+
+	if t.UserID != userID {
+		return tweet.Tweet{}, apperror.NewPermissionDenied("NOT_TWEET_OWNER", "Unauthorized: You can only change your own tweets")
+	}
+
+	return t, nil
+}
+
+// CreateFollow calls the event producer to make the current user a follower of the given UserID
+func (s *APIGatewayServer) CreateFollow(ctx context.Context, in *pb.CreateFollowParam) (*pb.SimpleResponse, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	claims := token.Claims.(*auth.JWTClaims)
-	currentUserID := claims.UserID
-	currentUsername := claims.Username
+	currentUserID := p.UserID
+	currentUsername := p.Username
 
 	followeeUsername := in.FolloweeUsername
-	if currentUsername == followeeUsername {
-		return &pb.SimpleResponse{Message: "A user cannot follow him/her self"}, errors.New("Failed to follow user: cannot follow yourself")
+	if strings.EqualFold(currentUsername, followeeUsername) {
+		return nil, apperror.NewInvalidArgument(
+			"CANNOT_FOLLOW_SELF",
+			"Failed to follow user: cannot follow yourself",
+			apperror.FieldViolation{Field: "FolloweeUsername", Description: "A user cannot follow him/her self"},
+		)
 	}
 
 	followee, err := s.UserRepository.FindByUsername(followeeUsername)
+	if err != nil {
+		return nil, err
+	}
+
 	if followee.ID == "" {
-		return &pb.SimpleResponse{Message: "Invalid UserID"}, errors.New("Failed to follow user : Invalid UserID")
+		return nil, apperror.NewNotFound("USER_NOT_FOUND", "Failed to follow user: User does not exist")
 	}
 
-	followees, err := s.FollowRepository.FindFolloweesByUserID(currentUserID)
+	following, err := s.FollowRepository.IsFollowing(currentUserID, followee.ID)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Failed to create follow"}, errors.New("Failed to follow user : Error")
+		return nil, err
 	}
 
-	for _, f := range followees {
-		if f.FolloweeUsername == followeeUsername {
-			return &pb.SimpleResponse{Message: "Failed to create follow"}, errors.New("You already follow this user")
-		}
+	if following {
+		return nil, apperror.NewAlreadyExists("ALREADY_FOLLOWING", "You already follow this user")
 	}
 
 	f := follow.Config{
 		FollowerUserID: currentUserID,
 		FolloweeUserID: followee.ID,
 	}
-	err = s.ProduceFollowCreation(f)
+	err = s.ProduceFollowCreation(eventContext(ctx), f)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Failed to follow user"}, err
+		return nil, err
 	}
 
 	return &pb.SimpleResponse{Message: "Follow accepted"}, nil
 }
 
-// GetFollowers returns the followers of a given UserID
-func (s *APIGatewayServer) GetFollowers(ctx context.Context, in *pb.GetFollowersParam) (*pb.Follows, error) {
-	headers, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return &pb.Follows{}, errors.New("Failed to find JWT")
+// UnfollowUser calls the event producer to remove the current user as a follower of the given username
+func (s *APIGatewayServer) UnfollowUser(ctx context.Context, in *pb.UnfollowUserParam) (*pb.SimpleResponse, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	authHeaders := headers["authorization"]
-	if len(authHeaders) < 1 {
-		return &pb.Follows{}, errors.New("Failed to find JWT")
+	followee, err := s.UserRepository.FindByUsername(in.FolloweeUsername)
+	if err != nil {
+		return nil, err
+	}
+
+	following := false
+	if followee.ID != "" {
+		following, err = s.FollowRepository.IsFollowing(p.UserID, followee.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	tokenString := headers["authorization"][0]
-	token, err := s.ValidateJWT(tokenString)
+	if !following {
+		return nil, apperror.NewNotFound("NOT_FOLLOWING", "You do not follow this user")
+	}
+
+	f := follow.Config{
+		FollowerUserID: p.UserID,
+		FolloweeUserID: followee.ID,
+	}
+	err = s.ProduceFollowDeletion(eventContext(ctx), f)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
-	claims := token.Claims.(*auth.JWTClaims)
-	userID := claims.UserID
+	return &pb.SimpleResponse{Message: "Unfollow accepted"}, nil
+}
+
+// GetFollowers returns a page of the followers of a given UserID, newest first
+func (s *APIGatewayServer) GetFollowers(ctx context.Context, in *pb.GetFollowersParam) (*pb.Follows, error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	followers, err := s.FollowRepository.FindFollowersByUserID(userID)
+	userID := p.UserID
+
+	followers, nextPageToken, err := s.FollowRepository.FindFollowersByUserID(userID, in.PageSize, in.PageToken)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
-	var pbFollows pb.Follows
+	pbFollows := pb.Follows{NextPageToken: nextPageToken}
 	for _, f := range followers {
 		pbFollows.Follows = append(pbFollows.Follows, &pb.Follow{
 			FollowerUserID:   f.FollowerUserID,
 			FollowerUsername: f.FollowerUsername,
 			FolloweeUserID:   f.FolloweeUserID,
 			FolloweeUsername: f.FolloweeUsername,
+			CreatedAt:        toPBTimestamp(f.CreatedAt),
 		})
 	}
 
 	return &pbFollows, nil
 }
 
-// GetFollowees returns the followees of a given UserID (i.e., users that the user follows)
+// GetFollowees returns a page of the followees of a given UserID (i.e., users that the user follows), newest first
 func (s *APIGatewayServer) GetFollowees(ctx context.Context, in *pb.GetFolloweesParam) (*pb.Follows, error) {
-	headers, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return &pb.Follows{}, errors.New("Failed to find JWT")
-	}
-
-	authHeaders := headers["authorization"]
-	if len(authHeaders) < 1 {
-		return &pb.Follows{}, errors.New("Failed to find JWT")
-	}
-
-	tokenString := headers["authorization"][0]
-	token, err := s.ValidateJWT(tokenString)
+	p, err := principal(ctx)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
-	claims := token.Claims.(*auth.JWTClaims)
-	userID := claims.UserID
+	userID := p.UserID
 
-	followees, err := s.FollowRepository.FindFolloweesByUserID(userID)
+	followees, nextPageToken, err := s.FollowRepository.FindFolloweesByUserID(userID, in.PageSize, in.PageToken)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
-	var pbFollows pb.Follows
+	pbFollows := pb.Follows{NextPageToken: nextPageToken}
 	for _, f := range followees {
 		pbFollows.Follows = append(pbFollows.Follows, &pb.Follow{
 			FollowerUserID:   f.FollowerUserID,
 			FollowerUsername: f.FollowerUsername,
 			FolloweeUserID:   f.FolloweeUserID,
 			FolloweeUsername: f.FolloweeUsername,
+			CreatedAt:        toPBTimestamp(f.CreatedAt),
 		})
 	}
 
 	return &pbFollows, nil
 }
 
-// GetUserTweets returns the tweets created by a given UserID
+// GetUserTweets returns a page of the tweets created by a given UserID, newest first
 func (s *APIGatewayServer) GetUserTweets(ctx context.Context, in *pb.GetUserTweetsParam) (*pb.Tweets, error) {
-	headers, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return &pb.Tweets{}, errors.New("Failed to find JWT")
-	}
-
-	authHeaders := headers["authorization"]
-	if len(authHeaders) < 1 {
-		return &pb.Tweets{}, errors.New("Failed to find JWT")
-	}
-
-	tokenString := headers["authorization"][0]
-	token, err := s.ValidateJWT(tokenString)
+	p, err := principal(ctx)
 	if err != nil {
-		return &pb.Tweets{}, err
+		return nil, err
 	}
 
-	claims := token.Claims.(*auth.JWTClaims)
-
-	allowed := false
-	if in.UserID == claims.UserID {
-		allowed = true
-	} else {
-		followees, err := s.FollowRepository.FindFolloweesByUserID(claims.UserID)
-		if err != nil {
-			return &pb.Tweets{}, err
-		}
-
-		for _, f := range followees {
-			if f.FolloweeUserID == in.UserID {
-				allowed = true
-				break
-			}
-		}
+	allowed, err := s.canViewTweets(p.UserID, in.UserID)
+	if err != nil {
+		return nil, err
 	}
 
 	if !allowed {
-		return &pb.Tweets{}, errors.New("Unauthorized: You must be a follower to view this user's tweets")
+		return nil, apperror.NewPermissionDenied("NOT_A_FOLLOWER", "Unauthorized: You must be a follower to view this user's tweets")
 	}
 
-	tweets, err := s.TweetRepository.FindByUserID(claims.UserID)
+	// the tweets of the requested user, not of the signed-in user (who may be viewing a followee's tweets)
+	tweets, nextPageToken, err := s.TweetRepository.FindByUserID(in.UserID, in.PageSize, in.PageToken)
 	if err != nil {
-		return &pb.Tweets{}, err
+		return nil, err
 	}
 
-	var pbTweets pb.Tweets
+	pbTweets := pb.Tweets{NextPageToken: nextPageToken}
 	for _, t := range tweets {
-		pbTweets.Tweets = append(pbTweets.Tweets, &pb.Tweet{
-			ID:       t.ID,
-			UserID:   t.UserID,
-			Username: t.Username,
-			Text:     t.Text,
-		})
+		pbTweets.Tweets = append(pbTweets.Tweets, toPBTweet(t))
 	}
 
 	return &pbTweets, nil
 }
 
-// GetTimelineTweets returns the timeline (i.e., tweets of users that this user follows) of a given UserID
+// GetTimelineTweets returns a page of the timeline (i.e., tweets of users that this user follows, newest first) of a given UserID
 func (s *APIGatewayServer) GetTimelineTweets(ctx context.Context, in *pb.GetTimelineTweetsParam) (*pb.Tweets, error) {
-	headers, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return &pb.Tweets{}, errors.New("Failed to find JWT")
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	authHeaders := headers["authorization"]
-	if len(authHeaders) < 1 {
-		return &pb.Tweets{}, errors.New("Failed to find JWT")
+	tweets, nextPageToken, err := s.TweetRepository.FindTimelineByUserID(p.UserID, in.PageSize, in.PageToken)
+	if err != nil {
+		return nil, err
 	}
 
-	tokenString := headers["authorization"][0]
-	token, err := s.ValidateJWT(tokenString)
-	if err != nil {
-		return &pb.Tweets{}, err
+	pbTweets := pb.Tweets{NextPageToken: nextPageToken}
+	for _, t := range tweets {
+		pbTweets.Tweets = append(pbTweets.Tweets, toPBTweet(t))
 	}
 
-	claims := token.Claims.(*auth.JWTClaims)
+	return &pbTweets, nil
+}
 
-	tweets, err := s.TweetRepository.FindTimelineByUserID(claims.UserID)
-	if err != nil {
-		return &pb.Tweets{}, err
+// canViewTweets checks if a user can view another user's tweets (i.e., they are the same user or the viewer follows the author)
+func (s *APIGatewayServer) canViewTweets(viewerUserID string, authorUserID string) (bool, error) {
+	if viewerUserID == authorUserID {
+		return true, nil
 	}
 
-	var pbTweets pb.Tweets
-	for _, t := range tweets {
-		pbTweets.Tweets = append(pbTweets.Tweets, &pb.Tweet{
-			ID:       t.ID,
-			UserID:   t.UserID,
-			Username: t.Username,
-			Text:     t.Text,
-		})
+	return s.FollowRepository.IsFollowing(viewerUserID, authorUserID)
+}
+
+func toPBTweet(t tweet.Tweet) *pb.Tweet {
+	return &pb.Tweet{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Username:  t.Username,
+		Text:      t.Text,
+		CreatedAt: toPBTimestamp(t.CreatedAt),
+		EditedAt:  toPBTimestamp(t.EditedAt),
 	}
+}
 
-	return &pbTweets, nil
+// toPBTimestamp converts a time to a protobuf timestamp, leaving zero times unset
+func toPBTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
 }
@@ -0,0 +1,101 @@
+package application
+
+import (
+	"context"
+	"testing"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/tweet"
+	pb "github.com/martinmhan/tweet-app-api/cmd/apigateway/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// fakeTweets holds each user's tweets
+type fakeTweets map[string][]tweet.Tweet
+
+func (r fakeTweets) FindByID(tweetID string) (tweet.Tweet, error) {
+	for _, tweets := range r {
+		for _, t := range tweets {
+			if t.ID == tweetID {
+				return t, nil
+			}
+		}
+	}
+
+	return tweet.Tweet{}, apperror.NewNotFound("TWEET_NOT_FOUND", "Tweet not found")
+}
+
+func (r fakeTweets) FindByUserID(userID string, pageSize int32, pageToken string) ([]tweet.Tweet, string, error) {
+	return r[userID], "", nil
+}
+
+func (r fakeTweets) FindTimelineByUserID(userID string, pageSize int32, pageToken string) ([]tweet.Tweet, string, error) {
+	return nil, "", nil
+}
+
+// fakeFollows holds the UserIDs each user follows
+type fakeFollows map[string][]string
+
+func (r fakeFollows) IsFollowing(followerUserID string, followeeUserID string) (bool, error) {
+	for _, id := range r[followerUserID] {
+		if id == followeeUserID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r fakeFollows) FindFollowersByUserID(userID string, pageSize int32, pageToken string) ([]follow.Follow, string, error) {
+	return nil, "", nil
+}
+
+func (r fakeFollows) FindFolloweesByUserID(userID string, pageSize int32, pageToken string) ([]follow.Follow, string, error) {
+	return nil, "", nil
+}
+
+// TestGetUserTweets checks that the tweets of the requested user are returned (rather than the signed-in user's own tweets),
+// and only to that user and their followers
+func TestGetUserTweets(t *testing.T) {
+	s := &APIGatewayServer{
+		TweetRepository: fakeTweets{
+			"alice": {{ID: "tweet-1", UserID: "alice", Text: "Hello from alice"}},
+			"bob":   {{ID: "tweet-2", UserID: "bob", Text: "Hello from bob"}},
+			"carol": {{ID: "tweet-3", UserID: "carol", Text: "Hello from carol"}},
+		},
+		FollowRepository: fakeFollows{"bob": {"alice"}},
+	}
+
+	tests := []struct {
+		viewer  string
+		author  string
+		tweetID string
+		denied  bool
+	}{
+		{viewer: "alice", author: "alice", tweetID: "tweet-1"},
+		{viewer: "bob", author: "alice", tweetID: "tweet-1"},
+		{viewer: "carol", author: "alice", denied: true},
+	}
+
+	for _, tt := range tests {
+		ctx := auth.NewContext(context.Background(), auth.Principal{UserID: tt.viewer})
+		tweets, err := s.GetUserTweets(ctx, &pb.GetUserTweetsParam{UserID: tt.author})
+
+		if tt.denied {
+			if !apperror.Is(err, apperror.PermissionDenied) {
+				t.Errorf("%s viewing %s's tweets: expected permission denied, got %v", tt.viewer, tt.author, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s viewing %s's tweets: %s", tt.viewer, tt.author, err)
+			continue
+		}
+
+		if len(tweets.Tweets) != 1 || tweets.Tweets[0].ID != tt.tweetID {
+			t.Errorf("%s viewing %s's tweets: expected %s, got %v", tt.viewer, tt.author, tt.tweetID, tweets.Tweets)
+		}
+	}
+}
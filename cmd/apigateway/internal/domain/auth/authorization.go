@@ -1,75 +1,35 @@
 package auth
 
 import (
-	"errors"
-	"time"
-
 	jwt "github.com/dgrijalva/jwt-go"
 
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/token"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/user"
 )
 
 // Authorization is an interface containing auth methods
 type Authorization interface {
-	CreateJWT(username string) (string, error)
+	CreateTokens(username string) (Tokens, error)
+	RefreshTokens(refreshToken string) (Tokens, error)
+	RevokeTokens(p Principal, refreshToken string) error
 	ValidateJWT(tokenString string) (*jwt.Token, error)
+	Authenticate(tokenString string) (Principal, error)
 	ValidateUsername(username string) (bool, error)
-	ValidatePassword(username string, password string) (bool, error)
+	ValidatePassword(username string, password string) (userID string, needsRehash bool, err error)
+	HashPassword(password string) (string, error)
+	JWKS() []JWK
 }
 
 // New returns an Authorization object
-func New(jwtKey string, ur user.Repository) Authorization {
-	return &auth{jwtKey, ur}
+func New(kr KeyRing, ur user.Repository, tr token.Repository, ph PasswordHasher) Authorization {
+	return &auth{kr, ur, tr, ph}
 }
 
 type auth struct {
-	JWTKey         string
-	UserRepository user.Repository
-}
-
-// CreateJWT creates a JSON web token with username and expiration properties given a username and jwtKey
-func (a *auth) CreateJWT(username string) (string, error) {
-	u, err := a.UserRepository.FindByUsername(username)
-	if err != nil {
-		return "", err
-	}
-
-	if u.ID == "" {
-		return "", errors.New("User does not exist")
-	}
-
-	claims := JWTClaims{
-		username,
-		u.ID,
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 4).Unix(),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), claims)
-	tokenString, err := token.SignedString([]byte(a.JWTKey))
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
-}
-
-// ValidateJWT validates a JSON web token
-func (a *auth) ValidateJWT(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(*jwt.Token) (interface{}, error) {
-		return []byte(a.JWTKey), nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	_, ok := token.Claims.(*JWTClaims)
-	if !ok || !token.Valid {
-		return nil, errors.New("Invalid token")
-	}
-
-	return token, nil
+	KeyRing         KeyRing
+	UserRepository  user.Repository
+	TokenRepository token.Repository
+	PasswordHasher  PasswordHasher
 }
 
 // ValidateUsername checks if a user already exists with the given username
@@ -86,27 +46,45 @@ func (a *auth) ValidateUsername(username string) (bool, error) {
 	return true, nil
 }
 
-// ValidatePassword checks if the given password is correct for the given username
-func (a *auth) ValidatePassword(username string, password string) (bool, error) {
+// ValidatePassword checks if the given password is correct for the given username, returning the user's ID if it is (or "" if not)
+// needsRehash is true if the password is correct but its stored hash uses an outdated algorithm or parameters
+func (a *auth) ValidatePassword(username string, password string) (userID string, needsRehash bool, err error) {
 	u, err := a.UserRepository.FindByUsername(username)
 	if err != nil {
-		return false, err
+		return "", false, err
 	}
 
 	if u.ID == "" {
-		return false, nil
+		return "", false, nil
 	}
 
-	if u.Password != password {
-		return false, nil
+	valid, err := a.PasswordHasher.Verify(u.PasswordHash, password)
+	if err != nil || !valid {
+		return "", false, err
 	}
 
-	return true, nil
+	return u.ID, a.PasswordHasher.NeedsRehash(u.PasswordHash), nil
+}
+
+// HashPassword hashes a password so that it can be stored
+func (a *auth) HashPassword(password string) (string, error) {
+	return a.PasswordHasher.Hash(password)
+}
+
+// JWKS returns the public keys that can currently verify JWTs (i.e., a JSON Web Key Set)
+func (a *auth) JWKS() []JWK {
+	jwks := []JWK{}
+	for _, k := range a.KeyRing.VerificationKeys() {
+		jwks = append(jwks, k.JWK())
+	}
+
+	return jwks
 }
 
 // JWTClaims contains the fields stored in a JWT
 type JWTClaims struct {
 	Username string
 	UserID   string
+	Scopes   []string
 	jwt.StandardClaims
 }
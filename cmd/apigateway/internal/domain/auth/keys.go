@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// KeyRing is an interface for the asymmetric keys used to sign and verify JWTs
+// The active key signs new tokens, while previous keys (identified by the kid header) can still verify tokens they signed
+type KeyRing interface {
+	SigningKey() SigningKey
+	VerificationKey(kid string) (SigningKey, bool)
+	VerificationKeys() []SigningKey
+}
+
+// KeyStore is an interface for persisting the key ring, so that every API Gateway instance (and restart) uses the same keys
+// FindKeys returns the active key (if any) first, then the retired keys. RotateKey makes a new key active and retires the
+// active one, failing with an Aborted error if activeKeyID is no longer the active key (i.e., another instance rotated it first)
+type KeyStore interface {
+	FindKeys() ([]StoredKey, error)
+	RotateKey(next StoredKey, activeKeyID string, retiredKeyExpiresAt time.Time) error
+}
+
+// A StoredKey is a signing key as it is persisted, with its private key encrypted by the key ring
+type StoredKey struct {
+	ID                  string
+	Algorithm           string
+	EncryptedPrivateKey []byte
+	CreatedAt           time.Time
+	RetiredAt           time.Time // zero for the active key
+}
+
+// A SigningKey is an asymmetric key pair identified by a key ID
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// A JWK is the public part of a SigningKey encoded as a JSON Web Key (RFC 7517)
+type JWK struct {
+	KeyType   string
+	KeyID     string
+	Use       string
+	Algorithm string
+	N         string // RSA modulus
+	E         string // RSA exponent
+	Curve     string // OKP curve
+	X         string // OKP public key
+}
+
+// JWK returns the public JSON Web Key of the signing key
+func (k SigningKey) JWK() JWK {
+	j := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		j.KeyType = "RSA"
+		j.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		j.KeyType = "OKP"
+		j.Curve = "Ed25519"
+		j.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return j
+}
@@ -0,0 +1,9 @@
+package auth
+
+// PasswordHasher is an interface for hashing and verifying user passwords
+// Encoded hashes include the algorithm and its parameters so that hashes created with outdated parameters can be detected and upgraded
+type PasswordHasher interface {
+	Hash(password string) (encodedHash string, err error)
+	Verify(encodedHash string, password string) (bool, error)
+	NeedsRehash(encodedHash string) bool
+}
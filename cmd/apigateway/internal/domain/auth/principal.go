@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Scopes granted to users' tokens
+const (
+	ScopeTweetsRead   = "tweets:read"
+	ScopeTweetsWrite  = "tweets:write"
+	ScopeFollowsRead  = "follows:read"
+	ScopeFollowsWrite = "follows:write"
+)
+
+// DefaultScopes are the scopes granted to a user when logging in
+var DefaultScopes = []string{ScopeTweetsRead, ScopeTweetsWrite, ScopeFollowsRead, ScopeFollowsWrite}
+
+// A Principal is the authenticated user making a request
+type Principal struct {
+	UserID    string
+	Username  string
+	TokenID   string
+	ExpiresAt time.Time
+	Scopes    []string
+}
+
+// HasScope checks if the principal has been granted the given scope
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of the context carrying the given principal
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal carried by the context (if any)
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/token"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+const (
+	// AccessTokenLifetime is how long a JWT is valid for (keys rotated out of the key ring must remain available for at least this long)
+	AccessTokenLifetime  = 15 * time.Minute
+	refreshTokenLifetime = 30 * 24 * time.Hour
+	bearerPrefix         = "Bearer "
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token does not exist, has expired or has been revoked
+	ErrInvalidRefreshToken = apperror.NewUnauthenticated("INVALID_REFRESH_TOKEN", "Invalid refresh token")
+	// ErrRefreshTokenReuse is returned when an already rotated refresh token is used again, which revokes its whole family
+	ErrRefreshTokenReuse = apperror.NewUnauthenticated("REFRESH_TOKEN_REUSED", "Refresh token has already been used")
+	// ErrRevokedToken is returned when an access token has been revoked (e.g., by logging out)
+	ErrRevokedToken = apperror.NewUnauthenticated("TOKEN_REVOKED", "Token has been revoked")
+)
+
+// Tokens contains a short-lived access token (JWT) and the refresh token that can be used to renew it
+type Tokens struct {
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+	RefreshToken         string
+}
+
+// CreateTokens issues an access token and a refresh token (starting a new token family) for the given username
+func (a *auth) CreateTokens(username string) (Tokens, error) {
+	u, err := a.UserRepository.FindByUsername(username)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if u.ID == "" {
+		return Tokens{}, apperror.NewNotFound("USER_NOT_FOUND", "User does not exist")
+	}
+
+	familyID, err := randomString()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return a.issueTokens(u.ID, u.Username, familyID)
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and refresh token (in the same family)
+// A refresh token can only be used once. Using it again means it has been stolen, so its whole family is revoked
+func (a *auth) RefreshTokens(refreshToken string) (Tokens, error) {
+	rt, err := a.TokenRepository.UseRefreshToken(hashToken(refreshToken))
+	if apperror.Is(err, apperror.NotFound) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if rt.Revoked || time.Now().After(rt.ExpiresAt) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	if rt.Used {
+		err = a.TokenRepository.RevokeRefreshTokenFamily(rt.FamilyID)
+		if err != nil {
+			return Tokens{}, err
+		}
+
+		return Tokens{}, ErrRefreshTokenReuse
+	}
+
+	return a.issueTokens(rt.UserID, rt.Username, rt.FamilyID)
+}
+
+// RevokeTokens revokes the principal's access token until it expires, along with the family of the given refresh token (if any)
+func (a *auth) RevokeTokens(p Principal, refreshToken string) error {
+	if refreshToken != "" {
+		rt, err := a.TokenRepository.FindRefreshToken(hashToken(refreshToken))
+		if apperror.Is(err, apperror.NotFound) || (err == nil && rt.UserID != p.UserID) {
+			return ErrInvalidRefreshToken
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = a.TokenRepository.RevokeRefreshTokenFamily(rt.FamilyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.TokenRepository.RevokeAccessToken(p.TokenID, p.ExpiresAt)
+}
+
+// Authenticate validates a JSON web token (with or without a "Bearer " prefix) and returns the principal it was issued to
+func (a *auth) Authenticate(tokenString string) (Principal, error) {
+	if len(tokenString) > len(bearerPrefix) && strings.EqualFold(tokenString[:len(bearerPrefix)], bearerPrefix) {
+		tokenString = tokenString[len(bearerPrefix):]
+	}
+
+	token, err := a.ValidateJWT(tokenString)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	claims := token.Claims.(*JWTClaims)
+
+	return Principal{
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		TokenID:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		Scopes:    claims.Scopes,
+	}, nil
+}
+
+// ValidateJWT validates a JSON web token and checks that it has not been revoked
+func (a *auth) ValidateJWT(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, ok := a.KeyRing.VerificationKey(kid)
+		if !ok {
+			return nil, errors.New("Unknown signing key")
+		}
+
+		if t.Method.Alg() != k.Method.Alg() {
+			return nil, errors.New("Unexpected signing method")
+		}
+
+		return k.Public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid || claims.Id == "" {
+		return nil, errors.New("Invalid token")
+	}
+
+	revoked, err := a.TokenRepository.IsAccessTokenRevoked(claims.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, ErrRevokedToken
+	}
+
+	return token, nil
+}
+
+func (a *auth) issueTokens(userID string, username string, familyID string) (Tokens, error) {
+	tokenID, err := randomString()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenLifetime)
+	claims := JWTClaims{
+		username,
+		userID,
+		DefaultScopes,
+		jwt.StandardClaims{
+			Id:        tokenID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+
+	k := a.KeyRing.SigningKey()
+	t := jwt.NewWithClaims(k.Method, claims)
+	t.Header["kid"] = k.ID
+	accessToken, err := t.SignedString(k.Private)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	refreshToken, err := randomString()
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	err = a.TokenRepository.SaveRefreshToken(token.RefreshToken{
+		TokenHash: hashToken(refreshToken),
+		UserID:    userID,
+		Username:  username,
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(refreshTokenLifetime),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: expiresAt,
+		RefreshToken:         refreshToken,
+	}, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(t string) string {
+	h := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/token"
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// fakeUsers holds users by username
+type fakeUsers map[string]user.User
+
+func (r fakeUsers) FindByID(userID string) (user.User, error) {
+	for _, u := range r {
+		if u.ID == userID {
+			return u, nil
+		}
+	}
+
+	return user.User{}, nil
+}
+
+func (r fakeUsers) FindByUsername(username string) (user.User, error) {
+	return r[username], nil
+}
+
+// fakeTokens holds refresh tokens by hash
+type fakeTokens map[string]token.RefreshToken
+
+func (r fakeTokens) SaveRefreshToken(rt token.RefreshToken) error {
+	r[rt.TokenHash] = rt
+	return nil
+}
+
+func (r fakeTokens) FindRefreshToken(tokenHash string) (token.RefreshToken, error) {
+	rt, ok := r[tokenHash]
+	if !ok {
+		return token.RefreshToken{}, apperror.NewNotFound("REFRESH_TOKEN_NOT_FOUND", "Refresh token not found")
+	}
+
+	return rt, nil
+}
+
+func (r fakeTokens) UseRefreshToken(tokenHash string) (token.RefreshToken, error) {
+	rt, err := r.FindRefreshToken(tokenHash)
+	if err != nil {
+		return rt, err
+	}
+
+	used := rt
+	used.Used = true
+	r[tokenHash] = used
+
+	return rt, nil
+}
+
+func (r fakeTokens) RevokeRefreshTokenFamily(familyID string) error {
+	for hash, rt := range r {
+		if rt.FamilyID == familyID {
+			rt.Revoked = true
+			r[hash] = rt
+		}
+	}
+
+	return nil
+}
+
+func (r fakeTokens) RevokeAccessToken(tokenID string, expiresAt time.Time) error { return nil }
+func (r fakeTokens) IsAccessTokenRevoked(tokenID string) (bool, error)           { return false, nil }
+
+// staticKeyRing signs with a single key
+type staticKeyRing struct {
+	key SigningKey
+}
+
+func (kr staticKeyRing) SigningKey() SigningKey { return kr.key }
+
+func (kr staticKeyRing) VerificationKey(kid string) (SigningKey, bool) {
+	return kr.key, kid == kr.key.ID
+}
+
+func (kr staticKeyRing) VerificationKeys() []SigningKey { return []SigningKey{kr.key} }
+
+func newTestAuth(t *testing.T) (*auth, fakeTokens) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := fakeTokens{}
+	a := &auth{
+		KeyRing:         staticKeyRing{SigningKey{ID: "key-1", Method: SigningMethodEdDSA, Private: priv, Public: pub}},
+		UserRepository:  fakeUsers{"username1": {ID: "user-1", Username: "username1"}},
+		TokenRepository: tokens,
+	}
+
+	return a, tokens
+}
+
+// TestRefreshTokens exchanges refresh tokens in various states, and checks that reusing a rotated one revokes its whole family
+func TestRefreshTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		prepare       func(t *testing.T, a *auth, tokens fakeTokens) string // returns the refresh token to exchange
+		err           error
+		familyRevoked bool
+	}{
+		{
+			name: "fresh",
+			prepare: func(t *testing.T, a *auth, tokens fakeTokens) string {
+				return login(t, a).RefreshToken
+			},
+		},
+		{
+			name: "unknown",
+			prepare: func(t *testing.T, a *auth, tokens fakeTokens) string {
+				return "not-a-refresh-token"
+			},
+			err: ErrInvalidRefreshToken,
+		},
+		{
+			name: "expired",
+			prepare: func(t *testing.T, a *auth, tokens fakeTokens) string {
+				rt := login(t, a).RefreshToken
+				stored := tokens[hashToken(rt)]
+				stored.ExpiresAt = time.Now().Add(-time.Minute)
+				tokens[hashToken(rt)] = stored
+
+				return rt
+			},
+			err: ErrInvalidRefreshToken,
+		},
+		{
+			name: "reused",
+			prepare: func(t *testing.T, a *auth, tokens fakeTokens) string {
+				rt := login(t, a).RefreshToken
+				_, err := a.RefreshTokens(rt)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return rt
+			},
+			err:           ErrRefreshTokenReuse,
+			familyRevoked: true,
+		},
+		{
+			name: "rotated from a reused token",
+			prepare: func(t *testing.T, a *auth, tokens fakeTokens) string {
+				rt := login(t, a).RefreshToken
+				next, err := a.RefreshTokens(rt)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = a.RefreshTokens(rt)
+				if err != ErrRefreshTokenReuse {
+					t.Fatalf("got error %v, want %v", err, ErrRefreshTokenReuse)
+				}
+
+				return next.RefreshToken
+			},
+			err:           ErrInvalidRefreshToken,
+			familyRevoked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, tokens := newTestAuth(t)
+			rt := tt.prepare(t, a, tokens)
+
+			next, err := a.RefreshTokens(rt)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if err == nil {
+				p, err := a.Authenticate(next.AccessToken)
+				if err != nil || p.UserID != "user-1" {
+					t.Errorf("got principal %+v (error: %v) from the new access token", p, err)
+				}
+
+				if tokens[hashToken(next.RefreshToken)].FamilyID != tokens[hashToken(rt)].FamilyID {
+					t.Error("the new refresh token is not in the same family")
+				}
+			}
+
+			for _, stored := range tokens {
+				if stored.Revoked != tt.familyRevoked {
+					t.Errorf("got revoked %t for a token of the family, want %t", stored.Revoked, tt.familyRevoked)
+				}
+			}
+		})
+	}
+}
+
+func login(t *testing.T, a *auth) Tokens {
+	tokens, err := a.CreateTokens("username1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokens
+}
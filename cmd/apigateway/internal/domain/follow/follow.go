@@ -1,11 +1,14 @@
 package follow
 
+import "time"
+
 // A Follow represents a unique follower/followee relationship between two users
 type Follow struct {
 	FollowerUserID   string
 	FollowerUsername string
 	FolloweeUserID   string
 	FolloweeUsername string
+	CreatedAt        time.Time
 }
 
 // Config contains the fields necessary to create a follow
@@ -15,7 +18,9 @@ type Config struct {
 }
 
 // Repository interface for fetching users' followers
+// List methods return a page of follows (newest first) and the token of the next page, if any
 type Repository interface {
-	FindFollowersByUserID(userID string) ([]Follow, error)
-	FindFolloweesByUserID(userID string) ([]Follow, error)
+	IsFollowing(followerUserID string, followeeUserID string) (bool, error)
+	FindFollowersByUserID(userID string, pageSize int32, pageToken string) (follows []Follow, nextPageToken string, err error)
+	FindFolloweesByUserID(userID string, pageSize int32, pageToken string) (follows []Follow, nextPageToken string, err error)
 }
@@ -0,0 +1,26 @@
+package token
+
+import "time"
+
+// A RefreshToken is a long-lived token that can be exchanged (once) for a new access token and refresh token
+// Only the hash of a refresh token is stored. Every refresh token issued by rotating another one belongs to the same family
+type RefreshToken struct {
+	TokenHash string
+	UserID    string
+	Username  string
+	FamilyID  string
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// Repository interface for persisting refresh tokens and revoked access tokens
+type Repository interface {
+	SaveRefreshToken(RefreshToken) error
+	FindRefreshToken(tokenHash string) (RefreshToken, error)
+	// UseRefreshToken marks a refresh token as used and returns it as it was before being marked
+	UseRefreshToken(tokenHash string) (RefreshToken, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeAccessToken(tokenID string, expiresAt time.Time) error
+	IsAccessTokenRevoked(tokenID string) (bool, error)
+}
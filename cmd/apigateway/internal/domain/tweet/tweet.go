@@ -1,11 +1,22 @@
 package tweet
 
+import "time"
+
 // Tweet represents an existing tweet
 type Tweet struct {
-	ID       string
-	UserID   string
-	Username string
-	Text     string
+	ID        string
+	UserID    string
+	Username  string
+	Text      string
+	CreatedAt time.Time
+	EditedAt  time.Time
+	Revisions []Revision
+}
+
+// A Revision is a previous version of a tweet's text, along with when that version was written
+type Revision struct {
+	Text      string
+	CreatedAt time.Time
 }
 
 // Config contains the fields necessary to create a tweet
@@ -14,8 +25,23 @@ type Config struct {
 	Text   string
 }
 
+// Edit contains the fields necessary to replace a tweet's text
+type Edit struct {
+	TweetID string
+	UserID  string
+	Text    string
+}
+
+// Deletion contains the fields necessary to delete a tweet
+type Deletion struct {
+	TweetID string
+	UserID  string
+}
+
 // Repository interface for fetching users' tweets and timelines
+// List methods return a page of tweets (newest first) and the token of the next page, if any
 type Repository interface {
-	FindByUserID(UserID string) ([]Tweet, error)
-	FindTimelineByUserID(UserID string) ([]Tweet, error)
+	FindByID(tweetID string) (Tweet, error)
+	FindByUserID(userID string, pageSize int32, pageToken string) (tweets []Tweet, nextPageToken string, err error)
+	FindTimelineByUserID(userID string, pageSize int32, pageToken string) (tweets []Tweet, nextPageToken string, err error)
 }
@@ -1,16 +1,19 @@
 package user
 
+import "time"
+
 // A User represents an existing user
 type User struct {
-	ID       string
-	Username string
-	Password string
+	ID           string
+	Username     string
+	PasswordHash string
+	CreatedAt    time.Time
 }
 
-// Config contains the fields necessary to create a user
+// Config contains the fields necessary to create a user (or update a user's password)
 type Config struct {
-	Username string
-	Password string
+	Username     string
+	PasswordHash string
 }
 
 // Repository interface for fetching users
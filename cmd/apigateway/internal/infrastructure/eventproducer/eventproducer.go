@@ -10,15 +10,28 @@ import (
 )
 
 // EventProducer implements the methods of the EventProducer gRPC client utilizing the domain objects
+// Each method takes the context of the outgoing gRPC, so that its metadata (e.g., an idempotency key) is passed on
 type EventProducer struct {
 	eventproducerpb.EventProducerClient
 }
 
 // ProduceUserCreation tells the event producer service via gRPC to publish a Create User event to the message queue
-func (ep *EventProducer) ProduceUserCreation(u user.Config) error {
-	uc := eventproducerpb.UserConfig{Username: u.Username, Password: u.Password}
+func (ep *EventProducer) ProduceUserCreation(ctx context.Context, u user.Config) error {
+	uc := eventproducerpb.UserConfig{Username: u.Username, PasswordHash: u.PasswordHash}
 
-	_, err := ep.EventProducerClient.ProduceUserCreation(context.TODO(), &uc)
+	_, err := ep.EventProducerClient.ProduceUserCreation(ctx, &uc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ProduceUserPasswordUpdate sends a gRPC to the event producer service to publish a UserPasswordUpdate event to the message queue
+func (ep *EventProducer) ProduceUserPasswordUpdate(ctx context.Context, u user.Config) error {
+	uc := eventproducerpb.UserConfig{Username: u.Username, PasswordHash: u.PasswordHash}
+
+	_, err := ep.EventProducerClient.ProduceUserPasswordUpdate(ctx, &uc)
 	if err != nil {
 		return err
 	}
@@ -27,10 +40,10 @@ func (ep *EventProducer) ProduceUserCreation(u user.Config) error {
 }
 
 // ProduceTweetCreation sends a gRPC to the event producer service to publish a CreateTweet event to the message queue
-func (ep *EventProducer) ProduceTweetCreation(t tweet.Config) error {
+func (ep *EventProducer) ProduceTweetCreation(ctx context.Context, t tweet.Config) error {
 	tc := eventproducerpb.TweetConfig{UserID: t.UserID, Text: t.Text}
 
-	_, err := ep.EventProducerClient.ProduceTweetCreation(context.TODO(), &tc)
+	_, err := ep.EventProducerClient.ProduceTweetCreation(ctx, &tc)
 	if err != nil {
 		return err
 	}
@@ -39,13 +52,52 @@ func (ep *EventProducer) ProduceTweetCreation(t tweet.Config) error {
 }
 
 // ProduceFollowCreation sends a gRPC to the event producer service to publish a CreateFollow event to the message queue
-func (ep *EventProducer) ProduceFollowCreation(f follow.Config) error {
+func (ep *EventProducer) ProduceFollowCreation(ctx context.Context, f follow.Config) error {
+	fo := eventproducerpb.FollowConfig{
+		FollowerUserID: f.FollowerUserID,
+		FolloweeUserID: f.FolloweeUserID,
+	}
+
+	_, err := ep.EventProducerClient.ProduceFollowCreation(ctx, &fo)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ProduceFollowDeletion sends a gRPC to the event producer service to publish a FollowDeletion event to the message queue
+func (ep *EventProducer) ProduceFollowDeletion(ctx context.Context, f follow.Config) error {
 	fo := eventproducerpb.FollowConfig{
 		FollowerUserID: f.FollowerUserID,
 		FolloweeUserID: f.FolloweeUserID,
 	}
 
-	_, err := ep.EventProducerClient.ProduceFollowCreation(context.TODO(), &fo)
+	_, err := ep.EventProducerClient.ProduceFollowDeletion(ctx, &fo)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ProduceTweetEdit sends a gRPC to the event producer service to publish a TweetEdit event to the message queue
+func (ep *EventProducer) ProduceTweetEdit(ctx context.Context, t tweet.Edit) error {
+	te := eventproducerpb.TweetEditConfig{TweetID: t.TweetID, UserID: t.UserID, Text: t.Text}
+
+	_, err := ep.EventProducerClient.ProduceTweetEdit(ctx, &te)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ProduceTweetDeletion sends a gRPC to the event producer service to publish a TweetDeletion event to the message queue
+func (ep *EventProducer) ProduceTweetDeletion(ctx context.Context, t tweet.Deletion) error {
+	td := eventproducerpb.TweetDeletionConfig{TweetID: t.TweetID, UserID: t.UserID}
+
+	_, err := ep.EventProducerClient.ProduceTweetDeletion(ctx, &td)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,117 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id hashes passwords with argon2id
+// Hashes are encoded in the PHC string format, e.g., $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type Argon2id struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// Hash returns the PHC-encoded argon2id hash of the given password using a random salt
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.Memory,
+		a.Iterations,
+		a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify checks if the given password matches the given argon2id hash, using the parameters encoded in the hash
+func (a *Argon2id) Verify(encodedHash string, password string) (bool, error) {
+	p, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+// NeedsRehash checks if the given argon2id hash was created with parameters other than the current ones
+func (a *Argon2id) NeedsRehash(encodedHash string) bool {
+	p, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return true
+	}
+
+	return p.memory != a.Memory ||
+		p.iterations != a.Iterations ||
+		p.parallelism != a.Parallelism ||
+		uint32(len(p.salt)) != a.SaltLength ||
+		uint32(len(p.key)) != a.KeyLength
+}
+
+// Identifies checks if the given hash was created by argon2id
+func (a *Argon2id) Identifies(encodedHash string) bool {
+	return strings.HasPrefix(encodedHash, "$argon2id$")
+}
+
+func decodeArgon2id(encodedHash string) (argon2idParams, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2idParams{}, errors.New("Invalid argon2id hash")
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return argon2idParams{}, err
+	}
+
+	if version != argon2.Version {
+		return argon2idParams{}, errors.New("Unsupported argon2id version")
+	}
+
+	var p argon2idParams
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+	if err != nil {
+		return argon2idParams{}, err
+	}
+
+	p.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2idParams{}, err
+	}
+
+	p.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2idParams{}, err
+	}
+
+	return p, nil
+}
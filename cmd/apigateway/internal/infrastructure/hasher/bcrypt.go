@@ -0,0 +1,57 @@
+package hasher
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with bcrypt (the algorithm and cost are encoded in the hash itself, e.g., $2a$12$...)
+type Bcrypt struct {
+	Cost int
+}
+
+// Hash returns the bcrypt hash of the given password
+func (b *Bcrypt) Hash(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(h), nil
+}
+
+// Verify checks if the given password matches the given bcrypt hash
+func (b *Bcrypt) Verify(encodedHash string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// NeedsRehash checks if the given bcrypt hash was created with a lower cost than the current one
+func (b *Bcrypt) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	if err != nil {
+		return true
+	}
+
+	return cost < b.Cost
+}
+
+// Identifies checks if the given hash was created by bcrypt
+func (b *Bcrypt) Identifies(encodedHash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encodedHash, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package hasher
+
+import (
+	"errors"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
+)
+
+// Algorithm is a password hashing algorithm that can recognize the hashes it encodes
+type Algorithm interface {
+	auth.PasswordHasher
+	Identifies(encodedHash string) bool
+}
+
+// Hasher implements auth.PasswordHasher
+// New hashes are always created with the Preferred algorithm, while existing hashes are verified with whichever of the Algorithms created them
+type Hasher struct {
+	Preferred  Algorithm
+	Algorithms []Algorithm
+}
+
+// New returns a Hasher that prefers the algorithm of the given name ("argon2id" or "bcrypt") and can verify hashes of either
+func New(algorithm string) (*Hasher, error) {
+	a := &Argon2id{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+	b := &Bcrypt{Cost: 12}
+
+	h := Hasher{Algorithms: []Algorithm{a, b}}
+	switch algorithm {
+	case "", "argon2id":
+		h.Preferred = a
+	case "bcrypt":
+		h.Preferred = b
+	default:
+		return nil, errors.New("Unsupported password hashing algorithm: " + algorithm)
+	}
+
+	return &h, nil
+}
+
+// Hash hashes the given password with the preferred algorithm
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.Preferred.Hash(password)
+}
+
+// Verify checks if the given password matches the given encoded hash
+// Legacy plaintext passwords (stored before hashing was introduced) are not accepted; run the hashpasswords command to hash them
+func (h *Hasher) Verify(encodedHash string, password string) (bool, error) {
+	a := h.identify(encodedHash)
+	if a == nil {
+		return false, errors.New("Unrecognized password hash")
+	}
+
+	return a.Verify(encodedHash, password)
+}
+
+// Identifies checks if the given value is a hash created by one of the Algorithms (rather than a legacy plaintext password)
+func (h *Hasher) Identifies(encodedHash string) bool {
+	return h.identify(encodedHash) != nil
+}
+
+// NeedsRehash checks if the given encoded hash was not created by the preferred algorithm with its current parameters
+func (h *Hasher) NeedsRehash(encodedHash string) bool {
+	if !h.Preferred.Identifies(encodedHash) {
+		return true
+	}
+
+	return h.Preferred.NeedsRehash(encodedHash)
+}
+
+func (h *Hasher) identify(encodedHash string) Algorithm {
+	for _, a := range h.Algorithms {
+		if a.Identifies(encodedHash) {
+			return a
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package hasher
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestVerifyAndNeedsRehash checks hashes of each algorithm (with current and outdated parameters) against a Hasher preferring argon2id
+func TestVerifyAndNeedsRehash(t *testing.T) {
+	current := &Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	outdated := &Argon2id{Memory: 512, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	b := &Bcrypt{Cost: bcrypt.MinCost + 1}
+	h := &Hasher{Preferred: current, Algorithms: []Algorithm{current, b}}
+
+	hash := func(a Algorithm) string {
+		encoded, err := a.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return encoded
+	}
+
+	tests := []struct {
+		name        string
+		hash        string
+		password    string
+		valid       bool
+		err         bool
+		needsRehash bool
+	}{
+		{name: "argon2id", hash: hash(current), password: "correct horse", valid: true},
+		{name: "argon2id wrong password", hash: hash(current), password: "battery staple"},
+		{name: "argon2id outdated parameters", hash: hash(outdated), password: "correct horse", valid: true, needsRehash: true},
+		{name: "bcrypt", hash: hash(b), password: "correct horse", valid: true, needsRehash: true},
+		{name: "bcrypt wrong password", hash: hash(b), password: "battery staple", needsRehash: true},
+		{name: "bcrypt lower cost", hash: hash(&Bcrypt{Cost: bcrypt.MinCost}), password: "correct horse", valid: true, needsRehash: true},
+		{name: "malformed argon2id", hash: "$argon2id$v=19$m=1024$salt", password: "correct horse", err: true, needsRehash: true},
+		{name: "plaintext", hash: "correct horse", password: "correct horse", err: true, needsRehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid, err := h.Verify(tt.hash, tt.password)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error: %t", err, tt.err)
+			}
+
+			if valid != tt.valid {
+				t.Errorf("got valid %t, want %t", valid, tt.valid)
+			}
+
+			if got := h.NeedsRehash(tt.hash); got != tt.needsRehash {
+				t.Errorf("got needsRehash %t, want %t", got, tt.needsRehash)
+			}
+		})
+	}
+
+	// a Hasher preferring bcrypt only rehashes bcrypt hashes of a lower cost
+	h.Preferred = b
+	if h.NeedsRehash(hash(b)) || !h.NeedsRehash(hash(&Bcrypt{Cost: bcrypt.MinCost})) || !h.NeedsRehash(hash(current)) {
+		t.Error("bcrypt hashes were not rehashed as expected")
+	}
+}
@@ -0,0 +1,396 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// checkInterval is how often RotateEvery reloads the keys (picking up keys rotated by other instances) and checks if the
+// active key is due to be rotated
+const checkInterval = time.Minute
+
+// minReloadInterval limits how often tokens signed by an unknown key make the key ring reload the keys
+const minReloadInterval = 10 * time.Second
+
+// KeyRing implements auth.KeyRing with an active signing key and the previous keys it replaced
+// The keys are kept in a key store shared by every API Gateway instance, so tokens signed by one instance can be verified by
+// the others (and after a restart). Private keys are encrypted with the EncryptionKey (AES-256-GCM) before they are stored,
+// so that the other services, which can read the key store through the Database Access service, cannot sign tokens.
+// Previous keys are kept for the RetentionPeriod after being rotated out so that tokens they signed can still be verified
+type KeyRing struct {
+	Algorithm       string
+	RetentionPeriod time.Duration
+	Store           auth.KeyStore
+	EncryptionKey   []byte // 32 bytes, only held by the API Gateway
+
+	mu         sync.RWMutex
+	active     activeKey
+	previous   []retiredKey
+	reloadedAt time.Time
+}
+
+type activeKey struct {
+	auth.SigningKey
+	createdAt time.Time
+}
+
+type retiredKey struct {
+	auth.SigningKey
+	retiredAt time.Time
+}
+
+// New returns a KeyRing for the given algorithm ("EdDSA" or "RS256"), loaded from the key store
+// If the key store has no active key yet, the PEM-encoded PKCS #8 private key of privateKeyFile (if given) becomes the
+// active key, or a new key is generated. A new key is also generated if the active key uses another algorithm
+func New(algorithm string, retentionPeriod time.Duration, privateKeyFile string, store auth.KeyStore, encryptionKey []byte) (*KeyRing, error) {
+	if len(encryptionKey) != 32 {
+		return nil, errors.New("JWT key encryption key must be 32 bytes")
+	}
+
+	kr := KeyRing{Algorithm: algorithm, RetentionPeriod: retentionPeriod, Store: store, EncryptionKey: encryptionKey}
+
+	err := kr.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	active := kr.SigningKey()
+	switch {
+	case active.ID == "" && privateKeyFile != "":
+		var k auth.SigningKey
+		k, err = loadKey(privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.Method.Alg() != kr.Algorithm {
+			return nil, errors.New("Private key does not match JWT algorithm " + kr.Algorithm)
+		}
+
+		err = kr.rotateTo(k)
+	case active.ID == "" || active.Method.Alg() != kr.Algorithm:
+		err = kr.Rotate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &kr, nil
+}
+
+// Reload loads the active key and the previous keys that are still within the retention period from the key store
+func (kr *KeyRing) Reload() error {
+	stored, err := kr.Store.FindKeys()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var active activeKey
+	previous := []retiredKey{}
+	for _, s := range stored {
+		k, err := kr.openKey(s)
+		if err != nil {
+			log.Printf("Skipping JWT signing key %s: %s", s.ID, err)
+			continue
+		}
+
+		if s.RetiredAt.IsZero() && active.ID == "" {
+			active = activeKey{k, s.CreatedAt}
+			continue
+		}
+
+		if now.Sub(s.RetiredAt) < kr.retention() {
+			previous = append(previous, retiredKey{k, s.RetiredAt})
+		}
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if active.ID != "" {
+		kr.active = active
+	}
+	kr.previous = previous
+	kr.reloadedAt = now
+
+	return nil
+}
+
+// SigningKey returns the active key
+func (kr *KeyRing) SigningKey() auth.SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	return kr.active.SigningKey
+}
+
+// VerificationKey returns the active or previous key with the given key ID
+// An unknown key may have just been made active by another instance, so the keys are reloaded (at most every minReloadInterval)
+func (kr *KeyRing) VerificationKey(kid string) (auth.SigningKey, bool) {
+	k, ok, reloadedAt := kr.verificationKey(kid)
+	if ok || time.Since(reloadedAt) < minReloadInterval {
+		return k, ok
+	}
+
+	err := kr.Reload()
+	if err != nil {
+		log.Println("Failed to reload JWT signing keys: ", err)
+		return auth.SigningKey{}, false
+	}
+
+	k, ok, _ = kr.verificationKey(kid)
+	return k, ok
+}
+
+func (kr *KeyRing) verificationKey(kid string) (auth.SigningKey, bool, time.Time) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	if kr.active.ID == kid {
+		return kr.active.SigningKey, true, kr.reloadedAt
+	}
+
+	for _, k := range kr.previous {
+		if k.ID == kid {
+			return k.SigningKey, true, kr.reloadedAt
+		}
+	}
+
+	return auth.SigningKey{}, false, kr.reloadedAt
+}
+
+// VerificationKeys returns the active key followed by the previous keys
+func (kr *KeyRing) VerificationKeys() []auth.SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	keys := []auth.SigningKey{kr.active.SigningKey}
+	for _, k := range kr.previous {
+		keys = append(keys, k.SigningKey)
+	}
+
+	return keys
+}
+
+// Rotate generates a new active key and retires the current one (previous keys are dropped once past the retention period)
+func (kr *KeyRing) Rotate() error {
+	k, err := generateKey(kr.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	return kr.rotateTo(k)
+}
+
+// rotateTo makes the given key active in the key store and reloads the keys
+// If another instance rotated the active key first, its key is kept instead
+func (kr *KeyRing) rotateTo(k auth.SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return err
+	}
+
+	kr.mu.RLock()
+	activeID := kr.active.ID
+	kr.mu.RUnlock()
+
+	sealed, err := kr.seal(k.ID, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	next := auth.StoredKey{
+		ID:                  k.ID,
+		Algorithm:           k.Method.Alg(),
+		EncryptedPrivateKey: sealed,
+		CreatedAt:           now,
+	}
+	err = kr.Store.RotateKey(next, activeID, now.Add(kr.retention()))
+	if apperror.Is(err, apperror.Aborted) {
+		log.Println("JWT signing key was already rotated by another instance")
+	} else if err != nil {
+		return err
+	}
+
+	return kr.Reload()
+}
+
+// retention is how long a retired key is kept: the RetentionPeriod, plus the checkInterval during which other instances may
+// still sign tokens with the key before they reload the key ring and pick up the new active key
+func (kr *KeyRing) retention() time.Duration {
+	return kr.RetentionPeriod + checkInterval
+}
+
+// seal encrypts a PEM-encoded private key, prefixing it with the nonce (the key ID is authenticated along with it)
+func (kr *KeyRing) seal(keyID string, privateKey []byte) ([]byte, error) {
+	gcm, err := kr.cipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, privateKey, []byte(keyID)), nil
+}
+
+// openKey decrypts and parses a stored key
+func (kr *KeyRing) openKey(s auth.StoredKey) (auth.SigningKey, error) {
+	gcm, err := kr.cipher()
+	if err != nil {
+		return auth.SigningKey{}, err
+	}
+
+	if len(s.EncryptedPrivateKey) < gcm.NonceSize() {
+		return auth.SigningKey{}, errors.New("Encrypted private key is too short")
+	}
+
+	nonce, sealed := s.EncryptedPrivateKey[:gcm.NonceSize()], s.EncryptedPrivateKey[gcm.NonceSize():]
+	b, err := gcm.Open(nil, nonce, sealed, []byte(s.ID))
+	if err != nil {
+		return auth.SigningKey{}, errors.New("Failed to decrypt private key (was it encrypted with another key?)")
+	}
+
+	return parseKey(b)
+}
+
+func (kr *KeyRing) cipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(kr.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// RotateEvery rotates the key ring once its active key is older than the given interval, until the done channel is closed
+// Every instance checks the shared active key's age, so only one of them rotates it (and the others pick up the new key)
+func (kr *KeyRing) RotateEvery(interval time.Duration, done <-chan struct{}) {
+	every := checkInterval
+	if interval < every {
+		every = interval
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := kr.Reload()
+			if err != nil {
+				log.Println("Failed to reload JWT signing keys: ", err)
+				continue
+			}
+
+			kr.mu.RLock()
+			createdAt := kr.active.createdAt
+			kr.mu.RUnlock()
+
+			if time.Since(createdAt) < interval {
+				continue
+			}
+
+			err = kr.Rotate()
+			if err != nil {
+				log.Println("Failed to rotate JWT signing key: ", err)
+				continue
+			}
+			log.Println("Rotated JWT signing key")
+		case <-done:
+			return
+		}
+	}
+}
+
+func generateKey(algorithm string) (auth.SigningKey, error) {
+	switch algorithm {
+	case "EdDSA":
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return auth.SigningKey{}, err
+		}
+
+		return newSigningKey(auth.SigningMethodEdDSA, priv, pub)
+	case "RS256":
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return auth.SigningKey{}, err
+		}
+
+		return newSigningKey(jwt.SigningMethodRS256, priv, &priv.PublicKey)
+	default:
+		return auth.SigningKey{}, errors.New("Unsupported JWT algorithm: " + algorithm)
+	}
+}
+
+func loadKey(privateKeyFile string) (auth.SigningKey, error) {
+	b, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return auth.SigningKey{}, err
+	}
+
+	return parseKey(b)
+}
+
+// parseKey parses a PEM-encoded PKCS #8 private key
+func parseKey(b []byte) (auth.SigningKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return auth.SigningKey{}, errors.New("Failed to decode PEM private key")
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return auth.SigningKey{}, err
+	}
+
+	switch k := priv.(type) {
+	case ed25519.PrivateKey:
+		return newSigningKey(auth.SigningMethodEdDSA, k, k.Public())
+	case *rsa.PrivateKey:
+		return newSigningKey(jwt.SigningMethodRS256, k, &k.PublicKey)
+	default:
+		return auth.SigningKey{}, errors.New("Unsupported private key type")
+	}
+}
+
+// newSigningKey derives the key ID from the public key so that the same key always has the same ID
+func newSigningKey(method jwt.SigningMethod, priv crypto.PrivateKey, pub crypto.PublicKey) (auth.SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return auth.SigningKey{}, err
+	}
+
+	h := sha256.Sum256(der)
+
+	return auth.SigningKey{
+		ID:      base64.RawURLEncoding.EncodeToString(h[:16]),
+		Method:  method,
+		Private: priv,
+		Public:  pub,
+	}, nil
+}
@@ -0,0 +1,166 @@
+package keyring
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// fakeKeyStore holds the active key first, then the retired keys
+type fakeKeyStore struct {
+	mu   sync.Mutex
+	keys []auth.StoredKey
+}
+
+func (s *fakeKeyStore) FindKeys() ([]auth.StoredKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]auth.StoredKey{}, s.keys...), nil
+}
+
+func (s *fakeKeyStore) RotateKey(next auth.StoredKey, activeKeyID string, retiredKeyExpiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.keys) > 0 && s.keys[0].RetiredAt.IsZero() {
+		if s.keys[0].ID != activeKeyID {
+			return apperror.New(apperror.Aborted, "SIGNING_KEY_ROTATED", "Signing key was already rotated")
+		}
+		s.keys[0].RetiredAt = time.Now()
+	}
+
+	s.keys = append([]auth.StoredKey{next}, s.keys...)
+
+	return nil
+}
+
+// retire moves the retirement of the key with the given ID back by the given duration
+func (s *fakeKeyStore) retire(keyID string, ago time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, k := range s.keys {
+		if k.ID == keyID {
+			s.keys[i].RetiredAt = time.Now().Add(-ago)
+		}
+	}
+}
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// TestRotateAndReload rotates the keys of one instance and checks that another instance sharing the key store picks up
+// the new key, while both keep the retired key for the retention period (plus the check interval)
+func TestRotateAndReload(t *testing.T) {
+	const retention = time.Hour
+
+	tests := []struct {
+		name       string
+		retiredAgo time.Duration
+		kept       bool
+	}{
+		{name: "just retired", retiredAgo: 0, kept: true},
+		{name: "within the retention period", retiredAgo: retention - time.Minute, kept: true},
+		{name: "within the check interval after the retention period", retiredAgo: retention + checkInterval/2, kept: true},
+		{name: "past the retention period and the check interval", retiredAgo: retention + checkInterval + time.Minute, kept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeKeyStore{}
+			kr, err := New("EdDSA", retention, "", store, testEncryptionKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			other, err := New("EdDSA", retention, "", store, testEncryptionKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first := kr.SigningKey()
+			if first.ID == "" || other.SigningKey().ID != first.ID {
+				t.Fatalf("instances do not share the active key: %q and %q", first.ID, other.SigningKey().ID)
+			}
+
+			for _, k := range store.keys {
+				if bytes.Contains(k.EncryptedPrivateKey, []byte("PRIVATE KEY")) {
+					t.Fatal("private key was stored unencrypted")
+				}
+			}
+
+			err = kr.Rotate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			second := kr.SigningKey()
+			if second.ID == first.ID {
+				t.Fatal("active key was not rotated")
+			}
+
+			// the other instance reloads the keys when it sees a token signed by a key it does not know yet
+			other.reloadedAt = time.Now().Add(-minReloadInterval)
+			if _, ok := other.VerificationKey(second.ID); !ok {
+				t.Fatal("other instance did not pick up the new key")
+			}
+
+			store.retire(first.ID, tt.retiredAgo)
+			for _, instance := range []*KeyRing{kr, other} {
+				err = instance.Reload()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, ok := instance.VerificationKey(first.ID); ok != tt.kept {
+					t.Errorf("got retired key kept %t, want %t", ok, tt.kept)
+				}
+
+				if instance.SigningKey().ID != second.ID {
+					t.Error("active key changed on reload")
+				}
+			}
+		})
+	}
+}
+
+// TestOpenKey checks that a stored key can only be decrypted with the encryption key and key ID it was sealed with
+func TestOpenKey(t *testing.T) {
+	store := &fakeKeyStore{}
+	kr, err := New("EdDSA", time.Hour, "", store, testEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := store.keys[0]
+	otherKey := &KeyRing{EncryptionKey: []byte("fedcba9876543210fedcba9876543210")}
+
+	tests := []struct {
+		name string
+		kr   *KeyRing
+		key  auth.StoredKey
+		ok   bool
+	}{
+		{name: "same key", kr: kr, key: stored, ok: true},
+		{name: "other encryption key", kr: otherKey, key: stored},
+		{name: "other key ID", kr: kr, key: auth.StoredKey{ID: "other", EncryptedPrivateKey: stored.EncryptedPrivateKey}},
+		{name: "truncated", kr: kr, key: auth.StoredKey{ID: stored.ID, EncryptedPrivateKey: stored.EncryptedPrivateKey[:4]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := tt.kr.openKey(tt.key)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want ok: %t", err, tt.ok)
+			}
+
+			if tt.ok && k.ID != stored.ID {
+				t.Errorf("got key %s, want %s", k.ID, stored.ID)
+			}
+		})
+	}
+}
@@ -2,11 +2,18 @@ package repository
 
 import (
 	"context"
+	"time"
 
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/token"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/user"
+	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
 	readviewpb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
 )
 
 // UserRepository implements the user repository
@@ -23,9 +30,10 @@ func (ur *UserRepository) FindByID(userID string) (user.User, error) {
 	}
 
 	return user.User{
-		ID:       u.ID,
-		Username: u.Username,
-		Password: u.Password,
+		ID:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    toTime(u.CreatedAt),
 	}, nil
 }
 
@@ -38,9 +46,10 @@ func (ur *UserRepository) FindByUsername(username string) (user.User, error) {
 	}
 
 	return user.User{
-		ID:       u.ID,
-		Username: u.Username,
-		Password: u.Password,
+		ID:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    toTime(u.CreatedAt),
 	}, nil
 }
 
@@ -49,45 +58,72 @@ type TweetRepository struct {
 	readviewpb.ReadViewClient
 }
 
-// FindByUserID fetches tweets of a given user
-func (tr *TweetRepository) FindByUserID(userID string) ([]tweet.Tweet, error) {
-	uid := readviewpb.UserID{UserID: userID}
-	pbtweets, err := tr.ReadViewClient.GetTweets(context.TODO(), &uid)
+// FindByID fetches a tweet (including its revisions) given a tweetID
+func (tr *TweetRepository) FindByID(tweetID string) (tweet.Tweet, error) {
+	t, err := tr.ReadViewClient.GetTweet(context.TODO(), &readviewpb.TweetID{TweetID: tweetID})
 	if err != nil {
-		return []tweet.Tweet{}, err
+		return tweet.Tweet{}, err
+	}
+
+	return toTweet(t), nil
+}
+
+// FindByUserID fetches a page of the tweets of a given user
+func (tr *TweetRepository) FindByUserID(userID string, pageSize int32, pageToken string) ([]tweet.Tweet, string, error) {
+	pp := readviewpb.PageParam{UserID: userID, PageSize: pageSize, PageToken: pageToken}
+	pbtweets, err := tr.ReadViewClient.GetTweets(context.TODO(), &pp)
+	if err != nil {
+		return []tweet.Tweet{}, "", err
 	}
 
 	tweets := []tweet.Tweet{}
 	for _, t := range pbtweets.Tweets {
-		tweets = append(tweets, tweet.Tweet{
-			ID:       t.ID,
-			UserID:   t.UserID,
-			Username: t.Username,
-			Text:     t.Text,
-		})
+		tweets = append(tweets, toTweet(t))
 	}
 
-	return tweets, nil
+	return tweets, pbtweets.NextPageToken, nil
 }
 
-// FindTimelineByUserID fetches the tweets of users followed by a given user
-func (tr *TweetRepository) FindTimelineByUserID(userID string) ([]tweet.Tweet, error) {
-	uid := readviewpb.UserID{UserID: userID}
-	pbtweets, err := tr.ReadViewClient.GetTimeline(context.TODO(), &uid)
+// FindTimelineByUserID fetches a page of the tweets of users followed by a given user
+func (tr *TweetRepository) FindTimelineByUserID(userID string, pageSize int32, pageToken string) ([]tweet.Tweet, string, error) {
+	pp := readviewpb.PageParam{UserID: userID, PageSize: pageSize, PageToken: pageToken}
+	pbtweets, err := tr.ReadViewClient.GetTimeline(context.TODO(), &pp)
 	if err != nil {
-		return []tweet.Tweet{}, err
+		return []tweet.Tweet{}, "", err
 	}
 
 	tweets := []tweet.Tweet{}
 	for _, t := range pbtweets.Tweets {
-		tweets = append(tweets, tweet.Tweet{
-			UserID:   t.UserID,
-			Username: t.Username,
-			Text:     t.Text,
-		})
+		tweets = append(tweets, toTweet(t))
+	}
+
+	return tweets, pbtweets.NextPageToken, nil
+}
+
+func toTweet(t *readviewpb.Tweet) tweet.Tweet {
+	tw := tweet.Tweet{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Username:  t.Username,
+		Text:      t.Text,
+		CreatedAt: toTime(t.CreatedAt),
+		EditedAt:  toTime(t.EditedAt),
+	}
+
+	for _, r := range t.Revisions {
+		tw.Revisions = append(tw.Revisions, tweet.Revision{Text: r.Text, CreatedAt: toTime(r.CreatedAt)})
+	}
+
+	return tw
+}
+
+// toTime converts a protobuf timestamp to a time, converting unset timestamps to the zero time
+func toTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
 	}
 
-	return tweets, nil
+	return ts.AsTime()
 }
 
 // FollowRepository implements the follower repository
@@ -95,44 +131,179 @@ type FollowRepository struct {
 	readviewpb.ReadViewClient
 }
 
-// FindFollowersByUserID fetches the followers of a given user
-func (fr *FollowRepository) FindFollowersByUserID(userID string) ([]follow.Follow, error) {
-	uid := readviewpb.UserID{UserID: userID}
-	pbFollows, err := fr.ReadViewClient.GetFollowers(context.TODO(), &uid)
+// IsFollowing checks if a user follows another user
+func (fr *FollowRepository) IsFollowing(followerUserID string, followeeUserID string) (bool, error) {
+	_, err := fr.ReadViewClient.GetFollow(context.TODO(), &readviewpb.Follow{
+		FollowerUserID: followerUserID,
+		FolloweeUserID: followeeUserID,
+	})
+	if apperror.Is(err, apperror.NotFound) {
+		return false, nil
+	}
+
 	if err != nil {
-		return []follow.Follow{}, err
+		return false, err
+	}
+
+	return true, nil
+}
+
+// FindFollowersByUserID fetches a page of the followers of a given user
+func (fr *FollowRepository) FindFollowersByUserID(userID string, pageSize int32, pageToken string) ([]follow.Follow, string, error) {
+	pp := readviewpb.PageParam{UserID: userID, PageSize: pageSize, PageToken: pageToken}
+	pbFollows, err := fr.ReadViewClient.GetFollowers(context.TODO(), &pp)
+	if err != nil {
+		return []follow.Follow{}, "", err
 	}
 
 	followers := []follow.Follow{}
 	for _, f := range pbFollows.Follows {
-		followers = append(followers, follow.Follow{
-			FollowerUserID:   f.FollowerUserID,
-			FollowerUsername: f.FollowerUsername,
-			FolloweeUserID:   f.FolloweeUserID,
-			FolloweeUsername: f.FolloweeUsername,
-		})
+		followers = append(followers, toFollow(f))
 	}
 
-	return followers, nil
+	return followers, pbFollows.NextPageToken, nil
 }
 
-// FindFolloweesByUserID fetches the followees of a given user (i.e., other users that the user follows)
-func (fr *FollowRepository) FindFolloweesByUserID(userID string) ([]follow.Follow, error) {
-	uid := readviewpb.UserID{UserID: userID}
-	pbFollows, err := fr.ReadViewClient.GetFollowees(context.TODO(), &uid)
+// FindFolloweesByUserID fetches a page of the followees of a given user (i.e., other users that the user follows)
+func (fr *FollowRepository) FindFolloweesByUserID(userID string, pageSize int32, pageToken string) ([]follow.Follow, string, error) {
+	pp := readviewpb.PageParam{UserID: userID, PageSize: pageSize, PageToken: pageToken}
+	pbFollows, err := fr.ReadViewClient.GetFollowees(context.TODO(), &pp)
 	if err != nil {
-		return []follow.Follow{}, err
+		return []follow.Follow{}, "", err
 	}
 
 	followees := []follow.Follow{}
 	for _, f := range pbFollows.Follows {
-		followees = append(followees, follow.Follow{
-			FollowerUserID:   f.FollowerUserID,
-			FollowerUsername: f.FollowerUsername,
-			FolloweeUserID:   f.FolloweeUserID,
-			FolloweeUsername: f.FolloweeUsername,
-		})
+		followees = append(followees, toFollow(f))
+	}
+
+	return followees, pbFollows.NextPageToken, nil
+}
+
+func toFollow(f *readviewpb.Follow) follow.Follow {
+	return follow.Follow{
+		FollowerUserID:   f.FollowerUserID,
+		FollowerUsername: f.FollowerUsername,
+		FolloweeUserID:   f.FolloweeUserID,
+		FolloweeUsername: f.FolloweeUsername,
+		CreatedAt:        toTime(f.CreatedAt),
+	}
+}
+
+// TokenRepository implements the token repository
+type TokenRepository struct {
+	dbaccesspb.DatabaseAccessClient
+}
+
+// SaveRefreshToken stores a new refresh token
+func (tr *TokenRepository) SaveRefreshToken(t token.RefreshToken) error {
+	_, err := tr.DatabaseAccessClient.SaveRefreshToken(context.TODO(), &dbaccesspb.RefreshToken{
+		TokenHash: t.TokenHash,
+		UserID:    t.UserID,
+		Username:  t.Username,
+		FamilyID:  t.FamilyID,
+		ExpiresAt: timestamppb.New(t.ExpiresAt),
+	})
+
+	return err
+}
+
+// FindRefreshToken fetches a refresh token given its hash
+func (tr *TokenRepository) FindRefreshToken(tokenHash string) (token.RefreshToken, error) {
+	t, err := tr.DatabaseAccessClient.GetRefreshToken(context.TODO(), &dbaccesspb.TokenHash{TokenHash: tokenHash})
+	if err != nil {
+		return token.RefreshToken{}, err
+	}
+
+	return toRefreshToken(t), nil
+}
+
+// UseRefreshToken marks a refresh token as used and returns it as it was before being marked
+func (tr *TokenRepository) UseRefreshToken(tokenHash string) (token.RefreshToken, error) {
+	t, err := tr.DatabaseAccessClient.UseRefreshToken(context.TODO(), &dbaccesspb.TokenHash{TokenHash: tokenHash})
+	if err != nil {
+		return token.RefreshToken{}, err
 	}
 
-	return followees, nil
+	return toRefreshToken(t), nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token in the given family
+func (tr *TokenRepository) RevokeRefreshTokenFamily(familyID string) error {
+	_, err := tr.DatabaseAccessClient.RevokeRefreshTokenFamily(context.TODO(), &dbaccesspb.TokenFamilyID{FamilyID: familyID})
+
+	return err
+}
+
+// RevokeAccessToken adds an access token's ID to the revocation list until the token expires
+func (tr *TokenRepository) RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	_, err := tr.DatabaseAccessClient.RevokeAccessToken(context.TODO(), &dbaccesspb.RevokedToken{
+		TokenID:   tokenID,
+		ExpiresAt: timestamppb.New(expiresAt),
+	})
+
+	return err
+}
+
+// IsAccessTokenRevoked checks if an access token's ID is on the revocation list
+func (tr *TokenRepository) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	r, err := tr.DatabaseAccessClient.IsAccessTokenRevoked(context.TODO(), &dbaccesspb.TokenID{TokenID: tokenID})
+	if err != nil {
+		return false, err
+	}
+
+	return r.Revoked, nil
+}
+
+// FindKeys fetches the shared JWT signing keys, active key first
+func (tr *TokenRepository) FindKeys() ([]auth.StoredKey, error) {
+	r, err := tr.DatabaseAccessClient.GetSigningKeys(context.TODO(), &dbaccesspb.GetSigningKeysParam{})
+	if err != nil {
+		return []auth.StoredKey{}, err
+	}
+
+	keys := []auth.StoredKey{}
+	for _, k := range r.Keys {
+		stored := auth.StoredKey{
+			ID:                  k.ID,
+			Algorithm:           k.Algorithm,
+			EncryptedPrivateKey: k.EncryptedPrivateKey,
+			CreatedAt:           k.CreatedAt.AsTime(),
+		}
+		if k.RetiredAt != nil {
+			stored.RetiredAt = k.RetiredAt.AsTime()
+		}
+
+		keys = append(keys, stored)
+	}
+
+	return keys, nil
+}
+
+// RotateKey makes a new JWT signing key active and retires the active one
+func (tr *TokenRepository) RotateKey(next auth.StoredKey, activeKeyID string, retiredKeyExpiresAt time.Time) error {
+	_, err := tr.DatabaseAccessClient.RotateSigningKey(context.TODO(), &dbaccesspb.SigningKeyRotation{
+		Key: &dbaccesspb.SigningKey{
+			ID:                  next.ID,
+			Algorithm:           next.Algorithm,
+			EncryptedPrivateKey: next.EncryptedPrivateKey,
+			CreatedAt:           timestamppb.New(next.CreatedAt),
+		},
+		ActiveKeyID:         activeKeyID,
+		RetiredKeyExpiresAt: timestamppb.New(retiredKeyExpiresAt),
+	})
+
+	return err
+}
+
+func toRefreshToken(t *dbaccesspb.RefreshToken) token.RefreshToken {
+	return token.RefreshToken{
+		TokenHash: t.TokenHash,
+		UserID:    t.UserID,
+		Username:  t.Username,
+		FamilyID:  t.FamilyID,
+		ExpiresAt: t.ExpiresAt.AsTime(),
+		Used:      t.Used,
+		Revoked:   t.Revoked,
+	}
 }
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"context"
+	"encoding/base64"
 	"log"
 	"net"
 	"os"
@@ -13,52 +13,111 @@ import (
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/application"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/domain/auth"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/infrastructure/eventproducer"
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/infrastructure/hasher"
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/infrastructure/keyring"
 	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/infrastructure/repository"
 	pb "github.com/martinmhan/tweet-app-api/cmd/apigateway/proto"
+	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
 	eventproducerpb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
 	readviewpb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/grpcclient"
+	"github.com/martinmhan/tweet-app-api/internal/readiness"
 )
 
 func main() {
 	godotenv.Load()
 
-	jwtKey := os.Getenv("JWT_KEY")
 	port := os.Getenv("AG_PORT")
 	epHost := os.Getenv("EP_HOST")
 	epPort := os.Getenv("EP_PORT")
 	rvHost := os.Getenv("RV_HOST")
 	rvPort := os.Getenv("RV_PORT")
-	if jwtKey == "" || port == "" || epHost == "" || epPort == "" || rvHost == "" || rvPort == "" {
+	daHost := os.Getenv("DA_HOST")
+	daPort := os.Getenv("DA_PORT")
+	pwHashAlgorithm := os.Getenv("PW_HASH_ALGORITHM") // optional, defaults to argon2id
+	jwtAlgorithm := os.Getenv("JWT_ALGORITHM")        // optional, defaults to EdDSA
+	jwtKeyRotation := os.Getenv("JWT_KEY_ROTATION")   // optional, defaults to 24h (0 disables rotation)
+	jwtKeyFile := os.Getenv("JWT_PRIVATE_KEY_FILE")   // optional, the first key if there are no shared keys yet (a key is generated if not provided)
+	jwtKeyEncryptionKey := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	tweetEditWindow := os.Getenv("TWEET_EDIT_WINDOW") // optional, defaults to 30m
+	if port == "" || epHost == "" || epPort == "" || rvHost == "" || rvPort == "" || daHost == "" || daPort == "" || jwtKeyEncryptionKey == "" {
 		log.Fatal("Missing environment variable(s). Please edit .env file")
 	}
 
-	rvTarget := rvHost + ":" + rvPort
-	rvCtx, rvCancel := context.WithTimeout(context.TODO(), 1000*time.Millisecond)
-	defer rvCancel()
+	// the signing keys are stored encrypted with this key, which only the API Gateway holds
+	kek, err := base64.StdEncoding.DecodeString(jwtKeyEncryptionKey)
+	if err != nil || len(kek) != 32 {
+		log.Fatal("Invalid JWT_KEY_ENCRYPTION_KEY: must be 32 base64-encoded bytes")
+	}
 
-	rvConn, err := grpc.DialContext(rvCtx, rvTarget, grpc.WithInsecure(), grpc.WithBlock())
+	ph, err := hasher.New(pwHashAlgorithm)
+	if err != nil {
+		log.Fatal("Failed to create password hasher: ", err)
+	}
+
+	if jwtAlgorithm == "" {
+		jwtAlgorithm = "EdDSA"
+	}
+
+	rotationInterval := 24 * time.Hour
+	if jwtKeyRotation != "" {
+		rotationInterval, err = time.ParseDuration(jwtKeyRotation)
+		if err != nil {
+			log.Fatal("Invalid JWT_KEY_ROTATION: ", err)
+		}
+	}
+
+	editWindow := 30 * time.Minute
+	if tweetEditWindow != "" {
+		editWindow, err = time.ParseDuration(tweetEditWindow)
+		if err != nil {
+			log.Fatal("Invalid TWEET_EDIT_WINDOW: ", err)
+		}
+	}
+
+	rvConn, err := grpcclient.Dial(rvHost + ":" + rvPort)
 	if err != nil {
 		log.Fatal("Failed to connect readview gRPC client")
 	}
 	defer rvConn.Close()
 
-	epTarget := epHost + ":" + epPort
-	epCtx, epCancel := context.WithTimeout(context.TODO(), 1000*time.Millisecond)
-	defer epCancel()
-
-	epConn, err := grpc.DialContext(epCtx, epTarget, grpc.WithInsecure(), grpc.WithBlock())
+	epConn, err := grpcclient.Dial(epHost + ":" + epPort)
 	if err != nil {
 		log.Fatal("Failed to connect eventproducer gRPC client")
 	}
 	defer epConn.Close()
 
+	daConn, err := grpcclient.Dial(daHost + ":" + daPort)
+	if err != nil {
+		log.Fatal("Failed to connect databaseaccess gRPC client")
+	}
+	defer daConn.Close()
+
+	gate := readiness.NewGate(grpcclient.Ready(rvConn), grpcclient.Ready(epConn), grpcclient.Ready(daConn))
+	go gate.Run()
+
 	rvClient := readviewpb.NewReadViewClient(rvConn)
 	epClient := eventproducerpb.NewEventProducerClient(epConn)
+	daClient := dbaccesspb.NewDatabaseAccessClient(daConn)
 
 	ur := repository.UserRepository{ReadViewClient: rvClient}
 	fr := repository.FollowRepository{ReadViewClient: rvClient}
 	tr := repository.TweetRepository{ReadViewClient: rvClient}
-	auth := auth.New(jwtKey, &ur)
+	tkr := repository.TokenRepository{DatabaseAccessClient: daClient}
+
+	// the signing keys are shared with every other API Gateway instance via the Database Access service
+	kr, err := keyring.New(jwtAlgorithm, auth.AccessTokenLifetime, jwtKeyFile, &tkr, kek)
+	if err != nil {
+		log.Fatal("Failed to create JWT key ring: ", err)
+	}
+
+	if rotationInterval > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go kr.RotateEvery(rotationInterval, done)
+	}
+
+	auth := auth.New(kr, &ur, &tkr, ph)
 	ep := eventproducer.EventProducer{EventProducerClient: epClient}
 	s := &application.APIGatewayServer{
 		UserRepository:   &ur,
@@ -66,9 +125,12 @@ func main() {
 		TweetRepository:  &tr,
 		Authorization:    auth,
 		EventProducer:    ep,
+		TweetEditWindow:  editWindow,
 	}
 
-	g := grpc.NewServer()
+	ai := application.AuthInterceptor{Authorization: auth, Policies: application.MethodPolicies}
+	g := grpc.NewServer(grpc.UnaryInterceptor(ai.Unary()), grpc.StreamInterceptor(ai.Stream()))
+	gate.Register(g)
 	pb.RegisterAPIGatewayServer(g, s)
 
 	lis, err := net.Listen("tcp", ":"+port)
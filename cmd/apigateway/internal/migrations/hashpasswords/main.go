@@ -0,0 +1,82 @@
+// Command hashpasswords hashes the legacy plaintext passwords that scripts/db/001-HashPasswords.js left in place
+// It must be run once (after upgrade.sh) before deploying an API Gateway that no longer accepts plaintext passwords
+// Each password is replaced via the Database Access service, so the change is recorded in the event store and reaches the
+// Read View like any other password update. Passwords that are already hashed are skipped, so it is safe to run again
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"github.com/martinmhan/tweet-app-api/cmd/apigateway/internal/infrastructure/hasher"
+	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+	"github.com/martinmhan/tweet-app-api/internal/grpcclient"
+)
+
+func main() {
+	godotenv.Load()
+
+	daHost := os.Getenv("DA_HOST")
+	daPort := os.Getenv("DA_PORT")
+	pwHashAlgorithm := os.Getenv("PW_HASH_ALGORITHM") // optional, defaults to argon2id
+	if daHost == "" || daPort == "" {
+		log.Fatal("Missing environment variable(s). Please edit .env file")
+	}
+
+	ph, err := hasher.New(pwHashAlgorithm)
+	if err != nil {
+		log.Fatal("Failed to create password hasher: ", err)
+	}
+
+	conn, err := grpcclient.Dial(daHost + ":" + daPort)
+	if err != nil {
+		log.Fatal("Failed to connect to Database Access service")
+	}
+	defer conn.Close()
+
+	daClient := dbaccesspb.NewDatabaseAccessClient(conn)
+
+	// the users are all received before any is updated, since updating a user while its stream is open would hold the stream up
+	stream, err := daClient.GetAllUsers(context.TODO(), &dbaccesspb.BulkLoadParam{})
+	if err != nil {
+		log.Fatal("Failed to get users: ", err)
+	}
+
+	plaintext := []*dbaccesspb.User{}
+	for {
+		u, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal("Failed to get users: ", err)
+		}
+
+		if !ph.Identifies(u.PasswordHash) {
+			plaintext = append(plaintext, u)
+		}
+	}
+
+	for _, u := range plaintext {
+		hash, err := ph.Hash(u.PasswordHash)
+		if err != nil {
+			log.Fatalf("Failed to hash password of user %s: %s", u.ID, err)
+		}
+
+		// the event ID marks the UserPasswordUpdated event as made by this command
+		_, err = daClient.UpdateUserPassword(context.TODO(), &dbaccesspb.User{
+			ID:           u.ID,
+			PasswordHash: hash,
+			EventID:      "hashpasswords-" + u.ID,
+		})
+		if err != nil {
+			log.Fatalf("Failed to update password of user %s: %s", u.ID, err)
+		}
+	}
+
+	log.Printf("Hashed %d plaintext password(s)", len(plaintext))
+}
@@ -0,0 +1,55 @@
+package application
+
+import (
+	"strconv"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/outbox"
+	pb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// WatchChanges streams the changes made to users, follows and tweets after the given resume token (or from the start of
+// the outbox if it is empty), in the order they were committed, until the client disconnects
+// A change's resume token is the position of the event it projects, so a client that persists the token of the last change
+// it applied (e.g., the Read View's checkpoint) can pick up where it left off, as long as the changes since are still in the outbox
+func (s *DatabaseAccessServer) WatchChanges(in *pb.WatchChangesParam, stream pb.DatabaseAccess_WatchChangesServer) error {
+	var after int64
+	if in.ResumeToken != "" {
+		var err error
+		after, err = strconv.ParseInt(in.ResumeToken, 10, 64)
+		if err != nil || after < 0 {
+			return apperror.NewInvalidArgument(
+				"INVALID_RESUME_TOKEN",
+				"Invalid ResumeToken",
+				apperror.FieldViolation{Field: "ResumeToken", Description: "must be the resume token of a change"},
+			)
+		}
+	}
+
+	return s.ChangeFeed.Watch(stream.Context(), after, func(c outbox.Change) error {
+		return stream.Send(toPBChangeEvent(c))
+	})
+}
+
+// toPBChangeEvent returns a change as it is streamed by WatchChanges
+func toPBChangeEvent(c outbox.Change) *pb.Change {
+	pbChange := &pb.Change{
+		ResumeToken: strconv.FormatInt(c.Position, 10),
+		Type:        string(c.Type),
+		Position:    c.Position,
+		CreatedAt:   toPBTimestamp(c.CreatedAt),
+	}
+
+	switch payload := toPBChange(c).(type) {
+	case *pb.User:
+		pbChange.User = payload
+	case *pb.Follow:
+		pbChange.Follow = payload
+	case *pb.Tweet:
+		pbChange.Tweet = payload
+	case *pb.TweetDeletion:
+		pbChange.TweetDeletion = payload
+	}
+
+	return pbChange
+}
@@ -0,0 +1,85 @@
+package application
+
+import (
+	"log"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/outbox"
+	pb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+)
+
+const relayBatchSize = 100
+
+// OutboxRelay publishes the changes recorded in the outbox, in the order they were recorded, so that the Read View converges with the database
+// A change is marked as published only after the broker confirms it, so changes are published at least once
+// Without a Publisher (i.e., when every Read View watches the outbox instead), changes are only marked as published, so that they expire
+type OutboxRelay struct {
+	Repository outbox.Repository
+	Publisher  outbox.Publisher // optional
+	Interval   time.Duration
+}
+
+// Run continually publishes unpublished changes, waiting for the interval whenever the outbox is drained (or publishing fails)
+func (r *OutboxRelay) Run() {
+	for {
+		n, err := r.relay()
+		if err != nil {
+			log.Printf("Failed to relay outbox changes: %s", err)
+		}
+
+		if err != nil || n < relayBatchSize {
+			time.Sleep(r.Interval)
+		}
+	}
+}
+
+// relay publishes the next batch of unpublished changes and returns how many were published
+func (r *OutboxRelay) relay() (int, error) {
+	changes, err := r.Repository.FindUnpublished(relayBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, c := range changes {
+		if r.Publisher != nil {
+			err = r.Publisher.Publish(c.ID, c.Type, c.Position, toPBChange(c))
+			if err != nil {
+				return i, err
+			}
+		}
+
+		err = r.Repository.MarkPublished(c.ID)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(changes), nil
+}
+
+// toPBChange returns the payload of a change, i.e., the changed entity as it is returned by the DatabaseAccess service
+func toPBChange(c outbox.Change) interface{} {
+	switch c.Type {
+	case outbox.UserSaved:
+		return &pb.User{
+			ID:           c.User.ID,
+			Username:     c.User.Username,
+			PasswordHash: c.User.PasswordHash,
+			CreatedAt:    toPBTimestamp(c.User.CreatedAt),
+		}
+	case outbox.FollowSaved, outbox.FollowDeleted:
+		return &pb.Follow{
+			FollowerUserID:   c.Follow.FollowerUserID,
+			FollowerUsername: c.Follow.FollowerUsername,
+			FolloweeUserID:   c.Follow.FolloweeUserID,
+			FolloweeUsername: c.Follow.FolloweeUsername,
+			CreatedAt:        toPBTimestamp(c.Follow.CreatedAt),
+		}
+	case outbox.TweetSaved:
+		return toPBTweet(c.Tweet)
+	case outbox.TweetDeleted:
+		return &pb.TweetDeletion{TweetID: c.Tweet.ID, UserID: c.Tweet.UserID}
+	default:
+		return nil
+	}
+}
@@ -2,11 +2,27 @@ package application
 
 import (
 	"context"
+	"time"
 
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/event"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/eventstore"
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/outbox"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/token"
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/user"
 	pb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/pagination"
+)
+
+// getEvents is only used to replay the event store, so its pages are much larger than the API's,
+// as are the batches the getAll* methods fetch from the database at a time
+const (
+	defaultPageSize = 500
+	maxPageSize     = 1000
 )
 
 // DatabaseAccessServer contains the fields and gRPC method implementations used by the DatabaseAccess service
@@ -15,14 +31,18 @@ type DatabaseAccessServer struct {
 	UserRepository   user.Repository
 	FollowRepository follow.Repository
 	TweetRepository  tweet.Repository
+	TokenRepository  token.Repository
+	EventRepository  event.Repository
+	EventStore       eventstore.Repository
+	ChangeFeed       outbox.Feed
 }
 
 // SaveUser adds a user to the database
 func (s *DatabaseAccessServer) SaveUser(ctx context.Context, in *pb.UserConfig) (*pb.InsertID, error) {
-	conf := user.Config{Username: in.Username, Password: in.Password}
+	conf := user.Config{Username: in.Username, PasswordHash: in.PasswordHash, CreatedAt: in.CreatedAt.AsTime(), EventID: in.EventID}
 	i, err := s.UserRepository.Save(conf)
 	if err != nil {
-		return &pb.InsertID{}, err
+		return nil, err
 	}
 
 	return &pb.InsertID{InsertID: string(i)}, nil
@@ -35,37 +55,95 @@ func (s *DatabaseAccessServer) SaveFollow(ctx context.Context, in *pb.Follow) (*
 		FollowerUsername: in.FollowerUsername,
 		FolloweeUserID:   in.FolloweeUserID,
 		FolloweeUsername: in.FolloweeUsername,
+		CreatedAt:        in.CreatedAt.AsTime(),
 	}
-	insertID, err := s.FollowRepository.Save(f)
+	insertID, err := s.FollowRepository.Save(f, in.EventID)
 	if err != nil {
-		return &pb.InsertID{}, err
+		return nil, err
 	}
 
 	return &pb.InsertID{InsertID: insertID}, nil
 }
 
+// DeleteFollow removes a follow (i.e., a unique pair between follower and followee UserIDs) from the database
+func (s *DatabaseAccessServer) DeleteFollow(ctx context.Context, in *pb.Follow) (*pb.SimpleResponse, error) {
+	err := s.FollowRepository.Delete(in.FollowerUserID, in.FolloweeUserID, in.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Follow deleted"}, nil
+}
+
 // SaveTweet adds a tweet to the database
 func (s *DatabaseAccessServer) SaveTweet(ctx context.Context, in *pb.TweetConfig) (*pb.InsertID, error) {
-	conf := tweet.Config{UserID: in.UserID, Username: in.Username, Text: in.Text}
+	conf := tweet.Config{UserID: in.UserID, Username: in.Username, Text: in.Text, CreatedAt: in.CreatedAt.AsTime(), EventID: in.EventID}
 	insertID, err := s.TweetRepository.Save(conf)
 	if err != nil {
-		return &pb.InsertID{}, err
+		return nil, err
 	}
 
 	return &pb.InsertID{InsertID: insertID}, nil
 }
 
+// EditTweet replaces the text of a tweet (keeping its previous text as a revision) and returns the edited tweet
+func (s *DatabaseAccessServer) EditTweet(ctx context.Context, in *pb.TweetEdit) (*pb.Tweet, error) {
+	e := tweet.Edit{TweetID: in.TweetID, UserID: in.UserID, Text: in.Text, EditedAt: in.EditedAt.AsTime(), EventID: in.EventID}
+	t, err := s.TweetRepository.Edit(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBTweet(t), nil
+}
+
+// DeleteTweet (soft) deletes a tweet from the database
+func (s *DatabaseAccessServer) DeleteTweet(ctx context.Context, in *pb.TweetDeletion) (*pb.SimpleResponse, error) {
+	err := s.TweetRepository.Delete(in.TweetID, in.UserID, in.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Tweet deleted"}, nil
+}
+
+// GetTweet gets a tweet (including its revisions) from the database given a TweetID
+func (s *DatabaseAccessServer) GetTweet(ctx context.Context, in *pb.TweetID) (*pb.Tweet, error) {
+	t, err := s.TweetRepository.FindByID(in.TweetID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBTweet(t), nil
+}
+
+// UpdateUserPassword replaces the password hash of the user with the given ID
+func (s *DatabaseAccessServer) UpdateUserPassword(ctx context.Context, in *pb.User) (*pb.User, error) {
+	u, err := s.UserRepository.UpdatePassword(in.ID, in.PasswordHash, in.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.User{
+		ID:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    toPBTimestamp(u.CreatedAt),
+	}, nil
+}
+
 // GetUser gets a user from the database given a UserID
 func (s *DatabaseAccessServer) GetUser(ctx context.Context, in *pb.UserID) (*pb.User, error) {
 	u, err := s.UserRepository.FindByID(in.UserID)
 	if err != nil {
-		return &pb.User{}, err
+		return nil, err
 	}
 
 	return &pb.User{
-		ID:       u.ID,
-		Username: u.Username,
-		Password: u.Password,
+		ID:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    toPBTimestamp(u.CreatedAt),
 	}, nil
 }
 
@@ -73,7 +151,7 @@ func (s *DatabaseAccessServer) GetUser(ctx context.Context, in *pb.UserID) (*pb.
 func (s *DatabaseAccessServer) GetFollowers(ctx context.Context, in *pb.UserID) (*pb.Follows, error) {
 	followers, err := s.FollowRepository.FindFollowersByUserID(in.UserID)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
 	var pbFollows []*pb.Follow
@@ -83,6 +161,7 @@ func (s *DatabaseAccessServer) GetFollowers(ctx context.Context, in *pb.UserID)
 			FollowerUsername: f.FollowerUsername,
 			FolloweeUserID:   f.FolloweeUserID,
 			FolloweeUsername: f.FolloweeUsername,
+			CreatedAt:        toPBTimestamp(f.CreatedAt),
 		})
 	}
 
@@ -93,76 +172,291 @@ func (s *DatabaseAccessServer) GetFollowers(ctx context.Context, in *pb.UserID)
 func (s *DatabaseAccessServer) GetTweets(ctx context.Context, in *pb.UserID) (*pb.Tweets, error) {
 	tweets, err := s.TweetRepository.FindByUserID(in.UserID)
 	if err != nil {
-		return &pb.Tweets{}, err
+		return nil, err
 	}
 
 	var pbTweets []*pb.Tweet
 	for _, t := range tweets {
-		pbTweets = append(pbTweets, &pb.Tweet{
-			ID:       t.ID,
-			UserID:   t.UserID,
-			Username: t.Username,
-			Text:     t.Text,
-		})
+		pbTweets = append(pbTweets, toPBTweet(t))
 	}
 
 	return &pb.Tweets{Tweets: pbTweets}, nil
 }
 
-// GetAllUsers gets all users from the database (only used by the Read View service on cold starts)
-func (s *DatabaseAccessServer) GetAllUsers(ctx context.Context, in *pb.GetAllUsersParam) (*pb.Users, error) {
-	users, err := s.UserRepository.FindAll()
+// GetAllUsers streams all users from the database in ID order, or only those written since UpdatedSince
+// (only used by the Read View service for bulk loads, which resume after the last ID they received if the stream is interrupted)
+func (s *DatabaseAccessServer) GetAllUsers(in *pb.BulkLoadParam, stream pb.DatabaseAccess_GetAllUsersServer) error {
+	return s.UserRepository.Stream(stream.Context(), in.AfterID, updatedSince(in), batchSize(in), func(u user.User) error {
+		return stream.Send(&pb.User{
+			ID:           u.ID,
+			Username:     u.Username,
+			PasswordHash: u.PasswordHash,
+			CreatedAt:    toPBTimestamp(u.CreatedAt),
+		})
+	})
+}
+
+// GetAllFollows streams all follows from the database in ID order, or only those created since UpdatedSince
+// (only used by the Read View service for bulk loads, which resume after the last ID they received if the stream is interrupted)
+func (s *DatabaseAccessServer) GetAllFollows(in *pb.BulkLoadParam, stream pb.DatabaseAccess_GetAllFollowsServer) error {
+	return s.FollowRepository.Stream(stream.Context(), in.AfterID, updatedSince(in), batchSize(in), func(f follow.Follow) error {
+		return stream.Send(&pb.Follow{
+			ID:               f.ID,
+			FollowerUserID:   f.FollowerUserID,
+			FollowerUsername: f.FollowerUsername,
+			FolloweeUserID:   f.FolloweeUserID,
+			FolloweeUsername: f.FolloweeUsername,
+			CreatedAt:        toPBTimestamp(f.CreatedAt),
+		})
+	})
+}
+
+// GetAllTweets streams all (non-deleted) tweets from the database in ID order, or only those written (or deleted) since UpdatedSince
+// (only used by the Read View service for bulk loads, which resume after the last ID they received if the stream is interrupted)
+func (s *DatabaseAccessServer) GetAllTweets(in *pb.BulkLoadParam, stream pb.DatabaseAccess_GetAllTweetsServer) error {
+	return s.TweetRepository.Stream(stream.Context(), in.AfterID, updatedSince(in), batchSize(in), func(t tweet.Tweet) error {
+		return stream.Send(toPBTweet(t))
+	})
+}
+
+func updatedSince(in *pb.BulkLoadParam) time.Time {
+	if in.UpdatedSince == nil {
+		return time.Time{}
+	}
+
+	return in.UpdatedSince.AsTime()
+}
+
+func batchSize(in *pb.BulkLoadParam) int {
+	return pagination.PageSize(in.BatchSize, defaultPageSize, maxPageSize)
+}
+
+// SaveRefreshToken adds a (hashed) refresh token to the database
+func (s *DatabaseAccessServer) SaveRefreshToken(ctx context.Context, in *pb.RefreshToken) (*pb.InsertID, error) {
+	t := token.RefreshToken{
+		TokenHash: in.TokenHash,
+		UserID:    in.UserID,
+		Username:  in.Username,
+		FamilyID:  in.FamilyID,
+		ExpiresAt: in.ExpiresAt.AsTime(),
+	}
+	insertID, err := s.TokenRepository.SaveRefreshToken(t)
 	if err != nil {
-		return &pb.Users{}, err
+		return nil, err
 	}
 
-	var pbUsers []*pb.User
-	for _, u := range users {
-		pbUsers = append(pbUsers, &pb.User{
-			ID:       u.ID,
-			Username: u.Username,
-			Password: u.Password,
-		})
+	return &pb.InsertID{InsertID: insertID}, nil
+}
+
+// GetRefreshToken gets a refresh token from the database given its hash
+func (s *DatabaseAccessServer) GetRefreshToken(ctx context.Context, in *pb.TokenHash) (*pb.RefreshToken, error) {
+	t, err := s.TokenRepository.FindRefreshToken(in.TokenHash)
+	if err != nil {
+		return nil, err
 	}
 
-	return &pb.Users{Users: pbUsers}, nil
+	return toPBRefreshToken(t), nil
 }
 
-// GetAllFollows gets all follows from the database (only used by the Read View service on cold starts)
-func (s *DatabaseAccessServer) GetAllFollows(ctx context.Context, in *pb.GetAllFollowsParam) (*pb.Follows, error) {
-	follows, err := s.FollowRepository.FindAll()
+// UseRefreshToken atomically marks a refresh token as used and returns it as it was before (so callers can detect reuse)
+func (s *DatabaseAccessServer) UseRefreshToken(ctx context.Context, in *pb.TokenHash) (*pb.RefreshToken, error) {
+	t, err := s.TokenRepository.UseRefreshToken(in.TokenHash)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
-	var pbFollows []*pb.Follow
-	for _, f := range follows {
-		pbFollows = append(pbFollows, &pb.Follow{
-			FollowerUserID:   f.FollowerUserID,
-			FollowerUsername: f.FollowerUsername,
-			FolloweeUserID:   f.FolloweeUserID,
+	return toPBRefreshToken(t), nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token in the given family
+func (s *DatabaseAccessServer) RevokeRefreshTokenFamily(ctx context.Context, in *pb.TokenFamilyID) (*pb.SimpleResponse, error) {
+	err := s.TokenRepository.RevokeRefreshTokenFamily(in.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Refresh tokens revoked"}, nil
+}
+
+// RevokeAccessToken adds an access token to the revocation list until it expires
+func (s *DatabaseAccessServer) RevokeAccessToken(ctx context.Context, in *pb.RevokedToken) (*pb.SimpleResponse, error) {
+	err := s.TokenRepository.RevokeAccessToken(token.RevokedToken{TokenID: in.TokenID, ExpiresAt: in.ExpiresAt.AsTime()})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Access token revoked"}, nil
+}
+
+// IsAccessTokenRevoked checks if an access token is on the revocation list
+func (s *DatabaseAccessServer) IsAccessTokenRevoked(ctx context.Context, in *pb.TokenID) (*pb.TokenRevocation, error) {
+	revoked, err := s.TokenRepository.IsAccessTokenRevoked(in.TokenID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.TokenRevocation{Revoked: revoked}, nil
+}
+
+// GetSigningKeys gets the API Gateway's active JWT signing key and the retired keys that can still verify tokens
+func (s *DatabaseAccessServer) GetSigningKeys(ctx context.Context, in *pb.GetSigningKeysParam) (*pb.SigningKeys, error) {
+	keys, err := s.TokenRepository.FindSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	pbKeys := []*pb.SigningKey{}
+	for _, k := range keys {
+		pbKeys = append(pbKeys, &pb.SigningKey{
+			ID:                  k.ID,
+			Algorithm:           k.Algorithm,
+			EncryptedPrivateKey: k.EncryptedPrivateKey,
+			CreatedAt:           toPBTimestamp(k.CreatedAt),
+			RetiredAt:           toPBTimestamp(k.RetiredAt),
 		})
 	}
 
-	return &pb.Follows{Follows: pbFollows}, nil
+	return &pb.SigningKeys{Keys: pbKeys}, nil
 }
 
-// GetAllTweets gets all tweets from the database (only used by the Read View service on cold starts)
-func (s *DatabaseAccessServer) GetAllTweets(ctx context.Context, in *pb.GetAllTweetsParam) (*pb.Tweets, error) {
-	tweets, err := s.TweetRepository.FindAll()
+// RotateSigningKey makes a new JWT signing key active and retires the active one (unless another instance rotated it first)
+func (s *DatabaseAccessServer) RotateSigningKey(ctx context.Context, in *pb.SigningKeyRotation) (*pb.SimpleResponse, error) {
+	if in.Key == nil || in.Key.ID == "" || in.Key.Algorithm == "" || len(in.Key.EncryptedPrivateKey) == 0 {
+		return nil, apperror.NewInvalidArgument(
+			"INVALID_SIGNING_KEY",
+			"Invalid signing key",
+			apperror.FieldViolation{Field: "Key", Description: "must have an ID, algorithm and private key"},
+		)
+	}
+
+	next := token.SigningKey{
+		ID:                  in.Key.ID,
+		Algorithm:           in.Key.Algorithm,
+		EncryptedPrivateKey: in.Key.EncryptedPrivateKey,
+		CreatedAt:           in.Key.CreatedAt.AsTime(),
+	}
+	err := s.TokenRepository.RotateSigningKey(next, in.ActiveKeyID, in.RetiredKeyExpiresAt.AsTime())
 	if err != nil {
-		return &pb.Tweets{}, err
+		return nil, err
 	}
 
-	var pbTweets []*pb.Tweet
-	for _, t := range tweets {
-		pbTweets = append(pbTweets, &pb.Tweet{
-			ID:       t.ID,
-			UserID:   t.UserID,
-			Username: t.Username,
-			Text:     t.Text,
+	return &pb.SimpleResponse{Message: "Signing key rotated"}, nil
+}
+
+// IsEventProcessed checks if the writes of the event with the given ID have already been made
+func (s *DatabaseAccessServer) IsEventProcessed(ctx context.Context, in *pb.EventID) (*pb.EventProcessed, error) {
+	processed, err := s.EventRepository.IsProcessed(in.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.EventProcessed{Processed: processed}, nil
+}
+
+// GetStreamEvents gets every event of a stream (i.e., the history of a user, follow or tweet) from the event store, oldest first
+func (s *DatabaseAccessServer) GetStreamEvents(ctx context.Context, in *pb.StreamID) (*pb.StoredEvents, error) {
+	events, err := s.EventStore.ReadStream(in.StreamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBStoredEvents(events), nil
+}
+
+// GetEvents gets a page of the events recorded after the given position from the event store, in the order they were committed
+// (e.g., to rebuild a projection from the start of the store, or to catch up from the last event it applied)
+func (s *DatabaseAccessServer) GetEvents(ctx context.Context, in *pb.GetEventsParam) (*pb.StoredEvents, error) {
+	size := pagination.PageSize(in.PageSize, defaultPageSize, maxPageSize)
+	events, err := s.EventStore.ReadAll(in.AfterPosition, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBStoredEvents(events), nil
+}
+
+// GetEventStoreHead gets the position of the last event recorded in the event store
+// (e.g., to know which events a load of the current state already includes)
+func (s *DatabaseAccessServer) GetEventStoreHead(ctx context.Context, in *pb.GetEventStoreHeadParam) (*pb.EventStoreHead, error) {
+	position, err := s.EventStore.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.EventStoreHead{Position: position}, nil
+}
+
+func toPBStoredEvents(events []eventstore.Event) *pb.StoredEvents {
+	var pbEvents []*pb.StoredEvent
+	for _, e := range events {
+		pbEvent := &pb.StoredEvent{
+			Position:   e.Position,
+			StreamID:   e.StreamID,
+			Version:    int32(e.Version),
+			Type:       string(e.Type),
+			EventID:    e.EventID,
+			RecordedAt: toPBTimestamp(e.RecordedAt),
+		}
+
+		switch e.Type {
+		case eventstore.UserCreated, eventstore.UserPasswordUpdated:
+			pbEvent.User = &pb.User{ID: e.User.ID, Username: e.User.Username, PasswordHash: e.User.PasswordHash, CreatedAt: toPBTimestamp(e.User.CreatedAt)}
+		case eventstore.FollowCreated, eventstore.FollowDeleted:
+			pbEvent.Follow = &pb.Follow{
+				FollowerUserID:   e.Follow.FollowerUserID,
+				FollowerUsername: e.Follow.FollowerUsername,
+				FolloweeUserID:   e.Follow.FolloweeUserID,
+				FolloweeUsername: e.Follow.FolloweeUsername,
+				CreatedAt:        toPBTimestamp(e.Follow.CreatedAt),
+			}
+		case eventstore.TweetCreated, eventstore.TweetEdited, eventstore.TweetDeleted:
+			pbEvent.Tweet = toPBTweet(e.Tweet)
+		}
+
+		pbEvents = append(pbEvents, pbEvent)
+	}
+
+	return &pb.StoredEvents{Events: pbEvents}
+}
+
+func toPBTweet(t tweet.Tweet) *pb.Tweet {
+	pbTweet := pb.Tweet{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Username:  t.Username,
+		Text:      t.Text,
+		CreatedAt: toPBTimestamp(t.CreatedAt),
+		EditedAt:  toPBTimestamp(t.EditedAt),
+		Deleted:   t.Deleted,
+	}
+
+	for _, r := range t.Revisions {
+		pbTweet.Revisions = append(pbTweet.Revisions, &pb.TweetRevision{
+			Text:      r.Text,
+			CreatedAt: toPBTimestamp(r.CreatedAt),
 		})
 	}
 
-	return &pb.Tweets{Tweets: pbTweets}, nil
+	return &pbTweet
+}
+
+// toPBTimestamp converts a time to a protobuf timestamp, leaving zero times unset
+func toPBTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+func toPBRefreshToken(t token.RefreshToken) *pb.RefreshToken {
+	return &pb.RefreshToken{
+		TokenHash: t.TokenHash,
+		UserID:    t.UserID,
+		Username:  t.Username,
+		FamilyID:  t.FamilyID,
+		ExpiresAt: timestamppb.New(t.ExpiresAt),
+		Used:      t.Used,
+		Revoked:   t.Revoked,
+	}
 }
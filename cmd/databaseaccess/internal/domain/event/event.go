@@ -0,0 +1,7 @@
+package event
+
+// Repository is the processed Event Repository interface
+// Writes made on behalf of an event record the event's ID in the same transaction, so an event that is processed again is skipped
+type Repository interface {
+	IsProcessed(eventID string) (bool, error)
+}
@@ -0,0 +1,77 @@
+package eventstore
+
+import (
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/user"
+)
+
+// Type specifies the type of an event recorded in the event store
+type Type string
+
+const (
+	// UserCreated means a user was created (the event holds the user)
+	UserCreated Type = "UserCreated"
+	// UserPasswordUpdated means a user's password was changed (only the user's ID and password hash are set)
+	UserPasswordUpdated Type = "UserPasswordUpdated"
+	// FollowCreated means a follow was created (the event holds the follow)
+	FollowCreated Type = "FollowCreated"
+	// FollowDeleted means a follow was deleted (only its follower and followee UserIDs are set)
+	FollowDeleted Type = "FollowDeleted"
+	// TweetCreated means a tweet was created (the event holds the tweet, without revisions)
+	TweetCreated Type = "TweetCreated"
+	// TweetEdited means a tweet's text was replaced (only the tweet's ID, UserID, text and EditedAt are set)
+	TweetEdited Type = "TweetEdited"
+	// TweetDeleted means a tweet was deleted (only its ID and UserID are set)
+	TweetDeleted Type = "TweetDeleted"
+)
+
+// Versions a stream can be expected to be at when appending to it, besides a specific version
+const (
+	// AnyVersion appends an event whatever the version of its stream
+	AnyVersion = -1
+	// NoStream only appends an event if its stream does not exist yet (i.e., the event creates its aggregate)
+	NoStream = 0
+)
+
+// An Event is a change to a user, follow or tweet, appended to the stream of the aggregate it belongs to
+// Events are appended in the same transaction as the writes they cause, so the users, followers and tweets collections
+// (and, through the outbox, the Read View) are projections of the event store that can be rebuilt by replaying it
+// Only the entity matching the event's type is set
+type Event struct {
+	Position   int64 // the event's position across every stream, starting at 1 (in the order the events were committed)
+	StreamID   string
+	Version    int // the event's position in its stream, starting at 1
+	Type       Type
+	EventID    string // the ID (or idempotency key) of the message the event was recorded for, if any
+	User       user.User
+	Follow     follow.Follow
+	Tweet      tweet.Tweet
+	RecordedAt time.Time
+}
+
+// UserStream returns the ID of a user's stream
+func UserStream(userID string) string {
+	return "user-" + userID
+}
+
+// TweetStream returns the ID of a tweet's stream
+func TweetStream(tweetID string) string {
+	return "tweet-" + tweetID
+}
+
+// FollowStream returns the ID of the stream of the follows between a follower and a followee
+// (the same stream holds every time the follower follows and unfollows the followee)
+func FollowStream(followerUserID string, followeeUserID string) string {
+	return "follow-" + followerUserID + "-" + followeeUserID
+}
+
+// Repository is the Event Store Repository interface
+// Events are appended by the writes of the other repositories, so the event store itself is read-only
+type Repository interface {
+	Head() (int64, error)
+	ReadStream(streamID string) ([]Event, error)
+	ReadAll(afterPosition int64, limit int) ([]Event, error)
+}
@@ -1,17 +1,25 @@
 package follow
 
+import (
+	"context"
+	"time"
+)
+
 // A Follow represents a unique follower/followee relationship between two users
 type Follow struct {
+	ID               string
 	FollowerUserID   string
 	FollowerUsername string
 	FolloweeUserID   string
 	FolloweeUsername string
+	CreatedAt        time.Time
 }
 
 // Repository is the FollowRepository interface
 type Repository interface {
-	Save(Follow) (insertID string, err error)
+	Save(f Follow, eventID string) (insertID string, err error)
+	Delete(followerUserID string, followeeUserID string, eventID string) error
 	FindFollowersByUserID(userID string) ([]Follow, error)
 	FindFolloweesByUserID(userID string) ([]Follow, error)
-	FindAll() ([]Follow, error)
+	Stream(ctx context.Context, afterID string, updatedSince time.Time, batchSize int, fn func(Follow) error) error
 }
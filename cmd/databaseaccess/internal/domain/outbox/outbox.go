@@ -0,0 +1,57 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/user"
+)
+
+// Type specifies the type of change recorded in the outbox
+type Type string
+
+const (
+	// UserSaved means a user was created or updated (the change holds the user as it was saved)
+	UserSaved Type = "UserSaved"
+	// FollowSaved means a follow was created
+	FollowSaved Type = "FollowSaved"
+	// FollowDeleted means a follow was deleted (only its follower and followee UserIDs are set)
+	FollowDeleted Type = "FollowDeleted"
+	// TweetSaved means a tweet was created or edited (the change holds the tweet, including its revisions, as it was saved)
+	TweetSaved Type = "TweetSaved"
+	// TweetDeleted means a tweet was deleted (only its ID and UserID are set)
+	TweetDeleted Type = "TweetDeleted"
+)
+
+// A Change is a change to a user, follow or tweet, recorded in the outbox in the same transaction as the change itself
+// Only the entity matching the change's type is set
+// Position is the position of the event the change projects in the event store (0 for changes recorded before the event store)
+type Change struct {
+	ID        string
+	Type      Type
+	Position  int64
+	User      user.User
+	Follow    follow.Follow
+	Tweet     tweet.Tweet
+	CreatedAt time.Time
+}
+
+// Repository is the Outbox Repository interface
+type Repository interface {
+	FindUnpublished(limit int) ([]Change, error)
+	MarkPublished(changeID string) error
+}
+
+// Feed streams the changes recorded after a position (i.e., of the changes with an event store position), in position order,
+// until the context is done or fn fails. Every event projects exactly one change, so positions are gap-free: a feed that cannot
+// deliver the change right after the given position (because it has expired from the outbox) fails with a NotFound error
+type Feed interface {
+	Watch(ctx context.Context, afterPosition int64, fn func(Change) error) error
+}
+
+// Publisher publishes changes (e.g., to the message queue consumed by the Read View service)
+type Publisher interface {
+	Publish(changeID string, t Type, position int64, payload interface{}) error
+}
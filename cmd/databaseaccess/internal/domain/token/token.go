@@ -0,0 +1,43 @@
+package token
+
+import "time"
+
+// A RefreshToken represents a stored (hashed) refresh token issued by the API Gateway
+type RefreshToken struct {
+	TokenHash string
+	UserID    string
+	Username  string
+	FamilyID  string
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// A RevokedToken represents an access token that has been revoked before its expiration
+type RevokedToken struct {
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// A SigningKey is a JWT signing key shared by every API Gateway instance
+// Only one key is active (i.e., not retired) at a time; retired keys are removed once ExpiresAt has passed
+type SigningKey struct {
+	ID                  string
+	Algorithm           string
+	EncryptedPrivateKey []byte // sealed by the API Gateway, which is the only service holding the key it is encrypted with
+	CreatedAt           time.Time
+	RetiredAt           time.Time
+}
+
+// Repository is the Token Repository interface
+// RotateSigningKey makes a new key active and retires the active key, failing with an Aborted error if activeKeyID is not the active key
+type Repository interface {
+	SaveRefreshToken(RefreshToken) (insertID string, err error)
+	FindRefreshToken(tokenHash string) (RefreshToken, error)
+	UseRefreshToken(tokenHash string) (RefreshToken, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeAccessToken(RevokedToken) error
+	IsAccessTokenRevoked(tokenID string) (bool, error)
+	FindSigningKeys() ([]SigningKey, error)
+	RotateSigningKey(next SigningKey, activeKeyID string, retiredKeyExpiresAt time.Time) error
+}
@@ -1,23 +1,52 @@
 package tweet
 
+import (
+	"context"
+	"time"
+)
+
 // Config contains the fields necessary to create a tweet
 type Config struct {
-	UserID   string
-	Username string
-	Text     string
+	UserID    string
+	Username  string
+	Text      string
+	CreatedAt time.Time
+	EventID   string
 }
 
 // Tweet represents an existing tweet
 type Tweet struct {
-	ID       string
+	ID        string
+	UserID    string
+	Username  string
+	Text      string
+	CreatedAt time.Time
+	EditedAt  time.Time
+	Revisions []Revision
+	Deleted   bool // only set for tweets streamed with updatedSince, since deleted tweets are otherwise never returned
+}
+
+// A Revision is a previous version of a tweet's text, along with when that version was written
+type Revision struct {
+	Text      string
+	CreatedAt time.Time
+}
+
+// Edit contains the fields necessary to edit a tweet
+type Edit struct {
+	TweetID  string
 	UserID   string
-	Username string
 	Text     string
+	EditedAt time.Time
+	EventID  string
 }
 
 // Repository is the Tweet Repository interface
 type Repository interface {
 	Save(Config) (insertID string, err error)
+	Edit(Edit) (Tweet, error)
+	Delete(tweetID string, userID string, eventID string) error
+	FindByID(tweetID string) (Tweet, error)
 	FindByUserID(userID string) ([]Tweet, error)
-	FindAll() ([]Tweet, error)
+	Stream(ctx context.Context, afterID string, updatedSince time.Time, batchSize int, fn func(Tweet) error) error
 }
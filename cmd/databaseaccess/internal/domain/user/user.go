@@ -1,21 +1,30 @@
 package user
 
+import (
+	"context"
+	"time"
+)
+
 // User represent an existing user
 type User struct {
-	ID       string
-	Username string
-	Password string
+	ID           string
+	Username     string
+	PasswordHash string
+	CreatedAt    time.Time
 }
 
 // Config contains the fields necessary to create a user
 type Config struct {
-	Username string
-	Password string
+	Username     string
+	PasswordHash string
+	CreatedAt    time.Time
+	EventID      string
 }
 
 // Repository is the User Repository interface
 type Repository interface {
 	Save(Config) (insertID string, err error)
+	UpdatePassword(userID string, passwordHash string, eventID string) (User, error)
 	FindByID(userID string) (User, error)
-	FindAll() ([]User, error)
+	Stream(ctx context.Context, afterID string, updatedSince time.Time, batchSize int, fn func(User) error) error
 }
@@ -0,0 +1,82 @@
+package changepublisher
+
+import (
+	"time"
+
+	"github.com/streadway/amqp"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/outbox"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker/rabbitmq"
+)
+
+// ChangePublisher publishes changes to a durable fanout exchange, which every Read View instance binds a queue to
+type ChangePublisher struct {
+	ExchangeName   string
+	Connection     *rabbitmq.Supervisor
+	ConfirmTimeout time.Duration // optional, defaults to rabbitmq.DefaultConfirmTimeout
+}
+
+// PositionHeader holds the event store position of the event a change projects (it is not set on changes recorded before the event store)
+const PositionHeader = "x-event-position"
+
+// Publish publishes a change as a persistent message and waits (up to ConfirmTimeout) for the broker to confirm it
+// The message ID is the change ID, so that consumers can tell a republished change apart
+func (p *ChangePublisher) Publish(changeID string, t outbox.Type, position int64, payload interface{}) error {
+	msg, ok := payload.(proto.Message)
+	if !ok {
+		return apperror.New(apperror.Internal, "INVALID_CHANGE_PAYLOAD", "Change payload is not a protobuf message")
+	}
+
+	body, err := protojson.Marshal(msg)
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, "INVALID_CHANGE_PAYLOAD", "Failed to marshal change payload", err)
+	}
+
+	ch, err := p.Connection.Channel()
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to open message queue channel", err)
+	}
+
+	defer ch.Close()
+
+	err = ch.ExchangeDeclare(p.ExchangeName, "fanout", true, false, false, false, nil)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to declare change exchange", err)
+	}
+
+	err = ch.Confirm(false)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to put channel in confirm mode", err)
+	}
+
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	headers := amqp.Table{}
+	if position > 0 {
+		headers[PositionHeader] = position
+	}
+
+	err = ch.Publish(
+		p.ExchangeName,
+		"",
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			Type:         string(t),
+			MessageId:    changeID,
+			Headers:      headers,
+			Body:         body,
+			DeliveryMode: amqp.Persistent,
+		},
+	)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to publish change", err)
+	}
+
+	// changes are not mandatory, since the exchange has no queues bound while no Read View consumes it (e.g., RV_CHANGE_FEED=watch)
+	return rabbitmq.AwaitConfirm(confirms, nil, p.ConfirmTimeout)
+}
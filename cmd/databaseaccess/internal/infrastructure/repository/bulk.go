@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// bulkFilter restricts a filter to the documents after the given _id (so an interrupted bulk load can resume after the last
+// document it received) and, if updatedSince is set, to the documents written at or after it
+func bulkFilter(f bson.M, afterID string, updatedSince time.Time) (bson.M, error) {
+	if afterID != "" {
+		_id, err := primitive.ObjectIDFromHex(afterID)
+		if err != nil {
+			return nil, invalidIDError("AfterID", err)
+		}
+
+		f["_id"] = bson.M{"$gt": _id}
+	}
+
+	if !updatedSince.IsZero() {
+		f["updatedAt"] = bson.M{"$gte": updatedSince}
+	}
+
+	return f, nil
+}
+
+// bulkOptions sorts documents by _id (i.e., the order bulk loads resume in) and sets how many documents each round trip
+// to the database fetches, so a bulk load only ever holds one batch in memory
+func bulkOptions(batchSize int) *options.FindOptions {
+	return options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetBatchSize(int32(batchSize))
+}
+
+// each iterates a cursor over documents of the given entity, passing each document to fn
+// It stops at the first error fn returns, which it returns as it is
+func each(ctx context.Context, cursor *mongo.Cursor, entity string, fn func(r bson.M) error) error {
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var r bson.M
+		err := cursor.Decode(&r)
+		if err != nil {
+			return dbError(err, entity)
+		}
+
+		err = fn(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return dbError(cursor.Err(), entity)
+}
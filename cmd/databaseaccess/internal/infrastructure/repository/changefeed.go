@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/outbox"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+const feedBatchSize = 100
+
+// changeStreamsUnsupported is the error code of opening a change stream where change streams are not available
+const changeStreamsUnsupported = 40573
+
+// ChangeFeed implements the outbox Feed with a MongoDB change stream on the outbox, or, where change streams are not available
+// (e.g., a MongoDB-compatible database with change streams disabled), by polling the outbox for changes with a later position at every interval
+// A standalone mongod cannot use the fallback: it does not support the transactions every write is made in, so it cannot be used at all
+type ChangeFeed struct {
+	Database     *mongo.Database
+	PollInterval time.Duration
+}
+
+// Watch streams the changes recorded after the given position
+// The change stream is opened before the changes already recorded are read, so that no change recorded in between is missed
+// (the ones read both ways are only delivered once). Change streams deliver changes in commit order, which is position order
+// since positions are taken from a counter that every write transaction updates
+func (cf *ChangeFeed) Watch(ctx context.Context, afterPosition int64, fn func(outbox.Change) error) error {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": "insert"}}}}
+	stream, err := cf.Database.Collection("outbox").Watch(ctx, pipeline)
+
+	var ce mongo.CommandError
+	if errors.As(err, &ce) && ce.Code == changeStreamsUnsupported {
+		log.Println("Change streams are not supported by the database, polling the outbox for changes instead")
+		return cf.poll(ctx, afterPosition, fn)
+	}
+	if err != nil {
+		return dbError(err, "outbox change")
+	}
+
+	defer stream.Close(ctx)
+
+	after, err := cf.catchUp(ctx, afterPosition, fn)
+	if err != nil {
+		return err
+	}
+
+	for stream.Next(ctx) {
+		var ev struct {
+			FullDocument bson.M `bson:"fullDocument"`
+		}
+		err := stream.Decode(&ev)
+		if err != nil {
+			return dbError(err, "outbox change")
+		}
+
+		c := toChange(ev.FullDocument)
+		if c.Position > after+1 {
+			// the changes in between have not been delivered yet (e.g., the stream lagged behind the catch-up), so read them
+			after, err = cf.catchUp(ctx, after, fn)
+			if err != nil {
+				return err
+			}
+		}
+
+		// changes without a position were recorded before the event store, and changes at or before after were already delivered
+		if c.Position <= after {
+			continue
+		}
+
+		err = fn(c)
+		if err != nil {
+			return err
+		}
+		after = c.Position
+	}
+
+	return dbError(stream.Err(), "outbox change")
+}
+
+// poll catches up at every interval until the context is done
+func (cf *ChangeFeed) poll(ctx context.Context, afterPosition int64, fn func(outbox.Change) error) error {
+	after := afterPosition
+	for {
+		var err error
+		after, err = cf.catchUp(ctx, after, fn)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cf.PollInterval):
+		}
+	}
+}
+
+// catchUp delivers the changes recorded after the given position, up to the last one, and returns the position of the last one delivered
+func (cf *ChangeFeed) catchUp(ctx context.Context, afterPosition int64, fn func(outbox.Change) error) (int64, error) {
+	after := afterPosition
+	for {
+		f := bson.M{"position": bson.M{"$gt": after}}
+		opts := options.Find().SetSort(bson.D{{Key: "position", Value: 1}}).SetLimit(feedBatchSize)
+		cursor, err := cf.Database.Collection("outbox").Find(ctx, f, opts)
+		if err != nil {
+			return after, dbError(err, "outbox change")
+		}
+
+		n := 0
+		err = each(ctx, cursor, "outbox change", func(r bson.M) error {
+			c := toChange(r)
+			if c.Position != after+1 {
+				return apperror.NewNotFound("RESUME_TOKEN_EXPIRED", "The changes after the resume token are no longer in the outbox")
+			}
+
+			err := fn(c)
+			if err != nil {
+				return err
+			}
+
+			after = c.Position
+			n++
+			return nil
+		})
+		if err != nil {
+			return after, err
+		}
+
+		if n < feedBatchSize {
+			return after, nil
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// dbError converts an error returned by the MongoDB driver into a domain error about the given entity (e.g., "user" or "refresh token")
+func dbError(err error, entity string) error {
+	if err == nil {
+		return nil
+	}
+
+	reason := strings.ToUpper(strings.ReplaceAll(entity, " ", "_"))
+	name := strings.ToUpper(entity[:1]) + entity[1:]
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return apperror.Wrap(apperror.NotFound, reason+"_NOT_FOUND", name+" not found", err)
+	case mongo.IsDuplicateKeyError(err):
+		return apperror.Wrap(apperror.AlreadyExists, reason+"_ALREADY_EXISTS", name+" already exists", err)
+	case mongo.IsTimeout(err) || mongo.IsNetworkError(err):
+		return apperror.NewUnavailable("DATABASE_UNAVAILABLE", "Failed to reach the database", err)
+	default:
+		// the driver's error can reveal details of the database, so it is only logged
+		log.Printf("Database error on %s: %s", entity, err)
+		return apperror.Wrap(apperror.Internal, "DATABASE_ERROR", "Failed to access the database", err)
+	}
+}
+
+// invalidIDError is returned when an ID is not a valid ObjectID
+func invalidIDError(field string, err error) error {
+	e := apperror.NewInvalidArgument(
+		"INVALID_ID",
+		"Invalid "+field,
+		apperror.FieldViolation{Field: field, Description: "must be a 24 character hex string"},
+	)
+	e.Err = err
+
+	return e
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// recordEvent records that an event was processed (it must be called within the transaction that makes the event's writes)
+// If the event was already processed, the error aborts the transaction so that the writes are not made twice
+// Writes that are not made on behalf of an event (i.e., with no event ID) are not recorded
+func recordEvent(ctx mongo.SessionContext, db *mongo.Database, eventID string) error {
+	if eventID == "" {
+		return nil
+	}
+
+	insert := bson.M{"_id": eventID, "processedAt": time.Now()}
+	_, err := db.Collection("processedEvents").InsertOne(ctx, insert)
+	if mongo.IsDuplicateKeyError(err) {
+		return apperror.Wrap(apperror.AlreadyExists, "EVENT_ALREADY_PROCESSED", "Event already processed", err)
+	}
+
+	return dbError(err, "processed event")
+}
+
+// EventRepository implements the processed Event Repository
+type EventRepository struct {
+	Database *mongo.Database
+}
+
+// IsProcessed checks if an event with the given ID was processed (processed events are removed by a TTL index after 30 days)
+func (er *EventRepository) IsProcessed(eventID string) (bool, error) {
+	f := bson.M{"_id": eventID}
+	count, err := er.Database.Collection("processedEvents").CountDocuments(context.TODO(), f)
+	if err != nil {
+		return false, dbError(err, "processed event")
+	}
+
+	return count > 0, nil
+}
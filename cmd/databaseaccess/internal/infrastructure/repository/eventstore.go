@@ -0,0 +1,437 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/eventstore"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/outbox"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// record appends an event to its stream and applies it to the projections (recording the change in the outbox), returning the record it wrote
+// (it must be called within the transaction that makes the event's writes, so that a failed write also undoes the append)
+func record(ctx mongo.SessionContext, db *mongo.Database, e eventstore.Event, expectedVersion int) (bson.M, error) {
+	e, err := appendEvent(ctx, db, e, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	r, t, err := project(ctx, db, e)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, recordChange(ctx, db, t, r, e.Position)
+}
+
+// appendEvent appends an event to its stream at the stream's next version and at the store's next position
+// Appends are optimistic: if the stream is not at the expected version, or another transaction appends to it first
+// (which the unique index on streamID and version catches), the append fails with STREAM_VERSION_CONFLICT
+// Every append increments the same position counter, so concurrent transactions conflict and are retried by transact,
+// which keeps positions in the order events were committed (so readers of the store never skip an event that commits late)
+func appendEvent(ctx mongo.SessionContext, db *mongo.Database, e eventstore.Event, expectedVersion int) (eventstore.Event, error) {
+	version, err := streamVersion(ctx, db, e.StreamID)
+	if err != nil {
+		return e, err
+	}
+
+	if expectedVersion != eventstore.AnyVersion && version != expectedVersion {
+		return e, streamVersionConflict(e.StreamID, nil)
+	}
+
+	counter := bson.M{}
+	f := bson.M{"_id": "events"}
+	u := bson.M{"$inc": bson.M{"position": int64(1)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err = db.Collection("counters").FindOneAndUpdate(ctx, f, u, opts).Decode(&counter)
+	if err != nil {
+		return e, dbError(err, "event")
+	}
+
+	e.Position = int64Field(counter, "position")
+	e.Version = version + 1
+	e.RecordedAt = time.Now()
+
+	_, err = db.Collection("events").InsertOne(ctx, toEventRecord(e))
+	if mongo.IsDuplicateKeyError(err) {
+		return e, streamVersionConflict(e.StreamID, err)
+	}
+
+	return e, dbError(err, "event")
+}
+
+func streamVersion(ctx context.Context, db *mongo.Database, streamID string) (int, error) {
+	head := bson.M{}
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := db.Collection("events").FindOne(ctx, bson.M{"streamID": streamID}, opts).Decode(&head)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, dbError(err, "event")
+	}
+
+	return int(int64Field(head, "version")), nil
+}
+
+func streamVersionConflict(streamID string, err error) error {
+	return apperror.Wrap(apperror.Aborted, "STREAM_VERSION_CONFLICT", fmt.Sprintf("Stream %s was appended to concurrently", streamID), err)
+}
+
+// project applies an event to the collection of its aggregate, returning the record it wrote and the type of change it made
+// The write depends only on the event, so replaying the event store from the start rebuilds the collections (see RebuildProjections)
+func project(ctx mongo.SessionContext, db *mongo.Database, e eventstore.Event) (bson.M, outbox.Type, error) {
+	switch e.Type {
+	case eventstore.UserCreated:
+		_id, err := primitive.ObjectIDFromHex(e.User.ID)
+		if err != nil {
+			return nil, "", invalidIDError("UserID", err)
+		}
+
+		insert := bson.M{
+			"_id":          _id,
+			"username":     e.User.Username,
+			"passwordHash": e.User.PasswordHash,
+			"createdAt":    e.User.CreatedAt,
+			"updatedAt":    e.RecordedAt,
+		}
+		_, err = db.Collection("users").InsertOne(ctx, insert)
+		if err != nil {
+			return nil, "", dbError(err, "user")
+		}
+
+		return insert, outbox.UserSaved, nil
+	case eventstore.UserPasswordUpdated:
+		_id, err := primitive.ObjectIDFromHex(e.User.ID)
+		if err != nil {
+			return nil, "", invalidIDError("UserID", err)
+		}
+
+		record := bson.M{}
+		f := bson.M{"_id": _id}
+		u := bson.M{"$set": bson.M{"passwordHash": e.User.PasswordHash, "updatedAt": e.RecordedAt}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err = db.Collection("users").FindOneAndUpdate(ctx, f, u, opts).Decode(&record)
+		if err != nil {
+			return nil, "", dbError(err, "user")
+		}
+
+		return record, outbox.UserSaved, nil
+	case eventstore.FollowCreated:
+		_id, err := primitive.ObjectIDFromHex(e.Follow.ID)
+		if err != nil {
+			return nil, "", invalidIDError("FollowID", err)
+		}
+
+		insert := bson.M{
+			"_id":              _id,
+			"followerUserID":   e.Follow.FollowerUserID,
+			"followerUsername": e.Follow.FollowerUsername,
+			"followeeUserID":   e.Follow.FolloweeUserID,
+			"followeeUsername": e.Follow.FolloweeUsername,
+			"createdAt":        e.Follow.CreatedAt,
+			"updatedAt":        e.RecordedAt,
+		}
+		_, err = db.Collection("followers").InsertOne(ctx, insert)
+		if err != nil {
+			return nil, "", dbError(err, "follow")
+		}
+
+		return insert, outbox.FollowSaved, nil
+	case eventstore.FollowDeleted:
+		f := bson.M{"followerUserID": e.Follow.FollowerUserID, "followeeUserID": e.Follow.FolloweeUserID}
+		res, err := db.Collection("followers").DeleteMany(ctx, f)
+		if err != nil {
+			return nil, "", dbError(err, "follow")
+		}
+
+		if res.DeletedCount == 0 {
+			return nil, "", apperror.NewNotFound("FOLLOW_NOT_FOUND", "Follow not found")
+		}
+
+		return f, outbox.FollowDeleted, nil
+	case eventstore.TweetCreated:
+		_id, err := primitive.ObjectIDFromHex(e.Tweet.ID)
+		if err != nil {
+			return nil, "", invalidIDError("TweetID", err)
+		}
+
+		insert := bson.M{
+			"_id":       _id,
+			"userID":    e.Tweet.UserID,
+			"username":  e.Tweet.Username,
+			"text":      e.Tweet.Text,
+			"createdAt": e.Tweet.CreatedAt,
+			"updatedAt": e.RecordedAt,
+			"deleted":   false,
+			"revisions": bson.A{},
+		}
+		_, err = db.Collection("tweets").InsertOne(ctx, insert)
+		if err != nil {
+			return nil, "", dbError(err, "tweet")
+		}
+
+		return insert, outbox.TweetSaved, nil
+	case eventstore.TweetEdited:
+		return projectTweetEdit(ctx, db, e)
+	case eventstore.TweetDeleted:
+		_id, err := primitive.ObjectIDFromHex(e.Tweet.ID)
+		if err != nil {
+			return nil, "", invalidIDError("TweetID", err)
+		}
+
+		f := bson.M{"_id": _id, "userID": e.Tweet.UserID, "deleted": bson.M{"$ne": true}}
+		u := bson.M{"$set": bson.M{"deleted": true, "deletedAt": e.RecordedAt, "updatedAt": e.RecordedAt}}
+		res, err := db.Collection("tweets").UpdateOne(ctx, f, u)
+		if err != nil {
+			return nil, "", dbError(err, "tweet")
+		}
+
+		if res.MatchedCount == 0 {
+			return nil, "", apperror.NewNotFound("TWEET_NOT_FOUND", "Tweet not found")
+		}
+
+		deleted := bson.M{"_id": _id, "userID": e.Tweet.UserID}
+		return deleted, outbox.TweetDeleted, nil
+	default:
+		return nil, "", apperror.New(apperror.Internal, "INVALID_EVENT_TYPE", "Invalid event type: "+string(e.Type))
+	}
+}
+
+// projectTweetEdit replaces the text of a (non-deleted) tweet owned by the edit's user and appends its previous text to its revisions
+func projectTweetEdit(ctx mongo.SessionContext, db *mongo.Database, e eventstore.Event) (bson.M, outbox.Type, error) {
+	t := e.Tweet
+	_id, err := primitive.ObjectIDFromHex(t.ID)
+	if err != nil {
+		return nil, "", invalidIDError("TweetID", err)
+	}
+
+	// the update is a pipeline so that the previous text is moved to the revisions atomically
+	// expressions in a $set stage refer to the document as it was before the stage, and $literal keeps user text from being parsed as an expression
+	f := bson.M{"_id": _id, "userID": t.UserID, "deleted": bson.M{"$ne": true}}
+	u := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"revisions": bson.M{"$concatArrays": bson.A{
+				bson.M{"$ifNull": bson.A{"$revisions", bson.A{}}},
+				bson.A{bson.M{"text": "$text", "createdAt": bson.M{"$ifNull": bson.A{"$editedAt", "$createdAt"}}}},
+			}},
+			"text":      bson.M{"$literal": t.Text},
+			"editedAt":  t.EditedAt,
+			"updatedAt": e.RecordedAt,
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	record := bson.M{}
+	err = db.Collection("tweets").FindOneAndUpdate(ctx, f, u, opts).Decode(&record)
+	if err != nil {
+		return nil, "", dbError(err, "tweet")
+	}
+
+	return record, outbox.TweetSaved, nil
+}
+
+// EventStoreRepository implements the Event Store Repository
+type EventStoreRepository struct {
+	Database *mongo.Database
+}
+
+// ReadStream fetches every event of a stream, oldest first
+func (esr *EventStoreRepository) ReadStream(streamID string) ([]eventstore.Event, error) {
+	f := bson.M{"streamID": streamID}
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+
+	return esr.find(f, opts)
+}
+
+// Head returns the position of the last event recorded in the store (0 if the store is empty)
+func (esr *EventStoreRepository) Head() (int64, error) {
+	counter := bson.M{}
+	err := esr.Database.Collection("counters").FindOne(context.TODO(), bson.M{"_id": "events"}).Decode(&counter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, dbError(err, "event")
+	}
+
+	return int64Field(counter, "position"), nil
+}
+
+// ReadAll fetches up to limit events recorded after the given position, in the order they were committed
+func (esr *EventStoreRepository) ReadAll(afterPosition int64, limit int) ([]eventstore.Event, error) {
+	f := bson.M{"_id": bson.M{"$gt": afterPosition}}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+
+	return esr.find(f, opts)
+}
+
+// projections are the collections made from the event store
+var projections = []string{"users", "followers", "tweets"}
+
+// rebuildBatchSize is how many events RebuildProjections reads from the event store at once
+const rebuildBatchSize = 500
+
+// RebuildProjections empties the users, followers and tweets collections and applies every event in the store to them again,
+// returning how many events were applied. No change is recorded in the outbox, since the rebuilt collections hold the same data
+// It is not atomic (the event store may be too large for one transaction), so it must only run while no Database Access service does
+func (esr *EventStoreRepository) RebuildProjections() (int, error) {
+	for _, name := range projections {
+		_, err := esr.Database.Collection(name).DeleteMany(context.TODO(), bson.M{})
+		if err != nil {
+			return 0, dbError(err, name)
+		}
+	}
+
+	n := 0
+	err := esr.Database.Client().UseSession(context.TODO(), func(ctx mongo.SessionContext) error {
+		var position int64
+		for {
+			events, err := esr.ReadAll(position, rebuildBatchSize)
+			if err != nil {
+				return err
+			}
+
+			if len(events) == 0 {
+				return nil
+			}
+
+			for _, e := range events {
+				_, _, err := project(ctx, esr.Database, e)
+				if err != nil {
+					return err
+				}
+
+				position = e.Position
+				n++
+			}
+		}
+	})
+
+	return n, err
+}
+
+func (esr *EventStoreRepository) find(f bson.M, opts *options.FindOptions) ([]eventstore.Event, error) {
+	cursor, err := esr.Database.Collection("events").Find(context.TODO(), f, opts)
+	if err != nil {
+		return []eventstore.Event{}, dbError(err, "event")
+	}
+
+	var records []bson.M
+	err = cursor.All(context.TODO(), &records)
+	if err != nil {
+		return []eventstore.Event{}, dbError(err, "event")
+	}
+
+	events := []eventstore.Event{}
+	for _, r := range records {
+		events = append(events, toStoredEvent(r))
+	}
+
+	return events, nil
+}
+
+// toEventRecord converts an event to the record stored in the events collection (its data only holds the fields its type sets)
+func toEventRecord(e eventstore.Event) bson.M {
+	var data bson.M
+	switch e.Type {
+	case eventstore.UserCreated:
+		data = bson.M{"userID": e.User.ID, "username": e.User.Username, "passwordHash": e.User.PasswordHash, "createdAt": e.User.CreatedAt}
+	case eventstore.UserPasswordUpdated:
+		data = bson.M{"userID": e.User.ID, "passwordHash": e.User.PasswordHash}
+	case eventstore.FollowCreated:
+		data = bson.M{
+			"followID":         e.Follow.ID,
+			"followerUserID":   e.Follow.FollowerUserID,
+			"followerUsername": e.Follow.FollowerUsername,
+			"followeeUserID":   e.Follow.FolloweeUserID,
+			"followeeUsername": e.Follow.FolloweeUsername,
+			"createdAt":        e.Follow.CreatedAt,
+		}
+	case eventstore.FollowDeleted:
+		data = bson.M{"followerUserID": e.Follow.FollowerUserID, "followeeUserID": e.Follow.FolloweeUserID}
+	case eventstore.TweetCreated:
+		data = bson.M{"tweetID": e.Tweet.ID, "userID": e.Tweet.UserID, "username": e.Tweet.Username, "text": e.Tweet.Text, "createdAt": e.Tweet.CreatedAt}
+	case eventstore.TweetEdited:
+		data = bson.M{"tweetID": e.Tweet.ID, "userID": e.Tweet.UserID, "text": e.Tweet.Text, "editedAt": e.Tweet.EditedAt}
+	case eventstore.TweetDeleted:
+		data = bson.M{"tweetID": e.Tweet.ID, "userID": e.Tweet.UserID}
+	}
+
+	return bson.M{
+		"_id":        e.Position,
+		"streamID":   e.StreamID,
+		"version":    int64(e.Version),
+		"type":       string(e.Type),
+		"eventID":    e.EventID,
+		"data":       data,
+		"recordedAt": e.RecordedAt,
+	}
+}
+
+func toStoredEvent(r bson.M) eventstore.Event {
+	e := eventstore.Event{
+		Position:   int64Field(r, "_id"),
+		StreamID:   r["streamID"].(string),
+		Version:    int(int64Field(r, "version")),
+		Type:       eventstore.Type(r["type"].(string)),
+		RecordedAt: timeField(r, "recordedAt"),
+	}
+	e.EventID, _ = r["eventID"].(string)
+
+	data, _ := r["data"].(bson.M)
+	str := func(key string) string {
+		s, _ := data[key].(string)
+		return s
+	}
+
+	switch e.Type {
+	case eventstore.UserCreated, eventstore.UserPasswordUpdated:
+		e.User = user.User{ID: str("userID"), Username: str("username"), PasswordHash: str("passwordHash"), CreatedAt: timeField(data, "createdAt")}
+	case eventstore.FollowCreated, eventstore.FollowDeleted:
+		e.Follow = follow.Follow{
+			ID:               str("followID"),
+			FollowerUserID:   str("followerUserID"),
+			FollowerUsername: str("followerUsername"),
+			FolloweeUserID:   str("followeeUserID"),
+			FolloweeUsername: str("followeeUsername"),
+			CreatedAt:        timeField(data, "createdAt"),
+		}
+	case eventstore.TweetCreated, eventstore.TweetEdited, eventstore.TweetDeleted:
+		e.Tweet = tweet.Tweet{
+			ID:        str("tweetID"),
+			UserID:    str("userID"),
+			Username:  str("username"),
+			Text:      str("text"),
+			CreatedAt: timeField(data, "createdAt"),
+			EditedAt:  timeField(data, "editedAt"),
+		}
+	}
+
+	return e
+}
+
+// int64Field returns the integer stored in the given field of a record (whichever integer type it was stored as)
+func int64Field(r bson.M, key string) int64 {
+	switch n := r[key].(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
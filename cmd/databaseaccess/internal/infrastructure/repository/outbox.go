@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/outbox"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// transact runs fn in a transaction (retrying it if the transaction fails with a transient error)
+// Transactions require MongoDB to run as a replica set
+func transact(db *mongo.Database, entity string, fn func(ctx mongo.SessionContext) error) error {
+	err := db.Client().UseSession(context.TODO(), func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+
+		return err
+	})
+
+	var ae *apperror.Error
+	if err != nil && !errors.As(err, &ae) {
+		return dbError(err, entity)
+	}
+
+	return err
+}
+
+// recordChange inserts a change into the outbox (it must be called within the transaction that makes the change)
+// The payload is the changed record, stored as is so that it is decoded like the records of its collection,
+// and the position is that of the event store event the change projects
+func recordChange(ctx mongo.SessionContext, db *mongo.Database, t outbox.Type, payload bson.M, position int64) error {
+	insert := bson.M{"type": string(t), "payload": payload, "position": position, "createdAt": time.Now(), "publishedAt": nil}
+	_, err := db.Collection("outbox").InsertOne(ctx, insert)
+
+	return dbError(err, "outbox change")
+}
+
+// OutboxRepository implements the Outbox Repository
+type OutboxRepository struct {
+	Database *mongo.Database
+}
+
+// FindUnpublished fetches up to limit changes that have not been published yet, in the order they were recorded
+func (obr *OutboxRepository) FindUnpublished(limit int) ([]outbox.Change, error) {
+	f := bson.M{"publishedAt": nil}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := obr.Database.Collection("outbox").Find(context.TODO(), f, opts)
+	if err != nil {
+		return []outbox.Change{}, dbError(err, "outbox change")
+	}
+
+	var records []bson.M
+	err = cursor.All(context.TODO(), &records)
+	if err != nil {
+		return []outbox.Change{}, dbError(err, "outbox change")
+	}
+
+	changes := []outbox.Change{}
+	for _, r := range records {
+		changes = append(changes, toChange(r))
+	}
+
+	return changes, nil
+}
+
+// MarkPublished marks a change as published (published changes are removed by a TTL index)
+func (obr *OutboxRepository) MarkPublished(changeID string) error {
+	_id, err := primitive.ObjectIDFromHex(changeID)
+	if err != nil {
+		return invalidIDError("ChangeID", err)
+	}
+
+	f := bson.M{"_id": _id}
+	u := bson.M{"$set": bson.M{"publishedAt": time.Now()}}
+	_, err = obr.Database.Collection("outbox").UpdateOne(context.TODO(), f, u)
+
+	return dbError(err, "outbox change")
+}
+
+func toChange(r bson.M) outbox.Change {
+	c := outbox.Change{
+		ID:        r["_id"].(primitive.ObjectID).Hex(),
+		Type:      outbox.Type(r["type"].(string)),
+		Position:  int64Field(r, "position"),
+		CreatedAt: timeField(r, "createdAt"),
+	}
+
+	payload, _ := r["payload"].(bson.M)
+	switch c.Type {
+	case outbox.UserSaved:
+		c.User = toUser(payload)
+	case outbox.FollowSaved:
+		c.Follow = toFollow(payload)
+	case outbox.FollowDeleted:
+		followerUserID, _ := payload["followerUserID"].(string)
+		followeeUserID, _ := payload["followeeUserID"].(string)
+		c.Follow = follow.Follow{FollowerUserID: followerUserID, FolloweeUserID: followeeUserID}
+	case outbox.TweetSaved:
+		c.Tweet = toTweet(payload)
+	case outbox.TweetDeleted:
+		userID, _ := payload["userID"].(string)
+		c.Tweet = tweet.Tweet{ID: payload["_id"].(primitive.ObjectID).Hex(), UserID: userID}
+	}
+
+	return c
+}
@@ -2,15 +2,19 @@ package repository
 
 import (
 	"context"
-	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/eventstore"
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/token"
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
 )
 
 // UserRepository implements the User Repository
@@ -18,63 +22,112 @@ type UserRepository struct {
 	Database *mongo.Database
 }
 
-// Save inserts a user into the database
+// Save records a UserCreated event, which inserts the user into the database (and records the change in the outbox)
 func (ur *UserRepository) Save(conf user.Config) (insertID string, err error) {
-	insert := bson.M{"username": conf.Username, "password": conf.Password}
-	res, err := ur.Database.Collection("users").InsertOne(context.TODO(), insert)
+	userID := primitive.NewObjectID().Hex()
+	e := eventstore.Event{
+		StreamID: eventstore.UserStream(userID),
+		Type:     eventstore.UserCreated,
+		EventID:  conf.EventID,
+		User:     user.User{ID: userID, Username: conf.Username, PasswordHash: conf.PasswordHash, CreatedAt: conf.CreatedAt},
+	}
+	err = transact(ur.Database, "user", func(ctx mongo.SessionContext) error {
+		err := recordEvent(ctx, ur.Database, conf.EventID)
+		if err != nil {
+			return err
+		}
+
+		_, err = record(ctx, ur.Database, e, eventstore.NoStream)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
 
-	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+	return userID, nil
 }
 
 // FindByID TO DO
 func (ur *UserRepository) FindByID(userID string) (user.User, error) {
 	_id, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return user.User{}, err
+		return user.User{}, invalidIDError("UserID", err)
 	}
 
 	record := bson.M{}
 	f := bson.M{"_id": _id}
 	res := ur.Database.Collection("users").FindOne(context.TODO(), f)
 	err = res.Decode(&record)
+	if err != nil {
+		return user.User{}, dbError(err, "user")
+	}
+
+	return toUser(record), nil
+}
+
+// UpdatePassword records a UserPasswordUpdated event, which replaces the password hash of the user with the given ID
+// (and records the change in the outbox), and returns the updated user
+func (ur *UserRepository) UpdatePassword(userID string, passwordHash string, eventID string) (user.User, error) {
+	_, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return user.User{}, invalidIDError("UserID", err)
+	}
+
+	e := eventstore.Event{
+		StreamID: eventstore.UserStream(userID),
+		Type:     eventstore.UserPasswordUpdated,
+		EventID:  eventID,
+		User:     user.User{ID: userID, PasswordHash: passwordHash},
+	}
+
+	var r bson.M
+	err = transact(ur.Database, "user", func(ctx mongo.SessionContext) error {
+		err := recordEvent(ctx, ur.Database, eventID)
+		if err != nil {
+			return err
+		}
+
+		r, err = record(ctx, ur.Database, e, eventstore.AnyVersion)
+		return err
+	})
 	if err != nil {
 		return user.User{}, err
 	}
 
-	return user.User{
-		ID:       record["_id"].(primitive.ObjectID).Hex(),
-		Username: record["username"].(string),
-		Password: record["password"].(string),
-	}, nil
+	return toUser(r), nil
 }
 
-// FindAll TO DO
-func (ur *UserRepository) FindAll() ([]user.User, error) {
-	f := bson.M{}
-	cursor, err := ur.Database.Collection("users").Find(context.TODO(), f)
+// Stream passes each user with an ID after afterID (and, if set, written since updatedSince) to fn, in ID order,
+// fetching them in batches of batchSize
+func (ur *UserRepository) Stream(ctx context.Context, afterID string, updatedSince time.Time, batchSize int, fn func(user.User) error) error {
+	f, err := bulkFilter(bson.M{}, afterID, updatedSince)
 	if err != nil {
-		return []user.User{}, err
+		return err
 	}
 
-	var records []bson.M
-	err = cursor.All(context.TODO(), &records)
+	cursor, err := ur.Database.Collection("users").Find(ctx, f, bulkOptions(batchSize))
 	if err != nil {
-		return []user.User{}, err
+		return dbError(err, "user")
 	}
 
-	users := []user.User{}
-	for _, r := range records {
-		users = append(users, user.User{
-			ID:       r["_id"].(primitive.ObjectID).Hex(),
-			Username: r["username"].(string),
-			Password: r["password"].(string),
-		})
+	return each(ctx, cursor, "user", func(r bson.M) error { return fn(toUser(r)) })
+}
+
+func toUser(r bson.M) user.User {
+	_id := r["_id"].(primitive.ObjectID)
+	u := user.User{
+		ID:           _id.Hex(),
+		Username:     r["username"].(string),
+		PasswordHash: r["passwordHash"].(string),
+		CreatedAt:    timeField(r, "createdAt"),
+	}
+
+	// users created before timestamps were stored fall back to the creation time of their ObjectID
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = _id.Timestamp()
 	}
 
-	return users, nil
+	return u
 }
 
 // FollowRepository TO DO
@@ -82,21 +135,50 @@ type FollowRepository struct {
 	Database *mongo.Database
 }
 
-// Save TO DO
-func (fr *FollowRepository) Save(f follow.Follow) (insertID string, err error) {
-	insert := bson.M{
-		"followerUserID":   f.FollowerUserID,
-		"followerUsername": f.FollowerUsername,
-		"followeeUserID":   f.FolloweeUserID,
-		"followeeUsername": f.FolloweeUsername,
+// Save records a FollowCreated event, which inserts the follow into the database (and records the change in the outbox)
+// A follower/followee pair is unique, so saving a follow that already exists fails
+func (fr *FollowRepository) Save(f follow.Follow, eventID string) (insertID string, err error) {
+	f.ID = primitive.NewObjectID().Hex()
+	e := eventstore.Event{
+		StreamID: eventstore.FollowStream(f.FollowerUserID, f.FolloweeUserID),
+		Type:     eventstore.FollowCreated,
+		EventID:  eventID,
+		Follow:   f,
 	}
-	res, err := fr.Database.Collection("followers").InsertOne(context.TODO(), insert)
+	err = transact(fr.Database, "follow", func(ctx mongo.SessionContext) error {
+		err := recordEvent(ctx, fr.Database, eventID)
+		if err != nil {
+			return err
+		}
+
+		_, err = record(ctx, fr.Database, e, eventstore.AnyVersion)
+		return err
+	})
 	if err != nil {
-		fmt.Println(err)
 		return "", err
 	}
 
-	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+	return f.ID, nil
+}
+
+// Delete records a FollowDeleted event, which removes the follow between the given follower and followee
+// (and records the change in the outbox)
+func (fr *FollowRepository) Delete(followerUserID string, followeeUserID string, eventID string) error {
+	e := eventstore.Event{
+		StreamID: eventstore.FollowStream(followerUserID, followeeUserID),
+		Type:     eventstore.FollowDeleted,
+		EventID:  eventID,
+		Follow:   follow.Follow{FollowerUserID: followerUserID, FolloweeUserID: followeeUserID},
+	}
+	return transact(fr.Database, "follow", func(ctx mongo.SessionContext) error {
+		err := recordEvent(ctx, fr.Database, eventID)
+		if err != nil {
+			return err
+		}
+
+		_, err = record(ctx, fr.Database, e, eventstore.AnyVersion)
+		return err
+	})
 }
 
 // FindFollowersByUserID TO DO
@@ -104,23 +186,18 @@ func (fr *FollowRepository) FindFollowersByUserID(userID string) ([]follow.Follo
 	f := bson.M{"followeeUserID": userID}
 	cursor, err := fr.Database.Collection("followers").Find(context.TODO(), f)
 	if err != nil {
-		return []follow.Follow{}, err
+		return []follow.Follow{}, dbError(err, "follow")
 	}
 
 	var records []bson.M
 	err = cursor.All(context.TODO(), &records)
 	if err != nil {
-		return []follow.Follow{}, err
+		return []follow.Follow{}, dbError(err, "follow")
 	}
 
 	followers := []follow.Follow{}
 	for _, r := range records {
-		followers = append(followers, follow.Follow{
-			FollowerUserID:   r["followerUserID"].(string),
-			FollowerUsername: r["followerUsername"].(string),
-			FolloweeUserID:   r["followeeUserID"].(string),
-			FolloweeUsername: r["followeeUsername"].(string),
-		})
+		followers = append(followers, toFollow(r))
 	}
 
 	return followers, nil
@@ -131,53 +208,58 @@ func (fr *FollowRepository) FindFolloweesByUserID(userID string) ([]follow.Follo
 	f := bson.M{"followerUserID": userID}
 	cursor, err := fr.Database.Collection("followers").Find(context.TODO(), f)
 	if err != nil {
-		return []follow.Follow{}, err
+		return []follow.Follow{}, dbError(err, "follow")
 	}
 
 	var records []bson.M
 	err = cursor.All(context.TODO(), &records)
 	if err != nil {
-		return []follow.Follow{}, err
+		return []follow.Follow{}, dbError(err, "follow")
 	}
 
 	followers := []follow.Follow{}
 	for _, r := range records {
-		followers = append(followers, follow.Follow{
-			FollowerUserID:   r["followerUserID"].(string),
-			FollowerUsername: r["followerUsername"].(string),
-			FolloweeUserID:   r["followeeUserID"].(string),
-			FolloweeUsername: r["followeeUsername"].(string),
-		})
+		followers = append(followers, toFollow(r))
 	}
 
 	return followers, nil
 }
 
-// FindAll TO DO
-func (fr *FollowRepository) FindAll() ([]follow.Follow, error) {
-	f := bson.M{}
-	cursor, err := fr.Database.Collection("followers").Find(context.TODO(), f)
+// Stream passes each follow with an ID after afterID (and, if set, created since updatedSince) to fn, in ID order,
+// fetching them in batches of batchSize
+// Deleted follows are removed from the database, so they are never included
+func (fr *FollowRepository) Stream(ctx context.Context, afterID string, updatedSince time.Time, batchSize int, fn func(follow.Follow) error) error {
+	f, err := bulkFilter(bson.M{}, afterID, updatedSince)
 	if err != nil {
-		return []follow.Follow{}, err
+		return err
 	}
 
-	var records []bson.M
-	err = cursor.All(context.TODO(), &records)
+	cursor, err := fr.Database.Collection("followers").Find(ctx, f, bulkOptions(batchSize))
 	if err != nil {
-		return []follow.Follow{}, err
+		return dbError(err, "follow")
 	}
 
-	followers := []follow.Follow{}
-	for _, r := range records {
-		followers = append(followers, follow.Follow{
-			FollowerUserID:   r["followerUserID"].(string),
-			FollowerUsername: r["followerUsername"].(string),
-			FolloweeUserID:   r["followeeUserID"].(string),
-			FolloweeUsername: r["followeeUsername"].(string),
-		})
+	return each(ctx, cursor, "follow", func(r bson.M) error { return fn(toFollow(r)) })
+}
+
+func toFollow(r bson.M) follow.Follow {
+	f := follow.Follow{
+		FollowerUserID:   r["followerUserID"].(string),
+		FollowerUsername: r["followerUsername"].(string),
+		FolloweeUserID:   r["followeeUserID"].(string),
+		FolloweeUsername: r["followeeUsername"].(string),
+		CreatedAt:        timeField(r, "createdAt"),
 	}
 
-	return followers, nil
+	// follows created before timestamps were stored fall back to the creation time of their ObjectID
+	if _id, ok := r["_id"].(primitive.ObjectID); ok {
+		f.ID = _id.Hex()
+		if f.CreatedAt.IsZero() {
+			f.CreatedAt = _id.Timestamp()
+		}
+	}
+
+	return f
 }
 
 // TweetRepository TO DO
@@ -185,67 +267,345 @@ type TweetRepository struct {
 	Database *mongo.Database
 }
 
-// Save TO DO
+// Save records a TweetCreated event, which inserts the tweet into the database (and records the change in the outbox)
 func (tr *TweetRepository) Save(conf tweet.Config) (insertID string, err error) {
-	insert := bson.M{"userID": conf.UserID, "username": conf.Username, "text": conf.Text}
-	res, err := tr.Database.Collection("tweets").InsertOne(context.TODO(), insert)
+	tweetID := primitive.NewObjectID().Hex()
+	e := eventstore.Event{
+		StreamID: eventstore.TweetStream(tweetID),
+		Type:     eventstore.TweetCreated,
+		EventID:  conf.EventID,
+		Tweet:    tweet.Tweet{ID: tweetID, UserID: conf.UserID, Username: conf.Username, Text: conf.Text, CreatedAt: conf.CreatedAt},
+	}
+	err = transact(tr.Database, "tweet", func(ctx mongo.SessionContext) error {
+		err := recordEvent(ctx, tr.Database, conf.EventID)
+		if err != nil {
+			return err
+		}
+
+		_, err = record(ctx, tr.Database, e, eventstore.NoStream)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
 
-	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+	return tweetID, nil
+}
+
+// Edit records a TweetEdited event, which replaces the text of a (non-deleted) tweet owned by the given user
+// and appends its previous text to its revisions (and records the change in the outbox)
+func (tr *TweetRepository) Edit(te tweet.Edit) (tweet.Tweet, error) {
+	_, err := primitive.ObjectIDFromHex(te.TweetID)
+	if err != nil {
+		return tweet.Tweet{}, invalidIDError("TweetID", err)
+	}
+
+	e := eventstore.Event{
+		StreamID: eventstore.TweetStream(te.TweetID),
+		Type:     eventstore.TweetEdited,
+		EventID:  te.EventID,
+		Tweet:    tweet.Tweet{ID: te.TweetID, UserID: te.UserID, Text: te.Text, EditedAt: te.EditedAt},
+	}
+
+	var r bson.M
+	err = transact(tr.Database, "tweet", func(ctx mongo.SessionContext) error {
+		err := recordEvent(ctx, tr.Database, te.EventID)
+		if err != nil {
+			return err
+		}
+
+		r, err = record(ctx, tr.Database, e, eventstore.AnyVersion)
+		return err
+	})
+	if err != nil {
+		return tweet.Tweet{}, err
+	}
+
+	return toTweet(r), nil
+}
+
+// Delete records a TweetDeleted event, which soft deletes a tweet owned by the given user
+// (its record and revisions are kept, but it is no longer returned) and records the change in the outbox
+func (tr *TweetRepository) Delete(tweetID string, userID string, eventID string) error {
+	_, err := primitive.ObjectIDFromHex(tweetID)
+	if err != nil {
+		return invalidIDError("TweetID", err)
+	}
+
+	e := eventstore.Event{
+		StreamID: eventstore.TweetStream(tweetID),
+		Type:     eventstore.TweetDeleted,
+		EventID:  eventID,
+		Tweet:    tweet.Tweet{ID: tweetID, UserID: userID},
+	}
+	return transact(tr.Database, "tweet", func(ctx mongo.SessionContext) error {
+		err := recordEvent(ctx, tr.Database, eventID)
+		if err != nil {
+			return err
+		}
+
+		_, err = record(ctx, tr.Database, e, eventstore.AnyVersion)
+		return err
+	})
+}
+
+// FindByID fetches a (non-deleted) tweet, including its revisions, given its ID
+func (tr *TweetRepository) FindByID(tweetID string) (tweet.Tweet, error) {
+	_id, err := primitive.ObjectIDFromHex(tweetID)
+	if err != nil {
+		return tweet.Tweet{}, invalidIDError("TweetID", err)
+	}
+
+	record := bson.M{}
+	f := bson.M{"_id": _id, "deleted": bson.M{"$ne": true}}
+	res := tr.Database.Collection("tweets").FindOne(context.TODO(), f)
+	err = res.Decode(&record)
+	if err != nil {
+		return tweet.Tweet{}, dbError(err, "tweet")
+	}
+
+	return toTweet(record), nil
 }
 
 // FindByUserID TO DO
 func (tr *TweetRepository) FindByUserID(userID string) ([]tweet.Tweet, error) {
-	f := bson.M{"userID": userID}
+	f := bson.M{"userID": userID, "deleted": bson.M{"$ne": true}}
 	cursor, err := tr.Database.Collection("tweets").Find(context.TODO(), f)
 	if err != nil {
-		return []tweet.Tweet{}, err
+		return []tweet.Tweet{}, dbError(err, "tweet")
 	}
 
 	var records []bson.M
 	err = cursor.All(context.TODO(), &records)
 	if err != nil {
-		return []tweet.Tweet{}, err
+		return []tweet.Tweet{}, dbError(err, "tweet")
 	}
 
 	tweets := []tweet.Tweet{}
 	for _, r := range records {
-		tweets = append(tweets, tweet.Tweet{
-			ID:       r["_id"].(primitive.ObjectID).Hex(),
-			UserID:   r["userID"].(string),
-			Username: r["username"].(string),
-			Text:     r["text"].(string),
-		})
+		tweets = append(tweets, toTweet(r))
 	}
 
 	return tweets, nil
 }
 
-// FindAll TO DO
-func (tr *TweetRepository) FindAll() ([]tweet.Tweet, error) {
+// Stream passes each tweet with an ID after afterID to fn, in ID order, fetching them in batches of batchSize
+// Without updatedSince, only non-deleted tweets are included; with it, the tweets written since updatedSince are included
+// whether or not they were deleted (with Deleted set), so that a delta load also learns of deletions
+func (tr *TweetRepository) Stream(ctx context.Context, afterID string, updatedSince time.Time, batchSize int, fn func(tweet.Tweet) error) error {
 	f := bson.M{}
-	cursor, err := tr.Database.Collection("tweets").Find(context.TODO(), f)
+	if updatedSince.IsZero() {
+		f["deleted"] = bson.M{"$ne": true}
+	}
+
+	f, err := bulkFilter(f, afterID, updatedSince)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := tr.Database.Collection("tweets").Find(ctx, f, bulkOptions(batchSize))
+	if err != nil {
+		return dbError(err, "tweet")
+	}
+
+	return each(ctx, cursor, "tweet", func(r bson.M) error { return fn(toTweet(r)) })
+}
+
+func toTweet(r bson.M) tweet.Tweet {
+	_id := r["_id"].(primitive.ObjectID)
+	t := tweet.Tweet{
+		ID:        _id.Hex(),
+		UserID:    r["userID"].(string),
+		Username:  r["username"].(string),
+		Text:      r["text"].(string),
+		CreatedAt: timeField(r, "createdAt"),
+		EditedAt:  timeField(r, "editedAt"),
+	}
+	t.Deleted, _ = r["deleted"].(bool)
+
+	// tweets created before timestamps were stored fall back to the creation time of their ObjectID
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = _id.Timestamp()
+	}
+
+	revisions, _ := r["revisions"].(bson.A)
+	for _, rev := range revisions {
+		rm, ok := rev.(bson.M)
+		if !ok {
+			continue
+		}
+
+		text, _ := rm["text"].(string)
+		t.Revisions = append(t.Revisions, tweet.Revision{Text: text, CreatedAt: timeField(rm, "createdAt")})
+	}
+
+	return t
+}
+
+// timeField returns the time stored in the given field of a record (or the zero time if it is not set)
+func timeField(r bson.M, key string) time.Time {
+	dt, ok := r[key].(primitive.DateTime)
+	if !ok {
+		return time.Time{}
+	}
+
+	return dt.Time()
+}
+
+// TokenRepository implements the Token Repository
+type TokenRepository struct {
+	Database *mongo.Database
+}
+
+// SaveRefreshToken inserts a refresh token into the database
+func (tr *TokenRepository) SaveRefreshToken(t token.RefreshToken) (insertID string, err error) {
+	insert := bson.M{
+		"tokenHash": t.TokenHash,
+		"userID":    t.UserID,
+		"username":  t.Username,
+		"familyID":  t.FamilyID,
+		"expiresAt": t.ExpiresAt,
+		"used":      false,
+		"revoked":   false,
+	}
+	res, err := tr.Database.Collection("refreshTokens").InsertOne(context.TODO(), insert)
+	if err != nil {
+		return "", dbError(err, "refresh token")
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// FindRefreshToken fetches a refresh token given its hash
+func (tr *TokenRepository) FindRefreshToken(tokenHash string) (token.RefreshToken, error) {
+	record := bson.M{}
+	f := bson.M{"tokenHash": tokenHash}
+	res := tr.Database.Collection("refreshTokens").FindOne(context.TODO(), f)
+	err := res.Decode(&record)
+	if err != nil {
+		return token.RefreshToken{}, dbError(err, "refresh token")
+	}
+
+	return toRefreshToken(record), nil
+}
+
+// UseRefreshToken marks a refresh token as used and returns the token as it was before the update
+func (tr *TokenRepository) UseRefreshToken(tokenHash string) (token.RefreshToken, error) {
+	record := bson.M{}
+	f := bson.M{"tokenHash": tokenHash}
+	u := bson.M{"$set": bson.M{"used": true}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	res := tr.Database.Collection("refreshTokens").FindOneAndUpdate(context.TODO(), f, u, opts)
+	err := res.Decode(&record)
+	if err != nil {
+		return token.RefreshToken{}, dbError(err, "refresh token")
+	}
+
+	return toRefreshToken(record), nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token with the given family ID
+func (tr *TokenRepository) RevokeRefreshTokenFamily(familyID string) error {
+	f := bson.M{"familyID": familyID}
+	u := bson.M{"$set": bson.M{"revoked": true}}
+	_, err := tr.Database.Collection("refreshTokens").UpdateMany(context.TODO(), f, u)
+
+	return dbError(err, "refresh token")
+}
+
+// RevokeAccessToken adds an access token ID to the revocation list (records are removed by a TTL index once the token expires)
+func (tr *TokenRepository) RevokeAccessToken(t token.RevokedToken) error {
+	f := bson.M{"tokenID": t.TokenID}
+	u := bson.M{"$set": bson.M{"tokenID": t.TokenID, "expiresAt": t.ExpiresAt}}
+	opts := options.Update().SetUpsert(true)
+	_, err := tr.Database.Collection("revokedTokens").UpdateOne(context.TODO(), f, u, opts)
+
+	return dbError(err, "revoked token")
+}
+
+// IsAccessTokenRevoked checks if an access token ID is on the revocation list
+func (tr *TokenRepository) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	f := bson.M{"tokenID": tokenID}
+	count, err := tr.Database.Collection("revokedTokens").CountDocuments(context.TODO(), f)
 	if err != nil {
-		return []tweet.Tweet{}, err
+		return false, dbError(err, "revoked token")
+	}
+
+	return count > 0, nil
+}
+
+// FindSigningKeys fetches the active signing key followed by the retired keys that have not expired, newest first
+func (tr *TokenRepository) FindSigningKeys() ([]token.SigningKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "active", Value: -1}, {Key: "createdAt", Value: -1}})
+	cursor, err := tr.Database.Collection("signingKeys").Find(context.TODO(), bson.M{}, opts)
+	if err != nil {
+		return []token.SigningKey{}, dbError(err, "signing key")
 	}
 
 	var records []bson.M
 	err = cursor.All(context.TODO(), &records)
 	if err != nil {
-		return []tweet.Tweet{}, err
+		return []token.SigningKey{}, dbError(err, "signing key")
 	}
 
-	tweets := []tweet.Tweet{}
+	keys := []token.SigningKey{}
 	for _, r := range records {
-		tweets = append(tweets, tweet.Tweet{
-			ID:       r["_id"].(primitive.ObjectID).Hex(),
-			UserID:   r["userID"].(string),
-			Username: r["username"].(string),
-			Text:     r["text"].(string),
+		keys = append(keys, token.SigningKey{
+			ID:                  r["keyID"].(string),
+			Algorithm:           r["algorithm"].(string),
+			EncryptedPrivateKey: r["encryptedPrivateKey"].(primitive.Binary).Data,
+			CreatedAt:           timeField(r, "createdAt"),
+			RetiredAt:           timeField(r, "retiredAt"),
 		})
 	}
 
-	return tweets, nil
+	return keys, nil
+}
+
+// RotateSigningKey retires the active signing key and inserts the next one in a transaction
+// A unique index on active keys keeps two API Gateway instances that rotate at once from both making a key active
+func (tr *TokenRepository) RotateSigningKey(next token.SigningKey, activeKeyID string, retiredKeyExpiresAt time.Time) error {
+	return transact(tr.Database, "signing key", func(ctx mongo.SessionContext) error {
+		keys := tr.Database.Collection("signingKeys")
+		if activeKeyID != "" {
+			f := bson.M{"keyID": activeKeyID, "active": true}
+			u := bson.M{
+				"$set":   bson.M{"retiredAt": time.Now(), "expiresAt": retiredKeyExpiresAt},
+				"$unset": bson.M{"active": ""},
+			}
+			res, err := keys.UpdateOne(ctx, f, u)
+			if err != nil {
+				return err
+			}
+			if res.MatchedCount == 0 {
+				return apperror.New(apperror.Aborted, "SIGNING_KEY_ROTATED", "Signing key is no longer active")
+			}
+		}
+
+		insert := bson.M{
+			"keyID":               next.ID,
+			"algorithm":           next.Algorithm,
+			"encryptedPrivateKey": next.EncryptedPrivateKey,
+			"createdAt":           next.CreatedAt,
+			"active":              true,
+		}
+		_, err := keys.InsertOne(ctx, insert)
+		if mongo.IsDuplicateKeyError(err) {
+			return apperror.Wrap(apperror.Aborted, "SIGNING_KEY_ROTATED", "Another signing key is already active", err)
+		}
+
+		return err
+	})
+}
+
+func toRefreshToken(r bson.M) token.RefreshToken {
+	return token.RefreshToken{
+		TokenHash: r["tokenHash"].(string),
+		UserID:    r["userID"].(string),
+		Username:  r["username"].(string),
+		FamilyID:  r["familyID"].(string),
+		ExpiresAt: timeField(r, "expiresAt"),
+		Used:      r["used"].(bool),
+		Revoked:   r["revoked"].(bool),
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,8 +13,11 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/application"
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/infrastructure/changepublisher"
 	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/infrastructure/repository"
 	pb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+	"github.com/martinmhan/tweet-app-api/internal/broker/rabbitmq"
+	"github.com/martinmhan/tweet-app-api/internal/readiness"
 )
 
 func main() {
@@ -23,11 +27,37 @@ func main() {
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
 	dbName := os.Getenv("DB_NAME")
+	mqHost := os.Getenv("MQ_HOST")
+	mqPort := os.Getenv("MQ_PORT")
+	mqName := os.Getenv("MQ_NAME")
+	outboxRelay := os.Getenv("OUTBOX_RELAY")                  // optional, defaults to rabbitmq
+	outboxRelayInterval := os.Getenv("OUTBOX_RELAY_INTERVAL") // optional, defaults to 500ms
 
 	if port == "" || dbHost == "" || dbPort == "" || dbName == "" {
 		log.Fatal("Missing environment variable(s). Please edit .env file")
 	}
 
+	if outboxRelay == "" {
+		outboxRelay = "rabbitmq"
+	}
+
+	if outboxRelay != "rabbitmq" && outboxRelay != "off" {
+		log.Fatal("Invalid OUTBOX_RELAY: ", outboxRelay)
+	}
+
+	if outboxRelay == "rabbitmq" && (mqHost == "" || mqPort == "" || mqName == "") {
+		log.Fatal("Missing environment variable(s). Please edit .env file")
+	}
+
+	relayInterval := 500 * time.Millisecond
+	if outboxRelayInterval != "" {
+		d, err := time.ParseDuration(outboxRelayInterval)
+		if err != nil || d <= 0 {
+			log.Fatal("Invalid OUTBOX_RELAY_INTERVAL: ", outboxRelayInterval)
+		}
+		relayInterval = d
+	}
+
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		log.Fatal("Database Access server failed to listen: ", err)
@@ -50,12 +80,44 @@ func main() {
 	ur := repository.UserRepository{Database: db}
 	fr := repository.FollowRepository{Database: db}
 	tr := repository.TweetRepository{Database: db}
+	tkr := repository.TokenRepository{Database: db}
+	obr := repository.OutboxRepository{Database: db}
+	er := repository.EventRepository{Database: db}
+	esr := repository.EventStoreRepository{Database: db}
+	cf := repository.ChangeFeed{Database: db, PollInterval: relayInterval}
+
+	dbReady := func() bool {
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+		defer cancel()
+
+		return client.Ping(ctx, nil) == nil
+	}
+	checks := []readiness.Check{dbReady}
+
+	// changes are published to the exchange consumed by the Read View service, unless every Read View watches the outbox instead
+	relay := &application.OutboxRelay{Repository: &obr, Interval: relayInterval}
+	if outboxRelay == "rabbitmq" {
+		mqConn := rabbitmq.Supervise(rabbitmq.URL(mqHost, mqPort))
+		defer mqConn.Close()
+
+		relay.Publisher = &changepublisher.ChangePublisher{ExchangeName: mqName + ".changes", Connection: mqConn}
+		checks = append(checks, mqConn.IsConnected)
+	}
+	go relay.Run()
+
+	gate := readiness.NewGate(checks...)
+	go gate.Run()
 
 	g := grpc.NewServer()
+	gate.Register(g)
 	s := &application.DatabaseAccessServer{
 		UserRepository:   &ur,
 		FollowRepository: &fr,
 		TweetRepository:  &tr,
+		TokenRepository:  &tkr,
+		EventRepository:  &er,
+		EventStore:       &esr,
+		ChangeFeed:       &cf,
 	}
 	pb.RegisterDatabaseAccessServer(g, s)
 
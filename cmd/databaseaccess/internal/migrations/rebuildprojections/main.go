@@ -0,0 +1,48 @@
+// Command rebuildprojections rebuilds the users, followers and tweets collections by replaying the event store
+// Every Database Access service must be stopped while it runs, since the collections are emptied before the events are applied
+// The Read View is left as it is: the rebuilt collections hold the same data, so no change is recorded in the outbox
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/martinmhan/tweet-app-api/cmd/databaseaccess/internal/infrastructure/repository"
+)
+
+func main() {
+	godotenv.Load()
+
+	dbHost := os.Getenv("DB_HOST")
+	dbPort := os.Getenv("DB_PORT")
+	dbName := os.Getenv("DB_NAME")
+	if dbHost == "" || dbPort == "" || dbName == "" {
+		log.Fatal("Missing environment variable(s). Please edit .env file")
+	}
+
+	connectionURI := "mongodb://" + dbHost + ":" + dbPort + "/"
+	client, err := mongo.NewClient(options.Client().ApplyURI(connectionURI))
+	if err != nil {
+		log.Fatal("Failed to create MongoDB client: ", err)
+	}
+
+	err = client.Connect(context.TODO())
+	if err != nil {
+		log.Fatal("Failed to connect MongoDB client: ", err)
+	}
+
+	defer client.Disconnect(context.TODO())
+
+	esr := repository.EventStoreRepository{Database: client.Database(dbName)}
+	n, err := esr.RebuildProjections()
+	if err != nil {
+		log.Fatal("Failed to rebuild projections: ", err)
+	}
+
+	log.Printf("Rebuilt projections from %d event(s)", n)
+}
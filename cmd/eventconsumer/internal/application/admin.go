@@ -0,0 +1,118 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/martinmhan/tweet-app-api/cmd/eventconsumer/proto"
+	producerpb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+const defaultDeadLetterLimit = 100
+
+// errScanLimitReached ends a dead-letter scan once the requested number of dead letters was scanned
+var errScanLimitReached = errors.New("Dead-letter scan limit reached")
+
+// ListDeadLetters returns dead-lettered events (oldest first) without removing them from the dead-letter queue
+func (e *EventConsumerServer) ListDeadLetters(ctx context.Context, in *pb.DeadLetterParam) (*pb.DeadLetters, error) {
+	dls := []*pb.DeadLetter{}
+	err := e.scanDeadLetters(in, func(m broker.Message) (bool, error) {
+		dls = append(dls, toPBDeadLetter(m))
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.DeadLetters{DeadLetters: dls}, nil
+}
+
+// RedriveDeadLetters republishes dead-lettered events (oldest first) to the message queue with their retries reset
+func (e *EventConsumerServer) RedriveDeadLetters(ctx context.Context, in *pb.DeadLetterParam) (*pb.RedriveResponse, error) {
+	var redriven int32
+	err := e.scanDeadLetters(in, func(m broker.Message) (bool, error) {
+		m = m.Clone()
+		for _, h := range []string{retryCountHeader, errorCodeHeader, errorReasonHeader, errorMessageHeader, failedAtHeader} {
+			delete(m.Headers, h)
+		}
+
+		err := e.Publisher.Publish(m)
+		if err != nil {
+			return false, err
+		}
+
+		redriven++
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RedriveResponse{Redriven: redriven}, nil
+}
+
+// scanDeadLetters calls fn with dead-lettered events (up to the param's limit and matching its type, if any)
+// fn returns whether to remove the event from the dead-letter queue
+func (e *EventConsumerServer) scanDeadLetters(in *pb.DeadLetterParam, fn func(broker.Message) (bool, error)) error {
+	limit := int(in.Limit)
+	if limit <= 0 {
+		limit = defaultDeadLetterLimit
+	}
+
+	n := 0
+	err := e.Subscriber.ScanDeadLetters(func(m broker.Message) (bool, error) {
+		if n == limit {
+			return false, errScanLimitReached
+		}
+
+		if in.Type != "" && m.Type != in.Type {
+			return false, nil
+		}
+
+		n++
+		return fn(m)
+	})
+	if errors.Is(err, errScanLimitReached) {
+		return nil
+	}
+
+	return err
+}
+
+func toPBDeadLetter(m broker.Message) *pb.DeadLetter {
+	dl := &pb.DeadLetter{
+		Type:         m.Type,
+		Body:         deadLetterBody(m),
+		RetryCount:   int32(retryCount(m)),
+		ErrorCode:    m.Headers[errorCodeHeader],
+		ErrorReason:  m.Headers[errorReasonHeader],
+		ErrorMessage: m.Headers[errorMessageHeader],
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, m.Headers[failedAtHeader]); err == nil {
+		dl.FailedAt = timestamppb.New(t)
+	}
+
+	return dl
+}
+
+// deadLetterBody renders an event's body as text (an EventEnvelope is rendered as JSON, with its payload expanded)
+func deadLetterBody(m broker.Message) string {
+	if m.ContentType != envelopeContentType {
+		return string(m.Body)
+	}
+
+	var env producerpb.EventEnvelope
+	err := proto.Unmarshal(m.Body, &env)
+	if err != nil {
+		return string(m.Body)
+	}
+
+	return protojson.Format(&env)
+}
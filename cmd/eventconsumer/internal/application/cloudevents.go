@@ -0,0 +1,130 @@
+package application
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/event"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// CloudEvents 1.0 AMQP binding, as published by the event producer
+const (
+	cloudEventsSpecVersion  = "1.0"
+	cloudEventsTypePrefix   = "com.github.martinmhan.tweetapp."
+	cloudEventsHeaderPrefix = "cloudEvents:"
+	cloudEventsContentType  = "application/cloudevents+json"
+)
+
+// cloudEvent holds the CloudEvents attributes the EventConsumerServer reads (including the event producer's extension attributes)
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	SchemaVersion   int32           `json:"schemaversion"`
+	Actor           string          `json:"actor"`
+	IdempotencyKey  string          `json:"idempotencykey"`
+	TraceParent     string          `json:"traceparent"`
+	TraceState      string          `json:"tracestate"`
+	Data            json.RawMessage `json:"data"`
+	DataBase64      []byte          `json:"data_base64"`
+}
+
+func isBinaryCloudEvent(m broker.Message) bool {
+	_, ok := m.Headers[cloudEventsHeaderPrefix+"specversion"]
+	return ok
+}
+
+// decodeStructuredCloudEvent reads an event from a message in the CloudEvents structured content mode (JSON event format)
+func (e *EventConsumerServer) decodeStructuredCloudEvent(m broker.Message) (event.Envelope, error) {
+	var ce cloudEvent
+	err := json.Unmarshal(m.Body, &ce)
+	if err != nil {
+		return event.Envelope{}, apperror.Wrap(apperror.InvalidArgument, "INVALID_EVENT_ENVELOPE", "Failed to decode CloudEvent", err)
+	}
+
+	data := []byte(ce.Data)
+	if ce.DataBase64 != nil {
+		data = ce.DataBase64
+	}
+
+	return e.toEnvelope(ce, data)
+}
+
+// decodeBinaryCloudEvent reads an event from a message in the CloudEvents binary content mode (attributes as headers)
+func (e *EventConsumerServer) decodeBinaryCloudEvent(m broker.Message) (event.Envelope, error) {
+	attr := func(name string) string {
+		return m.Headers[cloudEventsHeaderPrefix+name]
+	}
+
+	ce := cloudEvent{
+		SpecVersion:     attr("specversion"),
+		ID:              attr("id"),
+		Type:            attr("type"),
+		Time:            attr("time"),
+		DataContentType: m.ContentType,
+		Actor:           attr("actor"),
+		IdempotencyKey:  attr("idempotencykey"),
+		TraceParent:     attr("traceparent"),
+		TraceState:      attr("tracestate"),
+	}
+
+	if v := attr("schemaversion"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return event.Envelope{}, apperror.Wrap(apperror.InvalidArgument, "INVALID_EVENT_ENVELOPE", "Invalid CloudEvent schemaversion", err)
+		}
+		ce.SchemaVersion = int32(n)
+	}
+
+	return e.toEnvelope(ce, m.Body)
+}
+
+// toEnvelope validates a CloudEvent's attributes and decodes its data to the latest version of its type's schema
+// CloudEvents without a schemaversion attribute are read with version 1, the first version published as CloudEvents
+func (e *EventConsumerServer) toEnvelope(ce cloudEvent, data []byte) (event.Envelope, error) {
+	if ce.SpecVersion != cloudEventsSpecVersion {
+		return event.Envelope{}, apperror.NewInvalidArgument("INVALID_EVENT_ENVELOPE", "Unsupported CloudEvents spec version: "+ce.SpecVersion)
+	}
+
+	if !strings.HasPrefix(ce.Type, cloudEventsTypePrefix) {
+		return event.Envelope{}, apperror.NewInvalidArgument("INVALID_EVENT_TYPE", "Invalid CloudEvent type: "+ce.Type)
+	}
+
+	ev := event.Envelope{
+		ID:             ce.ID,
+		Type:           strings.TrimPrefix(ce.Type, cloudEventsTypePrefix),
+		SchemaVersion:  ce.SchemaVersion,
+		Actor:          ce.Actor,
+		TraceParent:    ce.TraceParent,
+		TraceState:     ce.TraceState,
+		IdempotencyKey: ce.IdempotencyKey,
+	}
+
+	if ev.SchemaVersion == 0 {
+		ev.SchemaVersion = 1
+	}
+
+	if ce.Time != "" {
+		t, err := time.Parse(time.RFC3339Nano, ce.Time)
+		if err != nil {
+			return event.Envelope{}, apperror.Wrap(apperror.InvalidArgument, "INVALID_EVENT_ENVELOPE", "Invalid CloudEvent time", err)
+		}
+		ev.OccurredAt = t
+	}
+
+	contentType := ce.DataContentType
+	if contentType == "" {
+		contentType = jsonContentType
+	}
+
+	var err error
+	ev.Payload, err = e.Schemas.Decode(ev.Type, ev.SchemaVersion, contentType, data)
+
+	return ev, err
+}
@@ -0,0 +1,131 @@
+package application
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	producerpb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// producerCloudEvent encodes an event the way the event producer does in the given CloudEvents content mode
+// (the producer's encoder is internal to the event producer, so it is replicated here)
+func producerCloudEvent(structured bool, attrs map[string]interface{}, payload proto.Message) (broker.Message, error) {
+	data, err := protojson.Marshal(payload)
+	if err != nil {
+		return broker.Message{}, err
+	}
+
+	if !structured {
+		headers := map[string]string{}
+		for k, v := range attrs {
+			headers[cloudEventsHeaderPrefix+k] = fmt.Sprint(v)
+		}
+
+		return broker.Message{ContentType: "application/json", Headers: headers, Body: data}, nil
+	}
+
+	ce := map[string]interface{}{"datacontenttype": "application/json", "data": json.RawMessage(data)}
+	for k, v := range attrs {
+		ce[k] = v
+	}
+
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return broker.Message{}, err
+	}
+
+	return broker.Message{ContentType: cloudEventsContentType, Body: body}, nil
+}
+
+// TestCloudEventRoundTrip encodes events in both CloudEvents content modes as the event producer does, and checks that the
+// consumer reads back their attributes and payload
+func TestCloudEventRoundTrip(t *testing.T) {
+	occurredAt := time.Date(2021, 3, 4, 5, 6, 7, 8000, time.UTC)
+	payload := &producerpb.TweetConfig{UserID: "user-1", Text: "Hello world"}
+
+	valid := map[string]interface{}{
+		"specversion":    "1.0",
+		"id":             "event-1",
+		"source":         "/tweet-app-api/eventproducer",
+		"type":           "com.github.martinmhan.tweetapp.TweetCreation",
+		"time":           occurredAt.Format(time.RFC3339Nano),
+		"schemaversion":  int32(1),
+		"actor":          "user-1",
+		"idempotencykey": "user-1:key-1",
+		"traceparent":    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+
+	without := func(name string) map[string]interface{} {
+		attrs := map[string]interface{}{}
+		for k, v := range valid {
+			if k != name {
+				attrs[k] = v
+			}
+		}
+
+		return attrs
+	}
+
+	with := func(name string, value interface{}) map[string]interface{} {
+		attrs := without(name)
+		attrs[name] = value
+
+		return attrs
+	}
+
+	tests := []struct {
+		name   string
+		attrs  map[string]interface{}
+		reason string // the reason of the expected error, if any
+	}{
+		{name: "valid", attrs: valid},
+		{name: "no schema version", attrs: without("schemaversion")},
+		{name: "unsupported spec version", attrs: with("specversion", "0.3"), reason: "INVALID_EVENT_ENVELOPE"},
+		{name: "foreign type", attrs: with("type", "com.example.TweetCreation"), reason: "INVALID_EVENT_TYPE"},
+		{name: "unknown schema version", attrs: with("schemaversion", int32(2)), reason: "UNKNOWN_EVENT_SCHEMA"},
+		{name: "invalid time", attrs: with("time", "yesterday"), reason: "INVALID_EVENT_ENVELOPE"},
+	}
+
+	s := &EventConsumerServer{Schemas: NewSchemaRegistry()}
+	for _, mode := range []string{"binary", "structured"} {
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				m, err := producerCloudEvent(mode == "structured", tt.attrs, payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ev, err := s.decode(m)
+				if tt.reason != "" {
+					if ae := apperror.FromError(err); ae == nil || ae.Reason != tt.reason {
+						t.Fatalf("got error %v, want reason %s", err, tt.reason)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if ev.ID != "event-1" || ev.Type != "TweetCreation" || ev.SchemaVersion != 1 || !ev.OccurredAt.Equal(occurredAt) {
+					t.Errorf("got envelope %+v", ev)
+				}
+
+				if ev.Actor != "user-1" || ev.IdempotencyKey != "user-1:key-1" || ev.TraceParent != valid["traceparent"] || ev.TraceState != "" {
+					t.Errorf("got extension attributes %+v", ev)
+				}
+
+				p, ok := ev.Payload.(*producerpb.TweetConfig)
+				if !ok || !proto.Equal(p, payload) {
+					t.Errorf("got payload %v, want %v", ev.Payload, payload)
+				}
+			})
+		}
+	}
+}
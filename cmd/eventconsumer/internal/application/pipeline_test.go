@@ -0,0 +1,241 @@
+package application
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/tweet"
+	producerpb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+	"github.com/martinmhan/tweet-app-api/internal/broker/inmemory"
+)
+
+// fakeTweets records the tweets saved by each event, and fails the first attempt at every failEvery-th event
+type fakeTweets struct {
+	failEvery int
+
+	mu       sync.Mutex
+	attempts map[string]int
+	saved    map[string]int
+}
+
+func (r *fakeTweets) Save(conf tweet.Config) (tweet.Tweet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts[conf.EventID]++
+	var n int
+	fmt.Sscanf(conf.EventID, "event-%d", &n)
+	if n%r.failEvery == 0 && r.attempts[conf.EventID] == 1 {
+		return tweet.Tweet{}, apperror.NewUnavailable("DATABASE_UNAVAILABLE", "Failed to reach the database", nil)
+	}
+
+	r.saved[conf.EventID]++
+
+	return tweet.Tweet{UserID: conf.UserID, Text: conf.Text}, nil
+}
+
+func (r *fakeTweets) Edit(tweet.Edit) error       { return nil }
+func (r *fakeTweets) Delete(tweet.Deletion) error { return nil }
+
+func (r *fakeTweets) savedCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.saved)
+}
+
+// noneProcessed is a processed event repository that has not processed any event
+type noneProcessed struct{}
+
+func (noneProcessed) IsProcessed(string) (bool, error) { return false, nil }
+
+// fakeFollows holds the follows saved so far, and fails the first attempt at saving each follow
+type fakeFollows struct {
+	mu       sync.Mutex
+	attempts map[string]int
+	follows  map[string]bool
+	deleted  int
+}
+
+func followKey(conf follow.Config) string {
+	return conf.FollowerUserID + "->" + conf.FolloweeUserID
+}
+
+func (r *fakeFollows) Save(conf follow.Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts[followKey(conf)]++
+	if r.attempts[followKey(conf)] == 1 {
+		return apperror.NewUnavailable("DATABASE_UNAVAILABLE", "Failed to reach the database", nil)
+	}
+
+	r.follows[followKey(conf)] = true
+
+	return nil
+}
+
+func (r *fakeFollows) Delete(conf follow.Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deleted++
+	if !r.follows[followKey(conf)] {
+		return apperror.NewNotFound("FOLLOW_NOT_FOUND", "Follow not found")
+	}
+
+	delete(r.follows, followKey(conf))
+
+	return nil
+}
+
+// produce publishes an event the way the event producer does (as an EventEnvelope), retrying while the broker is full
+func produce(b *inmemory.Broker, id string, eventType string, actor string, in proto.Message) error {
+	payload, err := anypb.New(in)
+	if err != nil {
+		return err
+	}
+
+	body, err := proto.Marshal(&producerpb.EventEnvelope{
+		ID:            id,
+		Type:          eventType,
+		SchemaVersion: 1,
+		OccurredAt:    timestamppb.Now(),
+		Actor:         actor,
+		Payload:       payload,
+	})
+	if err != nil {
+		return err
+	}
+
+	m := broker.Message{ID: id, Type: eventType, ContentType: envelopeContentType, Timestamp: time.Now(), Body: body}
+	for {
+		err := b.Publish(m)
+		if err == nil || apperror.FromError(err).Reason != "BROKER_FULL" {
+			return err
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestInMemoryPipeline produces many more events than the in-memory broker can hold while they are consumed, with some of
+// them failing once, and checks that every event is processed exactly once (none are dropped while the broker is full)
+func TestInMemoryPipeline(t *testing.T) {
+	const events = 500
+
+	b := inmemory.New(16)
+	defer b.Close()
+
+	tweets := &fakeTweets{failEvery: 7, attempts: map[string]int{}, saved: map[string]int{}}
+	s := &EventConsumerServer{
+		Subscriber:      b,
+		Publisher:       b,
+		TweetRepository: tweets,
+		EventRepository: noneProcessed{},
+		Schemas:         NewSchemaRegistry(),
+		RetryPolicy:     RetryPolicy{MaxRetries: 3, BaseDelay: 10 * time.Millisecond},
+		Concurrency:     Concurrency{Workers: 4, Prefetch: 8},
+	}
+
+	go s.Listen()
+
+	go func() {
+		for i := 0; i < events; i++ {
+			in := &producerpb.TweetConfig{UserID: fmt.Sprintf("user-%d", i%10), Text: "Hello world", CreatedAt: timestamppb.Now()}
+			err := produce(b, fmt.Sprintf("event-%d", i), "TweetCreation", "", in)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for tweets.savedCount() < events && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tweets.mu.Lock()
+	defer tweets.mu.Unlock()
+
+	if len(tweets.saved) != events {
+		t.Fatalf("%d of %d events were processed", len(tweets.saved), events)
+	}
+
+	for id, n := range tweets.saved {
+		if n != 1 {
+			t.Errorf("event %s was processed %d times", id, n)
+		}
+	}
+
+	var dead int
+	b.ScanDeadLetters(func(broker.Message) (bool, error) {
+		dead++
+		return false, nil
+	})
+	if dead != 0 {
+		t.Errorf("%d events were dead-lettered", dead)
+	}
+}
+
+// TestRetryKeepsOrder follows and then unfollows a user, with the follow failing once, and checks that the unfollow is only
+// processed once the follow was retried (so the follow does not come back after the user removed it)
+func TestRetryKeepsOrder(t *testing.T) {
+	b := inmemory.New(16)
+	defer b.Close()
+
+	follows := &fakeFollows{attempts: map[string]int{}, follows: map[string]bool{}}
+	s := &EventConsumerServer{
+		Subscriber:       b,
+		Publisher:        b,
+		FollowRepository: follows,
+		EventRepository:  noneProcessed{},
+		Schemas:          NewSchemaRegistry(),
+		RetryPolicy:      RetryPolicy{MaxRetries: 3, BaseDelay: 50 * time.Millisecond},
+		Concurrency:      Concurrency{Workers: 4, Prefetch: 8},
+	}
+
+	go s.Listen()
+
+	in := &producerpb.FollowConfig{FollowerUserID: "user-1", FolloweeUserID: "user-2", CreatedAt: timestamppb.Now()}
+	for i, eventType := range []string{"FollowCreation", "FollowDeletion"} {
+		err := produce(b, fmt.Sprintf("event-%d", i), eventType, "user-1", in)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// waits for both events to be processed (the follow once it is retried), whatever order they are processed in
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		follows.mu.Lock()
+		done := follows.deleted > 0 && follows.attempts["user-1->user-2"] > 1
+		follows.mu.Unlock()
+
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	follows.mu.Lock()
+	defer follows.mu.Unlock()
+
+	if follows.deleted == 0 || follows.attempts["user-1->user-2"] < 2 {
+		t.Fatal("events were not processed")
+	}
+
+	if len(follows.follows) != 0 {
+		t.Errorf("follow was saved after it was deleted: %v", follows.follows)
+	}
+}
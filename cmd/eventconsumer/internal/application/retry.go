@@ -0,0 +1,99 @@
+package application
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// Headers set on dead-lettered events
+const (
+	retryCountHeader   = "x-retry-count"
+	errorCodeHeader    = "x-error-code"
+	errorReasonHeader  = "x-error-reason"
+	errorMessageHeader = "x-error-message"
+	failedAtHeader     = "x-failed-at"
+)
+
+// RetryPolicy determines how many times a failed event is retried and how long to wait before each retry
+// The delay doubles with every retry (i.e., BaseDelay, 2*BaseDelay, 4*BaseDelay, ...)
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+}
+
+// DefaultRetryPolicy is used by an EventConsumerServer with no RetryPolicy
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 5, BaseDelay: time.Second}
+
+// delay returns how long to wait before the given retry (starting at 1)
+func (p RetryPolicy) delay(retry int) time.Duration {
+	return p.BaseDelay << (retry - 1)
+}
+
+func (e *EventConsumerServer) retryPolicy() RetryPolicy {
+	if e.RetryPolicy.MaxRetries <= 0 || e.RetryPolicy.BaseDelay <= 0 {
+		return DefaultRetryPolicy
+	}
+
+	return e.RetryPolicy
+}
+
+// retryable returns whether a failed event might succeed if it is processed again
+// Malformed payloads and rejected requests (e.g., invalid arguments or entities that already exist) are dead-lettered right away
+func retryable(err error) bool {
+	switch apperror.FromError(err).Kind {
+	case apperror.Internal, apperror.Unavailable, apperror.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryCount returns how many times a dead-lettered event was retried (events retried by an earlier version of the consumer,
+// which republished them, also carry the retries made so far)
+func retryCount(m broker.Message) int {
+	n, _ := strconv.Atoi(m.Headers[retryCountHeader])
+	return n
+}
+
+// processWithRetries processes a job's event, retrying it after a delay while it fails with a retryable error and has retries left,
+// and returns how many times it was retried along with its last error
+// The worker is held up while it waits, so that no later event with the same ordering key is processed before this one is settled
+func (e *EventConsumerServer) processWithRetries(j job) (int, error) {
+	retries := retryCount(j.d.Message)
+	for {
+		err := e.process(j.ev)
+		if err == nil || !retryable(err) || retries >= e.retryPolicy().MaxRetries {
+			return retries, err
+		}
+
+		retries++
+		delay := e.retryPolicy().delay(retries)
+
+		ae := apperror.FromError(err)
+		log.Printf("Retrying %s event %s in %s (retry %d): %s (code: %s, reason: %s)", j.ev.Type, j.ev.ID, delay, retries, ae.Message, ae.Kind.Code(), ae.Reason)
+		time.Sleep(delay)
+	}
+}
+
+// settle dead-letters an event that failed after the given number of retries (or could not succeed), with the failure attached as headers
+// An error is only returned if the event could not be dead-lettered, in which case the Subscriber redelivers the event so that it is not lost
+func (e *EventConsumerServer) settle(m broker.Message, retries int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	ae := apperror.FromError(err)
+
+	m = m.Clone()
+	m.Headers[errorCodeHeader] = ae.Kind.Code().String()
+	m.Headers[errorReasonHeader] = ae.Reason
+	m.Headers[errorMessageHeader] = ae.Message
+	m.Headers[retryCountHeader] = strconv.Itoa(retries)
+	m.Headers[failedAtHeader] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	return e.Publisher.DeadLetter(m)
+}
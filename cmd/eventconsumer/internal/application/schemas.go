@@ -0,0 +1,121 @@
+package application
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/event"
+	producerpb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// Content types of event payloads
+// Messages published before events were enveloped hold a JSON payload, with the event's metadata set on the message
+const (
+	envelopeContentType = "application/protobuf"
+	jsonContentType     = "application/json"
+)
+
+// idempotencyKeyHeader is set on messages published before events were enveloped, if the client provided an idempotency key
+const idempotencyKeyHeader = "idempotency-key"
+
+// payloadTypes returns a new payload of each event type's current schema (version 1)
+var payloadTypes = map[string]func() proto.Message{
+	"UserCreation":       func() proto.Message { return &producerpb.UserConfig{} },
+	"TweetCreation":      func() proto.Message { return &producerpb.TweetConfig{} },
+	"FollowCreation":     func() proto.Message { return &producerpb.FollowConfig{} },
+	"UserPasswordUpdate": func() proto.Message { return &producerpb.UserConfig{} },
+	"FollowDeletion":     func() proto.Message { return &producerpb.FollowConfig{} },
+	"TweetEdit":          func() proto.Message { return &producerpb.TweetEditConfig{} },
+	"TweetDeletion":      func() proto.Message { return &producerpb.TweetDeletionConfig{} },
+}
+
+// NewSchemaRegistry returns a registry of the schemas of every event type the EventConsumerServer handles
+// Each type only has version 1 so far: protobuf in an EventEnvelope, or JSON in a CloudEvent. The JSON payload published before
+// events were enveloped is the same message, so it is decoded as version 1 too
+func NewSchemaRegistry() *event.Registry {
+	r := event.NewRegistry()
+
+	for eventType, newPayload := range payloadTypes {
+		newPayload := newPayload
+		r.Register(eventType, 1, func(contentType string, payload []byte) (interface{}, error) {
+			m := newPayload()
+			return m, unmarshalPayload(contentType, payload, m)
+		})
+	}
+
+	return r
+}
+
+func unmarshalPayload(contentType string, payload []byte, m proto.Message) error {
+	switch contentType {
+	case envelopeContentType:
+		return proto.Unmarshal(payload, m)
+	case jsonContentType:
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(payload, m)
+	default:
+		return errors.New("Unsupported content type: " + contentType)
+	}
+}
+
+// decode reads an event from a message (in any format the event producer publishes) and decodes its payload to the latest version of its type's schema
+func (e *EventConsumerServer) decode(m broker.Message) (event.Envelope, error) {
+	switch {
+	case m.ContentType == cloudEventsContentType:
+		return e.decodeStructuredCloudEvent(m)
+	case isBinaryCloudEvent(m):
+		return e.decodeBinaryCloudEvent(m)
+	case m.ContentType == envelopeContentType:
+		return e.decodeEnvelope(m)
+	default:
+		ev := event.Envelope{ID: m.ID, Type: m.Type, IdempotencyKey: m.Headers[idempotencyKeyHeader]}
+
+		var err error
+		ev.Payload, err = e.Schemas.Decode(m.Type, 1, jsonContentType, m.Body)
+
+		return ev, err
+	}
+}
+
+func (e *EventConsumerServer) decodeEnvelope(m broker.Message) (event.Envelope, error) {
+	var env producerpb.EventEnvelope
+	err := proto.Unmarshal(m.Body, &env)
+	if err != nil {
+		return event.Envelope{}, apperror.Wrap(apperror.InvalidArgument, "INVALID_EVENT_ENVELOPE", "Failed to decode event envelope", err)
+	}
+
+	ev := event.Envelope{
+		ID:             env.ID,
+		Type:           env.Type,
+		SchemaVersion:  env.SchemaVersion,
+		OccurredAt:     fromPBTimestamp(env.OccurredAt),
+		Actor:          env.Actor,
+		TraceParent:    env.GetTraceContext().GetTraceparent(),
+		TraceState:     env.GetTraceContext().GetTracestate(),
+		IdempotencyKey: env.IdempotencyKey,
+	}
+
+	// the payload must be the message of the event type's schema, since a payload of another type may decode without error
+	newPayload, ok := payloadTypes[env.Type]
+	if ok && env.SchemaVersion == 1 && !env.GetPayload().MessageIs(newPayload()) {
+		msg := "Payload type " + env.GetPayload().GetTypeUrl() + " does not match " + env.Type + " v1"
+		return event.Envelope{}, apperror.NewInvalidArgument("PAYLOAD_TYPE_MISMATCH", msg)
+	}
+
+	ev.Payload, err = e.Schemas.Decode(env.Type, env.SchemaVersion, envelopeContentType, env.GetPayload().GetValue())
+
+	return ev, err
+}
+
+func fromPBTimestamp(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return t.AsTime()
+}
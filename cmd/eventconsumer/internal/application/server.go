@@ -1,34 +1,51 @@
 package application
 
 import (
-	"encoding/json"
 	"log"
+	"time"
 
-	"github.com/streadway/amqp"
-
+	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/event"
 	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/follow"
 	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/user"
+	pb "github.com/martinmhan/tweet-app-api/cmd/eventconsumer/proto"
+	producerpb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
 )
 
 // EventConsumerServer listens for and executes events from the message queue
+// It also serves admin methods to inspect and redrive dead-lettered events
 type EventConsumerServer struct {
-	Connection       *amqp.Connection
-	MessageQueueName string
+	pb.UnimplementedEventConsumerServer
+	Subscriber       event.Subscriber
+	Publisher        event.Publisher
 	UserRepository   user.Repository
 	FollowRepository follow.Repository
 	TweetRepository  tweet.Repository
+	EventRepository  event.Repository
+	Schemas          *event.Registry
+	RetryPolicy      RetryPolicy
+	Concurrency      Concurrency
+	Ready            func() bool // no more events are received from the Subscriber while the server's dependencies are not ready
+
+	stats consumerStats
 }
 
-func (e *EventConsumerServer) createUser(eventPayload []byte) error {
-	var conf user.Config
+func (e *EventConsumerServer) createUser(ev event.Envelope) error {
+	in := ev.Payload.(*producerpb.UserConfig)
+	conf := user.Config{
+		Username:     in.Username,
+		PasswordHash: in.PasswordHash,
+		CreatedAt:    fromPBTimestamp(in.CreatedAt),
+		EventID:      ev.Key(),
+	}
 
-	err := json.Unmarshal(eventPayload, &conf)
-	if err != nil {
-		return err
+	// events published before timestamps were set by the event producer fall back to the time they are consumed
+	if conf.CreatedAt.IsZero() {
+		conf.CreatedAt = time.Now()
 	}
 
-	_, err = e.UserRepository.Save(conf)
+	_, err := e.UserRepository.Save(conf)
 	if err != nil {
 		return err
 	}
@@ -36,15 +53,36 @@ func (e *EventConsumerServer) createUser(eventPayload []byte) error {
 	return nil
 }
 
-func (e *EventConsumerServer) createFollow(eventPayload []byte) error {
-	var f follow.Config
+func (e *EventConsumerServer) updateUserPassword(ev event.Envelope) error {
+	in := ev.Payload.(*producerpb.UserConfig)
+	conf := user.Config{
+		Username:     in.Username,
+		PasswordHash: in.PasswordHash,
+		EventID:      ev.Key(),
+	}
 
-	err := json.Unmarshal(eventPayload, &f)
+	err := e.UserRepository.UpdatePassword(conf)
 	if err != nil {
 		return err
 	}
 
-	err = e.FollowRepository.Save(f)
+	return nil
+}
+
+func (e *EventConsumerServer) createFollow(ev event.Envelope) error {
+	in := ev.Payload.(*producerpb.FollowConfig)
+	f := follow.Config{
+		FollowerUserID: in.FollowerUserID,
+		FolloweeUserID: in.FolloweeUserID,
+		CreatedAt:      fromPBTimestamp(in.CreatedAt),
+		EventID:        ev.Key(),
+	}
+
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now()
+	}
+
+	err := e.FollowRepository.Save(f)
 	if err != nil {
 		return err
 	}
@@ -52,15 +90,36 @@ func (e *EventConsumerServer) createFollow(eventPayload []byte) error {
 	return nil
 }
 
-func (e *EventConsumerServer) createTweet(eventPayload []byte) error {
-	var conf tweet.Config
+func (e *EventConsumerServer) deleteFollow(ev event.Envelope) error {
+	in := ev.Payload.(*producerpb.FollowConfig)
+	f := follow.Config{
+		FollowerUserID: in.FollowerUserID,
+		FolloweeUserID: in.FolloweeUserID,
+		EventID:        ev.Key(),
+	}
 
-	err := json.Unmarshal(eventPayload, &conf)
+	err := e.FollowRepository.Delete(f)
 	if err != nil {
 		return err
 	}
 
-	_, err = e.TweetRepository.Save(conf)
+	return nil
+}
+
+func (e *EventConsumerServer) createTweet(ev event.Envelope) error {
+	in := ev.Payload.(*producerpb.TweetConfig)
+	conf := tweet.Config{
+		UserID:    in.UserID,
+		Text:      in.Text,
+		CreatedAt: fromPBTimestamp(in.CreatedAt),
+		EventID:   ev.Key(),
+	}
+
+	if conf.CreatedAt.IsZero() {
+		conf.CreatedAt = time.Now()
+	}
+
+	_, err := e.TweetRepository.Save(conf)
 	if err != nil {
 		return err
 	}
@@ -68,60 +127,106 @@ func (e *EventConsumerServer) createTweet(eventPayload []byte) error {
 	return nil
 }
 
-// Listen starts the EventConsumerServer so that it continually listens for new events to process from the message queue
-func (e *EventConsumerServer) Listen() error {
-	ch, err := e.Connection.Channel()
-	if err != nil {
-		return err
+func (e *EventConsumerServer) editTweet(ev event.Envelope) error {
+	in := ev.Payload.(*producerpb.TweetEditConfig)
+	te := tweet.Edit{
+		TweetID:  in.TweetID,
+		UserID:   in.UserID,
+		Text:     in.Text,
+		EditedAt: fromPBTimestamp(in.EditedAt),
+		EventID:  ev.Key(),
+	}
+
+	if te.EditedAt.IsZero() {
+		te.EditedAt = time.Now()
 	}
-	defer ch.Close()
 
-	q, err := ch.QueueDeclare(
-		e.MessageQueueName,
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
+	err := e.TweetRepository.Edit(te)
 	if err != nil {
 		return err
 	}
 
-	msgs, err := ch.Consume(
-		q.Name,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	return nil
+}
+
+func (e *EventConsumerServer) deleteTweet(ev event.Envelope) error {
+	in := ev.Payload.(*producerpb.TweetDeletionConfig)
+	td := tweet.Deletion{
+		TweetID: in.TweetID,
+		UserID:  in.UserID,
+		EventID: ev.Key(),
+	}
+
+	err := e.TweetRepository.Delete(td)
 	if err != nil {
 		return err
 	}
 
-	forever := make(chan bool)
+	return nil
+}
 
-	go func() {
-		for d := range msgs {
-			log.Println("Received a message")
-			log.Printf("Message Type: %s", d.Type)
-			log.Printf("Message Body: %s", d.Body)
+// process executes an event unless it was already processed
+// Events published before events had IDs have neither an ID nor an idempotency key, so they cannot be deduplicated
+func (e *EventConsumerServer) process(ev event.Envelope) error {
+	eventID := ev.Key()
+	if eventID != "" {
+		processed, err := e.EventRepository.IsProcessed(eventID)
+		if err != nil {
+			return err
+		}
 
-			switch d.Type {
-			case "UserCreation":
-				e.createUser(d.Body)
-			case "TweetCreation":
-				e.createTweet(d.Body)
-			case "FollowCreation":
-				e.createFollow(d.Body)
-			}
+		if processed {
+			log.Printf("Skipping %s event %s: already processed", ev.Type, eventID)
+			return nil
 		}
-	}()
+	}
 
-	log.Printf("[*] Waiting for messages. To exit press CTRL+C")
-	<-forever
+	err := e.handle(ev)
+	if alreadyApplied(ev.Type, err) {
+		log.Printf("Skipping %s event %s: %s", ev.Type, eventID, err)
+		return nil
+	}
 
-	return nil
+	return err
+}
+
+// alreadyApplied returns whether an event failed only because its writes (or writes to the same effect) were already made
+func alreadyApplied(eventType string, err error) bool {
+	ae := apperror.FromError(err)
+	if ae == nil {
+		return false
+	}
+
+	switch {
+	case ae.Reason == "EVENT_ALREADY_PROCESSED":
+		return true
+	case eventType == "FollowCreation" && ae.Reason == "FOLLOW_ALREADY_EXISTS":
+		return true
+	case eventType == "FollowDeletion" && ae.Reason == "FOLLOW_NOT_FOUND":
+		return true
+	default:
+		return false
+	}
+}
+
+// handle executes an event based on its type
+func (e *EventConsumerServer) handle(ev event.Envelope) error {
+	switch ev.Type {
+	case "UserCreation":
+		return e.createUser(ev)
+	case "TweetCreation":
+		return e.createTweet(ev)
+	case "FollowCreation":
+		return e.createFollow(ev)
+	case "UserPasswordUpdate":
+		return e.updateUserPassword(ev)
+	case "FollowDeletion":
+		return e.deleteFollow(ev)
+	case "TweetEdit":
+		return e.editTweet(ev)
+	case "TweetDeletion":
+		return e.deleteTweet(ev)
+	default:
+		return apperror.NewInvalidArgument("INVALID_EVENT_TYPE", "Invalid Event Type")
+	}
 }
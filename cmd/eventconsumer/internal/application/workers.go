@@ -0,0 +1,194 @@
+package application
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/event"
+	pb "github.com/martinmhan/tweet-app-api/cmd/eventconsumer/proto"
+	producerpb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// Concurrency determines how many events an EventConsumerServer processes at once
+// Each event goes to the worker its ordering key hashes to, so events with the same key are processed one at a time (in the order
+// they were received) while events with different keys are processed in parallel. Prefetch bounds how many received events are not
+// yet settled across all workers, so that when workers fall behind, events wait in the message broker rather than in memory
+type Concurrency struct {
+	Workers  int
+	Prefetch int
+}
+
+// DefaultConcurrency is used by an EventConsumerServer with no Concurrency
+var DefaultConcurrency = Concurrency{Workers: 8, Prefetch: 64}
+
+func (e *EventConsumerServer) concurrency() Concurrency {
+	if e.Concurrency.Workers <= 0 || e.Concurrency.Prefetch <= 0 {
+		return DefaultConcurrency
+	}
+
+	return e.Concurrency
+}
+
+// a job is a decoded event waiting for (or being processed by) a worker
+type job struct {
+	ev event.Envelope
+	d  broker.Delivery
+}
+
+// consumerStats counts the events an EventConsumerServer received and processed, as reported by GetConsumerStats
+// An event's lag is how long it waited between being published (retry delays included) and a worker starting to process it
+type consumerStats struct {
+	queued    int64
+	inFlight  int64
+	processed int64
+	failed    int64
+	lastLag   int64 // nanoseconds
+	maxLag    int64 // nanoseconds
+}
+
+func (s *consumerStats) start(publishedAt time.Time) {
+	atomic.AddInt64(&s.queued, -1)
+	atomic.AddInt64(&s.inFlight, 1)
+
+	if publishedAt.IsZero() {
+		return
+	}
+
+	lag := int64(time.Since(publishedAt))
+	atomic.StoreInt64(&s.lastLag, lag)
+	for {
+		max := atomic.LoadInt64(&s.maxLag)
+		if lag <= max || atomic.CompareAndSwapInt64(&s.maxLag, max, lag) {
+			return
+		}
+	}
+}
+
+func (s *consumerStats) finish(err error) {
+	atomic.AddInt64(&s.inFlight, -1)
+	if err != nil {
+		atomic.AddInt64(&s.failed, 1)
+	} else {
+		atomic.AddInt64(&s.processed, 1)
+	}
+}
+
+// Listen starts the EventConsumerServer so that it continually listens for new events to process from its Subscriber
+// Failed events are retried with exponential backoff, and are dead-lettered (with the failure attached as headers)
+// once they run out of retries or cannot succeed. An event is retried by its worker, so the events with its ordering key
+// that were received after it wait until it succeeds or is dead-lettered
+func (e *EventConsumerServer) Listen() error {
+	c := e.concurrency()
+	queues := make([]chan job, c.Workers)
+	for i := range queues {
+		queues[i] = make(chan job, c.Prefetch)
+		go e.work(queues[i])
+	}
+
+	e.waitReady()
+	log.Printf("[*] Waiting for messages (%d workers, prefetch %d). To exit press CTRL+C", c.Workers, c.Prefetch)
+
+	return e.Subscriber.Subscribe(c.Prefetch, func(d broker.Delivery) {
+		e.receive(d, queues)
+	})
+}
+
+// receive decodes an event and queues it for the worker its ordering key hashes to
+// Queuing blocks while that worker's queue is full, and receive then blocks while the server is not ready, which stops the
+// Subscriber from receiving more events
+func (e *EventConsumerServer) receive(d broker.Delivery, queues []chan job) {
+	defer e.waitReady()
+
+	log.Println("Received a message")
+	log.Printf("Message Type: %s", d.Type)
+	log.Printf("Message ID: %s", d.ID)
+
+	ev, err := e.decode(d.Message)
+	if err != nil {
+		e.complete(d, retryCount(d.Message), err)
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(orderingKey(ev)))
+
+	atomic.AddInt64(&e.stats.queued, 1)
+	queues[h.Sum32()%uint32(len(queues))] <- job{ev: ev, d: d}
+}
+
+// waitReady blocks until the server's dependencies are ready
+func (e *EventConsumerServer) waitReady() {
+	for e.Ready != nil && !e.Ready() {
+		time.Sleep(time.Second)
+	}
+}
+
+// work processes the jobs queued for a worker one at a time, retrying each until it succeeds or is dead-lettered
+// Jobs queued before the server stopped being ready are still processed, and are retried if they fail because of it
+func (e *EventConsumerServer) work(jobs <-chan job) {
+	for j := range jobs {
+		e.stats.start(j.d.Timestamp)
+		retries, err := e.processWithRetries(j)
+		e.stats.finish(err)
+
+		e.complete(j.d, retries, err)
+	}
+}
+
+// complete settles a delivery once its event is processed (or failed to be, after the given number of retries)
+func (e *EventConsumerServer) complete(d broker.Delivery, retries int, err error) {
+	if err != nil {
+		ae := apperror.FromError(err)
+		log.Printf("Failed to process %s event: %s (code: %s, reason: %s, retries: %d)", d.Type, ae.Message, ae.Kind.Code(), ae.Reason, retries)
+	}
+
+	d.Settle(e.settle(d.Message, retries, err))
+}
+
+// orderingKey returns the key of the aggregate an event belongs to, which is the user who made it
+// Events are keyed by their actor (the UserID of the signed-in user who made them), or else by the UserID in their payload.
+// A UserCreation event has neither, since the user's ID is assigned when the user is saved; no other event of the user can be
+// made before then, so it is keyed by username
+func orderingKey(ev event.Envelope) string {
+	if ev.Actor != "" {
+		return "user:" + ev.Actor
+	}
+
+	switch in := ev.Payload.(type) {
+	case *producerpb.UserConfig:
+		return "username:" + in.Username
+	case *producerpb.TweetConfig:
+		return "user:" + in.UserID
+	case *producerpb.TweetEditConfig:
+		return "user:" + in.UserID
+	case *producerpb.TweetDeletionConfig:
+		return "user:" + in.UserID
+	case *producerpb.FollowConfig:
+		return "user:" + in.FollowerUserID
+	default:
+		return ev.Type
+	}
+}
+
+// GetConsumerStats returns how many events are queued, being processed and were processed, along with their lag
+func (e *EventConsumerServer) GetConsumerStats(ctx context.Context, in *pb.ConsumerStatsParam) (*pb.ConsumerStats, error) {
+	c := e.concurrency()
+
+	return &pb.ConsumerStats{
+		Workers:   int32(c.Workers),
+		Prefetch:  int32(c.Prefetch),
+		Queued:    atomic.LoadInt64(&e.stats.queued),
+		InFlight:  atomic.LoadInt64(&e.stats.inFlight),
+		Processed: atomic.LoadInt64(&e.stats.processed),
+		Failed:    atomic.LoadInt64(&e.stats.failed),
+		LastLag:   durationpb.New(time.Duration(atomic.LoadInt64(&e.stats.lastLag))),
+		MaxLag:    durationpb.New(time.Duration(atomic.LoadInt64(&e.stats.maxLag))),
+	}, nil
+}
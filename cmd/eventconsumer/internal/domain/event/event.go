@@ -0,0 +1,49 @@
+package event
+
+import (
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// An Envelope is an event read from the message queue, along with its metadata
+type Envelope struct {
+	ID             string
+	Type           string
+	SchemaVersion  int32 // the version of the type's schema the event was published with
+	OccurredAt     time.Time
+	Actor          string
+	TraceParent    string
+	TraceState     string
+	IdempotencyKey string
+	Payload        interface{} // decoded and upcast to the latest version of the type's schema
+}
+
+// Key returns the key an event is deduplicated by: its idempotency key (scoped to its type) if it has one, or else its ID
+func (e Envelope) Key() string {
+	if e.IdempotencyKey != "" {
+		return e.Type + ":" + e.IdempotencyKey
+	}
+
+	return e.ID
+}
+
+// Repository is the processed Event repository interface
+type Repository interface {
+	IsProcessed(eventID string) (bool, error)
+}
+
+// Subscriber is the interface of the message broker transport (e.g., RabbitMQ, embedded NATS or in-process) events are received from
+// Subscribe calls handle with each event (one at a time), leaving up to prefetch events unsettled at once,
+// and redelivers the events that are settled with an error;
+// ScanDeadLetters calls fn with each dead letter until fn returns an error, removing the dead letters it returns true for
+type Subscriber interface {
+	Subscribe(prefetch int, handle func(broker.Delivery)) error
+	ScanDeadLetters(fn func(broker.Message) (bool, error)) error
+}
+
+// Publisher is the interface of the message broker transport failed events are dead-lettered to (and redriven from)
+type Publisher interface {
+	Publish(broker.Message) error
+	DeadLetter(broker.Message) error
+}
@@ -0,0 +1,75 @@
+package event
+
+import (
+	"strconv"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// A Decoder decodes a payload (of the given content type) published with a specific version of an event type's schema
+type Decoder func(contentType string, payload []byte) (interface{}, error)
+
+// An Upcaster converts a decoded payload of one version of an event type's schema to the next version
+type Upcaster func(payload interface{}) (interface{}, error)
+
+type schema struct {
+	eventType string
+	version   int32
+}
+
+// Registry maps event types and schema versions to their decoders, and to the upcasters between consecutive versions,
+// so that events published with older versions of a schema can be consumed alongside events published with the latest one
+type Registry struct {
+	decoders  map[schema]Decoder
+	upcasters map[schema]Upcaster
+	latest    map[string]int32
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		decoders:  map[schema]Decoder{},
+		upcasters: map[schema]Upcaster{},
+		latest:    map[string]int32{},
+	}
+}
+
+// Register registers the decoder of a version of an event type's schema (the highest registered version is the latest)
+func (r *Registry) Register(eventType string, version int32, d Decoder) {
+	r.decoders[schema{eventType, version}] = d
+	if version > r.latest[eventType] {
+		r.latest[eventType] = version
+	}
+}
+
+// RegisterUpcaster registers the upcaster from a version of an event type's schema to the next version
+func (r *Registry) RegisterUpcaster(eventType string, from int32, u Upcaster) {
+	r.upcasters[schema{eventType, from}] = u
+}
+
+// Decode decodes a payload published with the given version of an event type's schema, then upcasts it to the latest version
+func (r *Registry) Decode(eventType string, version int32, contentType string, payload []byte) (interface{}, error) {
+	decode, ok := r.decoders[schema{eventType, version}]
+	if !ok {
+		return nil, apperror.NewInvalidArgument("UNKNOWN_EVENT_SCHEMA", "Unknown event schema: "+eventType+" v"+strconv.Itoa(int(version)))
+	}
+
+	p, err := decode(contentType, payload)
+	if err != nil {
+		return nil, apperror.Wrap(apperror.InvalidArgument, "INVALID_EVENT_PAYLOAD", "Failed to decode "+eventType+" payload", err)
+	}
+
+	for v := version; v < r.latest[eventType]; v++ {
+		upcast, ok := r.upcasters[schema{eventType, v}]
+		if !ok {
+			return nil, apperror.NewInvalidArgument("UNKNOWN_EVENT_SCHEMA", "No upcaster for "+eventType+" v"+strconv.Itoa(int(v)))
+		}
+
+		p, err = upcast(p)
+		if err != nil {
+			return nil, apperror.Wrap(apperror.InvalidArgument, "INVALID_EVENT_PAYLOAD", "Failed to upcast "+eventType+" payload", err)
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,94 @@
+package event
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// Versions of a test schema: v2 renamed v1's Name to Username, and v3 added a default Bio
+type userV1 struct{ Name string }
+type userV2 struct{ Username string }
+type userV3 struct{ Username, Bio string }
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+
+	r.Register("UserCreation", 1, func(contentType string, payload []byte) (interface{}, error) {
+		return userV1{Name: string(payload)}, nil
+	})
+	r.Register("UserCreation", 3, func(contentType string, payload []byte) (interface{}, error) {
+		parts := strings.SplitN(string(payload), ",", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid payload")
+		}
+
+		return userV3{Username: parts[0], Bio: parts[1]}, nil
+	})
+	r.Register("UserCreation", 2, func(contentType string, payload []byte) (interface{}, error) {
+		return userV2{Username: string(payload)}, nil
+	})
+	r.RegisterUpcaster("UserCreation", 1, func(p interface{}) (interface{}, error) {
+		return userV2{Username: p.(userV1).Name}, nil
+	})
+	r.RegisterUpcaster("UserCreation", 2, func(p interface{}) (interface{}, error) {
+		if p.(userV2).Username == "" {
+			return nil, errors.New("Missing username")
+		}
+
+		return userV3{Username: p.(userV2).Username, Bio: "(no bio)"}, nil
+	})
+
+	// TweetCreation has a v2 without an upcaster from v1
+	r.Register("TweetCreation", 1, func(contentType string, payload []byte) (interface{}, error) { return string(payload), nil })
+	r.Register("TweetCreation", 2, func(contentType string, payload []byte) (interface{}, error) { return string(payload), nil })
+
+	return r
+}
+
+// TestDecode decodes payloads of every version of a schema (whatever order the versions were registered in) and checks that
+// they are upcast to the latest version
+func TestDecode(t *testing.T) {
+	r := newTestRegistry()
+
+	tests := []struct {
+		name      string
+		eventType string
+		version   int32
+		payload   string
+		want      interface{}
+		reason    string // the reason of the expected error, if any
+	}{
+		{name: "v1 upcast twice", eventType: "UserCreation", version: 1, payload: "username1", want: userV3{Username: "username1", Bio: "(no bio)"}},
+		{name: "v2 upcast once", eventType: "UserCreation", version: 2, payload: "username1", want: userV3{Username: "username1", Bio: "(no bio)"}},
+		{name: "latest version", eventType: "UserCreation", version: 3, payload: "username1,Hello", want: userV3{Username: "username1", Bio: "Hello"}},
+		{name: "invalid payload", eventType: "UserCreation", version: 3, payload: "username1", reason: "INVALID_EVENT_PAYLOAD"},
+		{name: "failed upcast", eventType: "UserCreation", version: 1, payload: "", reason: "INVALID_EVENT_PAYLOAD"},
+		{name: "unknown version", eventType: "UserCreation", version: 4, payload: "username1", reason: "UNKNOWN_EVENT_SCHEMA"},
+		{name: "unknown type", eventType: "UserDeletion", version: 1, payload: "username1", reason: "UNKNOWN_EVENT_SCHEMA"},
+		{name: "missing upcaster", eventType: "TweetCreation", version: 1, payload: "Hello world", reason: "UNKNOWN_EVENT_SCHEMA"},
+		{name: "latest version without upcasters", eventType: "TweetCreation", version: 2, payload: "Hello world", want: "Hello world"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Decode(tt.eventType, tt.version, "text/plain", []byte(tt.payload))
+			if tt.reason != "" {
+				if ae := apperror.FromError(err); ae == nil || ae.Reason != tt.reason {
+					t.Fatalf("got error %v, want reason %s", err, tt.reason)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,26 @@
 package follow
 
+import "time"
+
 // A Follow represents a unique follower/followee relationship between two users
 type Follow struct {
 	FollowerUserID   string
 	FollowerUsername string
 	FolloweeUserID   string
 	FolloweeUsername string
+	CreatedAt        time.Time
 }
 
 // Config contains the fields necessary to create a follow
 type Config struct {
 	FollowerUserID string
 	FolloweeUserID string
+	CreatedAt      time.Time
+	EventID        string
 }
 
 // Repository is the Follower repository interface
 type Repository interface {
 	Save(Config) error
+	Delete(Config) error
 }
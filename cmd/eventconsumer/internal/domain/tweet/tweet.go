@@ -1,20 +1,43 @@
 package tweet
 
+import "time"
+
 // Tweet represents an existing tweet
 type Tweet struct {
-	ID       string
-	UserID   string
-	Username string
-	Text     string
+	ID        string
+	UserID    string
+	Username  string
+	Text      string
+	CreatedAt time.Time
 }
 
 // Config contains the fields necessary to create a tweet
 type Config struct {
-	UserID string
-	Text   string
+	UserID    string
+	Text      string
+	CreatedAt time.Time
+	EventID   string
+}
+
+// Edit contains the fields necessary to replace a tweet's text
+type Edit struct {
+	TweetID  string
+	UserID   string
+	Text     string
+	EditedAt time.Time
+	EventID  string
+}
+
+// Deletion contains the fields necessary to delete a tweet
+type Deletion struct {
+	TweetID string
+	UserID  string
+	EventID string
 }
 
 // Repository is the Tweet repository interface
 type Repository interface {
 	Save(Config) (Tweet, error)
+	Edit(Edit) error
+	Delete(Deletion) error
 }
@@ -1,19 +1,25 @@
 package user
 
+import "time"
+
 // User represents an existing user
 type User struct {
-	ID       string
-	Username string
-	Password string
+	ID           string
+	Username     string
+	PasswordHash string
+	CreatedAt    time.Time
 }
 
-// Config contains the fields necessary to create a user
+// Config contains the fields necessary to create a user (or update a user's password)
 type Config struct {
-	Username string
-	Password string
+	Username     string
+	PasswordHash string
+	CreatedAt    time.Time
+	EventID      string
 }
 
 // Repository is the user repository interface
 type Repository interface {
 	Save(Config) (User, error)
+	UpdatePassword(Config) error
 }
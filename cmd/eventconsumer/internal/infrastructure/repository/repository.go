@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 
+	"google.golang.org/protobuf/types/known/timestamppb"
+
 	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
 	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/follow"
 	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/tweet"
@@ -16,33 +18,45 @@ type UserRepository struct {
 	readviewpb.ReadViewClient
 }
 
-// Save inserts a user into the database, then updates the Read View service
+// Save inserts a user into the database (the Read View service is updated from the database's outbox)
 func (ur *UserRepository) Save(conf user.Config) (user.User, error) {
 	insertID, err := ur.DatabaseAccessClient.SaveUser(
 		context.TODO(),
-		&dbaccesspb.UserConfig{Username: conf.Username, Password: conf.Password},
+		&dbaccesspb.UserConfig{
+			Username:     conf.Username,
+			PasswordHash: conf.PasswordHash,
+			CreatedAt:    timestamppb.New(conf.CreatedAt),
+			EventID:      conf.EventID,
+		},
 	)
 	if err != nil {
 		return user.User{}, err
 	}
 
-	_, err = ur.ReadViewClient.AddUser(
+	return user.User{
+		ID:           insertID.InsertID,
+		Username:     conf.Username,
+		PasswordHash: conf.PasswordHash,
+		CreatedAt:    conf.CreatedAt,
+	}, nil
+}
+
+// UpdatePassword replaces a user's password hash in the database (the Read View service is updated from the database's outbox)
+func (ur *UserRepository) UpdatePassword(conf user.Config) error {
+	u, err := ur.ReadViewClient.GetUserByUsername(context.TODO(), &readviewpb.Username{Username: conf.Username})
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.DatabaseAccessClient.UpdateUserPassword(
 		context.TODO(),
-		&readviewpb.User{
-			ID:       insertID.InsertID,
-			Username: conf.Username,
-			Password: conf.Password,
-		},
+		&dbaccesspb.User{ID: u.ID, PasswordHash: conf.PasswordHash, EventID: conf.EventID},
 	)
 	if err != nil {
-		return user.User{}, err
+		return err
 	}
 
-	return user.User{
-		ID:       insertID.InsertID,
-		Username: conf.Username,
-		Password: conf.Password,
-	}, nil
+	return nil
 }
 
 // FollowRepository implements the follower repository
@@ -52,14 +66,15 @@ type FollowRepository struct {
 }
 
 // Save adds a new follow (i.e., follower/followee relationship between the two provided user ids)
-// to the database, then updates the Read View service
+// to the database (the Read View service is updated from the database's outbox)
+// The users are fetched from the database rather than the Read View, which may not have caught up with them yet
 func (fr *FollowRepository) Save(f follow.Config) error {
-	follower, err := fr.ReadViewClient.GetUserByUserID(context.TODO(), &readviewpb.UserID{UserID: f.FollowerUserID})
+	follower, err := fr.DatabaseAccessClient.GetUser(context.TODO(), &dbaccesspb.UserID{UserID: f.FollowerUserID})
 	if err != nil {
 		return err
 	}
 
-	followee, err := fr.ReadViewClient.GetUserByUserID(context.TODO(), &readviewpb.UserID{UserID: f.FolloweeUserID})
+	followee, err := fr.DatabaseAccessClient.GetUser(context.TODO(), &dbaccesspb.UserID{UserID: f.FolloweeUserID})
 	if err != nil {
 		return err
 	}
@@ -71,19 +86,26 @@ func (fr *FollowRepository) Save(f follow.Config) error {
 			FollowerUsername: follower.Username,
 			FolloweeUserID:   f.FolloweeUserID,
 			FolloweeUsername: followee.Username,
+			CreatedAt:        timestamppb.New(f.CreatedAt),
+			EventID:          f.EventID,
 		},
 	)
 	if err != nil {
 		return err
 	}
 
-	_, err = fr.ReadViewClient.AddFollow(
+	return nil
+}
+
+// Delete removes a follow (i.e., follower/followee relationship between the two provided user ids)
+// from the database (the Read View service is updated from the database's outbox)
+func (fr *FollowRepository) Delete(f follow.Config) error {
+	_, err := fr.DatabaseAccessClient.DeleteFollow(
 		context.TODO(),
-		&readviewpb.Follow{
-			FollowerUserID:   f.FollowerUserID,
-			FollowerUsername: follower.Username,
-			FolloweeUserID:   f.FolloweeUserID,
-			FolloweeUsername: followee.Username,
+		&dbaccesspb.Follow{
+			FollowerUserID: f.FollowerUserID,
+			FolloweeUserID: f.FolloweeUserID,
+			EventID:        f.EventID,
 		},
 	)
 	if err != nil {
@@ -99,9 +121,9 @@ type TweetRepository struct {
 	readviewpb.ReadViewClient
 }
 
-// Save inserts a tweet into the database, then updates the Read View service
+// Save inserts a tweet into the database (the Read View service is updated from the database's outbox)
 func (tr *TweetRepository) Save(conf tweet.Config) (tweet.Tweet, error) {
-	user, err := tr.ReadViewClient.GetUserByUserID(context.TODO(), &readviewpb.UserID{UserID: conf.UserID})
+	user, err := tr.DatabaseAccessClient.GetUser(context.TODO(), &dbaccesspb.UserID{UserID: conf.UserID})
 	if err != nil {
 		return tweet.Tweet{}, err
 	}
@@ -109,32 +131,70 @@ func (tr *TweetRepository) Save(conf tweet.Config) (tweet.Tweet, error) {
 	insertID, err := tr.DatabaseAccessClient.SaveTweet(
 		context.TODO(),
 		&dbaccesspb.TweetConfig{
-			UserID:   conf.UserID,
-			Username: user.Username,
-			Text:     conf.Text,
+			UserID:    conf.UserID,
+			Username:  user.Username,
+			Text:      conf.Text,
+			CreatedAt: timestamppb.New(conf.CreatedAt),
+			EventID:   conf.EventID,
 		},
 	)
 	if err != nil {
 		return tweet.Tweet{}, err
 	}
 
-	_, err = tr.ReadViewClient.AddTweet(
+	return tweet.Tweet{
+		ID:        insertID.InsertID,
+		UserID:    conf.UserID,
+		Username:  user.Username,
+		Text:      conf.Text,
+		CreatedAt: conf.CreatedAt,
+	}, nil
+}
+
+// Edit replaces a tweet's text in the database, keeping the previous text as a revision
+// (the Read View service is updated from the database's outbox)
+func (tr *TweetRepository) Edit(te tweet.Edit) error {
+	_, err := tr.DatabaseAccessClient.EditTweet(
 		context.TODO(),
-		&readviewpb.Tweet{
-			ID:       insertID.InsertID,
-			UserID:   conf.UserID,
-			Username: user.Username,
-			Text:     conf.Text,
+		&dbaccesspb.TweetEdit{
+			TweetID:  te.TweetID,
+			UserID:   te.UserID,
+			Text:     te.Text,
+			EditedAt: timestamppb.New(te.EditedAt),
+			EventID:  te.EventID,
 		},
 	)
 	if err != nil {
-		return tweet.Tweet{}, err
+		return err
 	}
 
-	return tweet.Tweet{
-		ID:       insertID.InsertID,
-		UserID:   conf.UserID,
-		Username: user.Username,
-		Text:     conf.Text,
-	}, nil
+	return nil
+}
+
+// Delete removes a tweet from the database (the Read View service is updated from the database's outbox)
+func (tr *TweetRepository) Delete(td tweet.Deletion) error {
+	_, err := tr.DatabaseAccessClient.DeleteTweet(
+		context.TODO(),
+		&dbaccesspb.TweetDeletion{TweetID: td.TweetID, UserID: td.UserID, EventID: td.EventID},
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EventRepository implements the processed event repository
+type EventRepository struct {
+	dbaccesspb.DatabaseAccessClient
+}
+
+// IsProcessed checks with the Database Access service if the writes of the event with the given ID have already been made
+func (er *EventRepository) IsProcessed(eventID string) (bool, error) {
+	res, err := er.DatabaseAccessClient.IsEventProcessed(context.TODO(), &dbaccesspb.EventID{EventID: eventID})
+	if err != nil {
+		return false, err
+	}
+
+	return res.Processed, nil
 }
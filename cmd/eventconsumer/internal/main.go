@@ -1,24 +1,33 @@
 package main
 
 import (
-	"context"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/streadway/amqp"
 	"google.golang.org/grpc"
 
 	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
 	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/application"
+	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/domain/event"
 	"github.com/martinmhan/tweet-app-api/cmd/eventconsumer/internal/infrastructure/repository"
+	pb "github.com/martinmhan/tweet-app-api/cmd/eventconsumer/proto"
 	readviewpb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+	"github.com/martinmhan/tweet-app-api/internal/broker/embeddednats"
+	"github.com/martinmhan/tweet-app-api/internal/broker/rabbitmq"
+	"github.com/martinmhan/tweet-app-api/internal/grpcclient"
+	"github.com/martinmhan/tweet-app-api/internal/readiness"
 )
 
 func main() {
 	godotenv.Load()
 
+	port := os.Getenv("EC_PORT")
 	mqHost := os.Getenv("MQ_HOST")
 	mqPort := os.Getenv("MQ_PORT")
 	mqName := os.Getenv("MQ_NAME")
@@ -26,52 +35,152 @@ func main() {
 	daPort := os.Getenv("DA_PORT")
 	rvHost := os.Getenv("RV_HOST")
 	rvPort := os.Getenv("RV_PORT")
-	if mqPort == "" || mqHost == "" || mqName == "" || daHost == "" || daPort == "" || rvHost == "" || rvPort == "" {
+	mqMaxRetries := os.Getenv("MQ_MAX_RETRIES") // optional, defaults to 5
+	mqRetryDelay := os.Getenv("MQ_RETRY_DELAY") // optional, defaults to 1s
+	mqTransport := os.Getenv("MQ_TRANSPORT")    // optional, defaults to rabbitmq
+	mqNATSPort := os.Getenv("MQ_NATS_PORT")     // optional, defaults to 4222
+	mqStoreDir := os.Getenv("MQ_STORE_DIR")     // optional, defaults to a directory in the system's temp directory
+	mqWorkers := os.Getenv("MQ_WORKERS")        // optional, defaults to 8
+	mqPrefetch := os.Getenv("MQ_PREFETCH")      // optional, defaults to 64
+	if port == "" || mqPort == "" || mqHost == "" || mqName == "" || daHost == "" || daPort == "" || rvHost == "" || rvPort == "" {
 		log.Fatal("Missing environment variable(s). Please edit .env file")
 	}
 
-	url := "amqp://guest:guest@" + mqHost + ":" + mqPort + "/"
-	conn, err := amqp.Dial(url)
+	retryPolicy := application.DefaultRetryPolicy
+	if mqMaxRetries != "" {
+		n, err := strconv.Atoi(mqMaxRetries)
+		if err != nil || n <= 0 {
+			log.Fatal("Invalid MQ_MAX_RETRIES: ", mqMaxRetries)
+		}
+		retryPolicy.MaxRetries = n
+	}
+
+	if mqRetryDelay != "" {
+		d, err := time.ParseDuration(mqRetryDelay)
+		if err != nil || d <= 0 {
+			log.Fatal("Invalid MQ_RETRY_DELAY: ", mqRetryDelay)
+		}
+		retryPolicy.BaseDelay = d
+	}
+
+	concurrency := application.DefaultConcurrency
+	if mqWorkers != "" {
+		n, err := strconv.Atoi(mqWorkers)
+		if err != nil || n <= 0 {
+			log.Fatal("Invalid MQ_WORKERS: ", mqWorkers)
+		}
+		concurrency.Workers = n
+	}
+
+	if mqPrefetch != "" {
+		n, err := strconv.Atoi(mqPrefetch)
+		if err != nil || n <= 0 {
+			log.Fatal("Invalid MQ_PREFETCH: ", mqPrefetch)
+		}
+		concurrency.Prefetch = n
+	}
+
+	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
-		log.Fatal("Failed to connect to RabbitMQ")
+		log.Fatal("Event Consumer failed to listen: ", err)
 	}
 
-	defer conn.Close()
+	var sub event.Subscriber
+	var pub event.Publisher
+	var brokerReady readiness.Check
+
+	switch mqTransport {
+	case "", broker.RabbitMQ:
+		b := rabbitmq.Dial(mqHost, mqPort, mqName)
+		defer b.Close()
+
+		sub, pub, brokerReady = b, b, b.IsConnected
+	case broker.EmbeddedNATS:
+		// the Event Consumer runs the NATS server, which the Event Producer connects to
+		if mqNATSPort == "" {
+			mqNATSPort = "4222"
+		}
+
+		natsPort, err := strconv.Atoi(mqNATSPort)
+		if err != nil {
+			log.Fatal("Invalid MQ_NATS_PORT: ", mqNATSPort)
+		}
+
+		if mqStoreDir == "" {
+			mqStoreDir = filepath.Join(os.TempDir(), "tweet-app-api-nats")
+		}
 
-	daTarget := daHost + ":" + daPort
-	daCtx, daCancel := context.WithTimeout(context.TODO(), 1000*time.Millisecond)
-	defer daCancel()
+		ns, err := embeddednats.RunServer(mqHost, natsPort, mqStoreDir)
+		if err != nil {
+			log.Fatal("Failed to start NATS server: ", err)
+		}
 
-	daConn, err := grpc.DialContext(daCtx, daTarget, grpc.WithInsecure(), grpc.WithBlock())
+		defer ns.Shutdown()
+
+		b, err := embeddednats.Connect(mqHost, mqNATSPort, mqName)
+		if err != nil {
+			log.Fatal("Failed to connect to NATS: ", err)
+		}
+
+		defer b.Close()
+
+		sub, pub, brokerReady = b, b, b.IsConnected
+	case broker.InMemory:
+		// the in-memory broker only delivers events within a process, so no events from the Event Producer would be received
+		log.Fatal("MQ_TRANSPORT=inmemory only works when the Event Producer and Consumer run in one process (e.g., in tests). Use nats to run the services without RabbitMQ")
+	default:
+		log.Fatal("Invalid MQ_TRANSPORT: ", mqTransport)
+	}
+
+	daConn, err := grpcclient.Dial(daHost + ":" + daPort)
 	if err != nil {
 		log.Fatal("Could not connect to database access server")
 	}
 	defer daConn.Close()
 
-	rvTarget := rvHost + ":" + rvPort
-	rvCtx, rvCancel := context.WithTimeout(context.TODO(), 1000*time.Millisecond)
-	defer rvCancel()
-
-	rvConn, err := grpc.DialContext(rvCtx, rvTarget, grpc.WithInsecure(), grpc.WithBlock())
+	rvConn, err := grpcclient.Dial(rvHost + ":" + rvPort)
 	if err != nil {
-		log.Fatal("Could not connect to database access server")
+		log.Fatal("Could not connect to read view server")
 	}
 	defer rvConn.Close()
 
+	gate := readiness.NewGate(brokerReady, grpcclient.Ready(daConn), grpcclient.Ready(rvConn))
+	go gate.Run()
+
 	daClient := dbaccesspb.NewDatabaseAccessClient(daConn)
 	rvClient := readviewpb.NewReadViewClient(rvConn)
 
 	ur := repository.UserRepository{DatabaseAccessClient: daClient, ReadViewClient: rvClient}
 	fr := repository.FollowRepository{DatabaseAccessClient: daClient, ReadViewClient: rvClient}
 	tr := repository.TweetRepository{DatabaseAccessClient: daClient, ReadViewClient: rvClient}
+	er := repository.EventRepository{DatabaseAccessClient: daClient}
 
 	s := &application.EventConsumerServer{
-		Connection:       conn,
-		MessageQueueName: mqName,
+		Subscriber:       sub,
+		Publisher:        pub,
 		UserRepository:   &ur,
 		FollowRepository: &fr,
 		TweetRepository:  &tr,
+		EventRepository:  &er,
+		Schemas:          application.NewSchemaRegistry(),
+		RetryPolicy:      retryPolicy,
+		Concurrency:      concurrency,
+		Ready:            gate.Ready,
 	}
 
-	s.Listen()
+	go func() {
+		err := s.Listen()
+		if err != nil {
+			log.Fatal("Event Consumer failed to listen to the message queue: ", err)
+		}
+	}()
+
+	g := grpc.NewServer()
+	gate.Register(g)
+	pb.RegisterEventConsumerServer(g, s)
+
+	err = g.Serve(lis)
+	if err != nil {
+		log.Fatal("Failed to start Event Consumer server: ", err)
+	}
 }
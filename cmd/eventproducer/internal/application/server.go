@@ -2,6 +2,10 @@ package application
 
 import (
 	"context"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/martinmhan/tweet-app-api/cmd/eventproducer/internal/domain/event"
 	pb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
@@ -15,10 +19,11 @@ type EventProducerServer struct {
 
 // ProduceUserCreation publishes a UserCreation event to the message queue
 func (s *EventProducerServer) ProduceUserCreation(ctx context.Context, in *pb.UserConfig) (*pb.SimpleResponse, error) {
-	e := event.Event{Type: event.UserCreation, Payload: in}
+	in.CreatedAt = timestamppb.Now()
+	e := newEvent(ctx, event.UserCreation, in)
 	err := s.Produce(e)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "User creation failed"}, err
+		return nil, err
 	}
 
 	return &pb.SimpleResponse{Message: "User creation accepted"}, nil
@@ -26,10 +31,11 @@ func (s *EventProducerServer) ProduceUserCreation(ctx context.Context, in *pb.Us
 
 // ProduceTweetCreation publishes a TweetCreation event to the message queue
 func (s *EventProducerServer) ProduceTweetCreation(ctx context.Context, in *pb.TweetConfig) (*pb.SimpleResponse, error) {
-	e := event.Event{Type: event.TweetCreation, Payload: in}
+	in.CreatedAt = timestamppb.Now()
+	e := newEvent(ctx, event.TweetCreation, in)
 	err := s.Produce(e)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Tweet creation failed"}, err
+		return nil, err
 	}
 
 	return &pb.SimpleResponse{Message: "Tweet creation accepted"}, nil
@@ -37,11 +43,86 @@ func (s *EventProducerServer) ProduceTweetCreation(ctx context.Context, in *pb.T
 
 // ProduceFollowCreation publishes a FollowCreation event to the message queue
 func (s *EventProducerServer) ProduceFollowCreation(ctx context.Context, in *pb.FollowConfig) (*pb.SimpleResponse, error) {
-	e := event.Event{Type: event.FollowCreation, Payload: in}
+	in.CreatedAt = timestamppb.Now()
+	e := newEvent(ctx, event.FollowCreation, in)
 	err := s.Produce(e)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Follow creation failed"}, err
+		return nil, err
 	}
 
 	return &pb.SimpleResponse{Message: "Follow creation accepted"}, nil
 }
+
+// ProduceUserPasswordUpdate publishes a UserPasswordUpdate event to the message queue
+func (s *EventProducerServer) ProduceUserPasswordUpdate(ctx context.Context, in *pb.UserConfig) (*pb.SimpleResponse, error) {
+	e := newEvent(ctx, event.UserPasswordUpdate, in)
+	err := s.Produce(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "User password update accepted"}, nil
+}
+
+// ProduceFollowDeletion publishes a FollowDeletion event to the message queue
+func (s *EventProducerServer) ProduceFollowDeletion(ctx context.Context, in *pb.FollowConfig) (*pb.SimpleResponse, error) {
+	e := newEvent(ctx, event.FollowDeletion, in)
+	err := s.Produce(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Follow deletion accepted"}, nil
+}
+
+// ProduceTweetEdit publishes a TweetEdit event to the message queue
+func (s *EventProducerServer) ProduceTweetEdit(ctx context.Context, in *pb.TweetEditConfig) (*pb.SimpleResponse, error) {
+	in.EditedAt = timestamppb.Now()
+	e := newEvent(ctx, event.TweetEdit, in)
+	err := s.Produce(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Tweet edit accepted"}, nil
+}
+
+// ProduceTweetDeletion publishes a TweetDeletion event to the message queue
+func (s *EventProducerServer) ProduceTweetDeletion(ctx context.Context, in *pb.TweetDeletionConfig) (*pb.SimpleResponse, error) {
+	e := newEvent(ctx, event.TweetDeletion, in)
+	err := s.Produce(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SimpleResponse{Message: "Tweet deletion accepted"}, nil
+}
+
+// Request metadata keys the API gateway uses to pass on information about the client's request
+const (
+	idempotencyKeyHeader = "idempotency-key"
+	actorHeader          = "actor"
+	traceparentHeader    = "traceparent"
+	tracestateHeader     = "tracestate"
+)
+
+// newEvent returns an event with a new ID, along with the idempotency key, actor and trace context of the request (if any)
+func newEvent(ctx context.Context, t event.Type, payload interface{}) event.Event {
+	e := event.Event{ID: event.NewID(), Type: t, Payload: payload, OccurredAt: time.Now()}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	e.IdempotencyKey = first(md.Get(idempotencyKeyHeader))
+	e.Actor = first(md.Get(actorHeader))
+	e.TraceParent = first(md.Get(traceparentHeader))
+	e.TraceState = first(md.Get(tracestateHeader))
+
+	return e
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
@@ -1,9 +1,34 @@
 package event
 
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
 // An Event contains the information passed to the message queue to publish an event
+// Consumers deduplicate events by their IdempotencyKey (if the client provided one) or else by their ID
 type Event struct {
-	Type    Type
-	Payload interface{}
+	ID             string
+	Type           Type
+	Payload        interface{}
+	IdempotencyKey string
+	OccurredAt     time.Time
+	Actor          string
+	TraceParent    string
+	TraceState     string
+}
+
+// NewID returns a random (version 4) UUID to identify an event
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
 // Type specifies the type of event to pass to the message queue
@@ -16,6 +41,14 @@ const (
 	TweetCreation
 	// FollowCreation is an event type that creates a Follow
 	FollowCreation
+	// UserPasswordUpdate is an event type that replaces a User's password hash
+	UserPasswordUpdate
+	// FollowDeletion is an event type that deletes a Follow
+	FollowDeletion
+	// TweetEdit is an event type that replaces a Tweet's text (keeping the previous text as a revision)
+	TweetEdit
+	// TweetDeletion is an event type that deletes a Tweet
+	TweetDeletion
 )
 
 func (t Type) String() string {
@@ -23,12 +56,37 @@ func (t Type) String() string {
 		"UserCreation",
 		"TweetCreation",
 		"FollowCreation",
+		"UserPasswordUpdate",
+		"FollowDeletion",
+		"TweetEdit",
+		"TweetDeletion",
 	}
 
 	return types[t]
 }
 
+// SchemaVersion returns the current version of the type's payload schema
+// Bump it (and register an upcaster in the event consumer) whenever the payload changes in a way consumers must handle differently
+func (t Type) SchemaVersion() int32 {
+	versions := [...]int32{
+		1, // UserCreation
+		1, // TweetCreation
+		1, // FollowCreation
+		1, // UserPasswordUpdate
+		1, // FollowDeletion
+		1, // TweetEdit
+		1, // TweetDeletion
+	}
+
+	return versions[t]
+}
+
 // Producer is the event producer interface
 type Producer interface {
 	Produce(Event) error
 }
+
+// Publisher is the interface of the message broker transport (e.g., RabbitMQ, embedded NATS or in-process) events are published to
+type Publisher interface {
+	Publish(broker.Message) error
+}
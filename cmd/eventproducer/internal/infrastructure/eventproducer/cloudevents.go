@@ -0,0 +1,101 @@
+package eventproducer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/martinmhan/tweet-app-api/cmd/eventproducer/internal/domain/event"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// CloudEvents 1.0 AMQP binding (https://github.com/cloudevents/spec/blob/v1.0/amqp-protocol-binding.md)
+const (
+	cloudEventsSpecVersion  = "1.0"
+	cloudEventsSource       = "/tweet-app-api/eventproducer"
+	cloudEventsTypePrefix   = "com.github.martinmhan.tweetapp."
+	cloudEventsHeaderPrefix = "cloudEvents:"
+	cloudEventsContentType  = "application/cloudevents+json"
+)
+
+// cloudEventAttributes returns an event's CloudEvents context attributes (other than datacontenttype, which is always application/json)
+// The schema version, actor and idempotency key are extension attributes, as are traceparent and tracestate (the Distributed Tracing extension)
+func cloudEventAttributes(e event.Event) map[string]interface{} {
+	attrs := map[string]interface{}{
+		"specversion":   cloudEventsSpecVersion,
+		"id":            e.ID,
+		"source":        cloudEventsSource,
+		"type":          cloudEventsTypePrefix + e.Type.String(),
+		"time":          e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		"schemaversion": e.Type.SchemaVersion(),
+	}
+
+	optional := map[string]string{
+		"actor":          e.Actor,
+		"idempotencykey": e.IdempotencyKey,
+		"traceparent":    e.TraceParent,
+		"tracestate":     e.TraceState,
+	}
+
+	for k, v := range optional {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+
+	return attrs
+}
+
+// marshalCloudEventData encodes an event's payload as the JSON data of a CloudEvent
+func marshalCloudEventData(e event.Event) ([]byte, error) {
+	m, ok := e.Payload.(proto.Message)
+	if !ok {
+		return nil, apperror.New(apperror.Internal, "INVALID_EVENT_PAYLOAD", "Event payload is not a protobuf message")
+	}
+
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, apperror.Wrap(apperror.Internal, "INVALID_EVENT_PAYLOAD", "Failed to marshal event payload", err)
+	}
+
+	return data, nil
+}
+
+// cloudEventBinaryMessage encodes an event in the CloudEvents binary content mode:
+// each attribute is a header (prefixed with "cloudEvents:"), datacontenttype is the content type and the data is the body
+func cloudEventBinaryMessage(e event.Event) (broker.Message, error) {
+	data, err := marshalCloudEventData(e)
+	if err != nil {
+		return broker.Message{}, err
+	}
+
+	headers := map[string]string{}
+	for k, v := range cloudEventAttributes(e) {
+		headers[cloudEventsHeaderPrefix+k] = fmt.Sprint(v)
+	}
+
+	return broker.Message{ContentType: "application/json", Headers: headers, Body: data}, nil
+}
+
+// cloudEventStructuredMessage encodes an event in the CloudEvents structured content mode: the body is the whole event in the JSON event format
+func cloudEventStructuredMessage(e event.Event) (broker.Message, error) {
+	data, err := marshalCloudEventData(e)
+	if err != nil {
+		return broker.Message{}, err
+	}
+
+	ce := cloudEventAttributes(e)
+	ce["datacontenttype"] = "application/json"
+	ce["data"] = json.RawMessage(data)
+
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return broker.Message{}, apperror.Wrap(apperror.Internal, "INVALID_EVENT_PAYLOAD", "Failed to marshal CloudEvent", err)
+	}
+
+	return broker.Message{ContentType: cloudEventsContentType, Body: body}, nil
+}
@@ -1,66 +1,109 @@
 package eventproducer
 
 import (
-	"encoding/json"
-	"errors"
-
-	"github.com/streadway/amqp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/martinmhan/tweet-app-api/cmd/eventproducer/internal/domain/event"
+	pb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// Format is the format events are published in
+type Format string
+
+const (
+	// EnvelopeFormat publishes events as a protobuf EventEnvelope
+	EnvelopeFormat Format = "envelope"
+	// CloudEventsBinaryFormat publishes events in the CloudEvents binary content mode (attributes as headers, JSON data as the body)
+	CloudEventsBinaryFormat Format = "cloudevents-binary"
+	// CloudEventsStructuredFormat publishes events in the CloudEvents structured content mode (a JSON CloudEvent as the body)
+	CloudEventsStructuredFormat Format = "cloudevents-structured"
 )
 
-// EventProducer produces events by publishing message queue
+// ParseFormat returns the Format of the given name (an empty name is the EnvelopeFormat)
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case "":
+		return EnvelopeFormat, nil
+	case EnvelopeFormat, CloudEventsBinaryFormat, CloudEventsStructuredFormat:
+		return f, nil
+	default:
+		return "", apperror.NewInvalidArgument("INVALID_EVENT_FORMAT", "Invalid event format: "+name)
+	}
+}
+
+// EventProducer produces events by encoding them in its format and publishing them to the message queue via its Publisher
+// An event is only considered produced once the Publisher has published it durably (e.g., once RabbitMQ has confirmed it)
 type EventProducer struct {
-	MessageQueueName string
-	Connection       *amqp.Connection
+	Publisher event.Publisher
+	Format    Format
 }
 
 // Produce publishes an event to the message queue
 func (p *EventProducer) Produce(e event.Event) error {
-	if p.Connection.IsClosed() {
-		return errors.New("EventProducer is not connected")
-	}
-
 	if e.Type.String() == "" {
-		return errors.New("Invalid Event Type")
+		return apperror.NewInvalidArgument("INVALID_EVENT_TYPE", "Invalid Event Type")
 	}
 
-	ch, err := p.Connection.Channel()
+	m, err := p.message(e)
 	if err != nil {
 		return err
 	}
 
-	defer ch.Close()
+	// the event's type and ID are set on every format's message, so they can be read without decoding it
+	m.Type = e.Type.String()
+	m.ID = e.ID
+	m.Timestamp = e.OccurredAt
+
+	return p.Publisher.Publish(m)
+}
+
+// message encodes an event in the EventProducer's format
+func (p *EventProducer) message(e event.Event) (broker.Message, error) {
+	switch p.Format {
+	case CloudEventsBinaryFormat:
+		return cloudEventBinaryMessage(e)
+	case CloudEventsStructuredFormat:
+		return cloudEventStructuredMessage(e)
+	default:
+		body, err := marshalEnvelope(e)
+		return broker.Message{ContentType: "application/protobuf", Body: body}, err
+	}
+}
+
+// marshalEnvelope encodes an event as a protobuf EventEnvelope
+func marshalEnvelope(e event.Event) ([]byte, error) {
+	m, ok := e.Payload.(proto.Message)
+	if !ok {
+		return nil, apperror.New(apperror.Internal, "INVALID_EVENT_PAYLOAD", "Event payload is not a protobuf message")
+	}
 
-	q, err := ch.QueueDeclare(
-		p.MessageQueueName, // name
-		false,              // durable
-		false,              // delete when unused
-		false,              // exclusive
-		false,              // no-wait
-		nil,                // arguments
-	)
+	payload, err := anypb.New(m)
 	if err != nil {
-		return err
+		return nil, apperror.Wrap(apperror.Internal, "INVALID_EVENT_PAYLOAD", "Failed to marshal event payload", err)
 	}
 
-	b := &e.Payload
-	body, err := json.Marshal(b)
+	env := &pb.EventEnvelope{
+		ID:             e.ID,
+		Type:           e.Type.String(),
+		SchemaVersion:  e.Type.SchemaVersion(),
+		OccurredAt:     timestamppb.New(e.OccurredAt),
+		Actor:          e.Actor,
+		Payload:        payload,
+		IdempotencyKey: e.IdempotencyKey,
+	}
+
+	if e.TraceParent != "" {
+		env.TraceContext = &pb.TraceContext{Traceparent: e.TraceParent, Tracestate: e.TraceState}
+	}
+
+	body, err := proto.Marshal(env)
 	if err != nil {
-		return err
+		return nil, apperror.Wrap(apperror.Internal, "INVALID_EVENT_PAYLOAD", "Failed to marshal event envelope", err)
 	}
 
-	err = ch.Publish(
-		"",
-		q.Name,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Type:        e.Type.String(),
-			Body:        body,
-		},
-	)
-
-	return err
+	return body, nil
 }
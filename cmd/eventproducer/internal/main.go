@@ -4,14 +4,18 @@ import (
 	"log"
 	"net"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/streadway/amqp"
 	"google.golang.org/grpc"
 
 	"github.com/martinmhan/tweet-app-api/cmd/eventproducer/internal/application"
 	"github.com/martinmhan/tweet-app-api/cmd/eventproducer/internal/infrastructure/eventproducer"
 	pb "github.com/martinmhan/tweet-app-api/cmd/eventproducer/proto"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+	"github.com/martinmhan/tweet-app-api/internal/broker/embeddednats"
+	"github.com/martinmhan/tweet-app-api/internal/broker/rabbitmq"
+	"github.com/martinmhan/tweet-app-api/internal/readiness"
 )
 
 func main() {
@@ -21,30 +25,70 @@ func main() {
 	mqHost := os.Getenv("MQ_HOST")
 	mqPort := os.Getenv("MQ_PORT")
 	mqName := os.Getenv("MQ_NAME")
+	mqConfirmTimeout := os.Getenv("MQ_CONFIRM_TIMEOUT") // optional, defaults to 5s
+	mqEventFormat := os.Getenv("MQ_EVENT_FORMAT")       // optional, defaults to envelope
+	mqTransport := os.Getenv("MQ_TRANSPORT")            // optional, defaults to rabbitmq
+	mqNATSPort := os.Getenv("MQ_NATS_PORT")             // optional, defaults to 4222
 	if port == "" || mqPort == "" || mqHost == "" || mqName == "" {
 		log.Fatal("Missing environment variable(s). Please edit .env file")
 	}
 
-	lis, err := net.Listen("tcp", ":"+port)
+	confirmTimeout := rabbitmq.DefaultConfirmTimeout
+	if mqConfirmTimeout != "" {
+		d, err := time.ParseDuration(mqConfirmTimeout)
+		if err != nil {
+			log.Fatal("Invalid MQ_CONFIRM_TIMEOUT: ", err)
+		}
+		confirmTimeout = d
+	}
+
+	format, err := eventproducer.ParseFormat(mqEventFormat)
 	if err != nil {
-		log.Fatal("Event Producer failed to listen: ", err)
+		log.Fatal("Invalid MQ_EVENT_FORMAT: ", err)
 	}
 
-	url := "amqp://guest:guest@" + mqHost + ":" + mqPort + "/"
-	conn, err := amqp.Dial(url)
+	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
-		log.Fatal("Failed to connect to RabbitMQ")
+		log.Fatal("Event Producer failed to listen: ", err)
 	}
 
-	defer conn.Close()
+	ep := eventproducer.EventProducer{Format: format}
+	var brokerReady readiness.Check
 
-	ep := eventproducer.EventProducer{
-		MessageQueueName: mqName,
-		Connection:       conn,
+	switch mqTransport {
+	case "", broker.RabbitMQ:
+		b := rabbitmq.Dial(mqHost, mqPort, mqName)
+		defer b.Close()
+
+		b.ConfirmTimeout = confirmTimeout
+		ep.Publisher, brokerReady = b, b.IsConnected
+	case broker.EmbeddedNATS:
+		// the event consumer runs the NATS server (the connection keeps retrying until it is up)
+		if mqNATSPort == "" {
+			mqNATSPort = "4222"
+		}
+
+		b, err := embeddednats.Connect(mqHost, mqNATSPort, mqName)
+		if err != nil {
+			log.Fatal("Failed to connect to NATS: ", err)
+		}
+
+		defer b.Close()
+
+		ep.Publisher, brokerReady = b, b.IsConnected
+	case broker.InMemory:
+		// the in-memory broker only delivers events within a process, so the Event Consumer would never receive them
+		log.Fatal("MQ_TRANSPORT=inmemory only works when the Event Producer and Consumer run in one process (e.g., in tests). Use nats to run the services without RabbitMQ")
+	default:
+		log.Fatal("Invalid MQ_TRANSPORT: ", mqTransport)
 	}
 
 	s := &application.EventProducerServer{Producer: &ep}
+	gate := readiness.NewGate(brokerReady)
+	go gate.Run()
+
 	g := grpc.NewServer()
+	gate.Register(g)
 	pb.RegisterEventProducerServer(g, s)
 
 	err = g.Serve(lis)
@@ -0,0 +1,254 @@
+package application
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/datastore"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker/rabbitmq"
+)
+
+// resyncDelay is how long the ChangeListener waits before subscribing and loading the data store again after a failure
+const resyncDelay = time.Second
+
+// positionHeader holds the event store position of the event a change projects, as set by the DatabaseAccess service
+const positionHeader = "x-event-position"
+
+// ChangeListener applies the changes published by the DatabaseAccess service's outbox relay to the data store
+// Changes hold the state of the changed entity and are applied as upserts (or idempotent removals),
+// so a change that is received again, or that is already part of the data store's initial load, leaves the data store as it is
+type ChangeListener struct {
+	Connection   *rabbitmq.Supervisor
+	ExchangeName string
+	Datastore    datastore.Datastore
+	Load         func() error // optional, loads the data store (defaults to initializing it)
+
+	synced int32
+	mu     sync.Mutex // held while a change is applied
+}
+
+// Run keeps the data store in sync with the database until the connection to the message queue is closed:
+// it subscribes to changes, loads the data store, then applies changes (in the order they were published)
+// The change queue is exclusive to the connection, so changes published while disconnected are lost;
+// whenever the connection is lost, Run waits for it to be back and subscribes and loads the data store again
+func (l *ChangeListener) Run() {
+	for l.Connection.Wait() {
+		ch, msgs, err := l.subscribe()
+		if err != nil {
+			log.Printf("Failed to subscribe to database changes: %s", err)
+			time.Sleep(resyncDelay)
+			continue
+		}
+
+		// the queue is bound before the data store is loaded so that changes made during the load are applied after it
+		err = l.load()
+		if err != nil {
+			log.Printf("Failed to load data store: %s", err)
+			ch.Close()
+			time.Sleep(resyncDelay)
+			continue
+		}
+
+		atomic.StoreInt32(&l.synced, 1)
+		l.listen(msgs)
+		atomic.StoreInt32(&l.synced, 0)
+
+		log.Println("Stopped receiving database changes, resubscribing")
+	}
+}
+
+func (l *ChangeListener) load() error {
+	if l.Load != nil {
+		return l.Load()
+	}
+
+	return l.Datastore.Initialize()
+}
+
+// Synced returns whether the data store is loaded and receiving changes
+func (l *ChangeListener) Synced() bool {
+	return atomic.LoadInt32(&l.synced) == 1
+}
+
+// Hold runs fn while no change is being applied, holding the changes received meanwhile until fn returns
+func (l *ChangeListener) Hold(fn func() error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return fn()
+}
+
+// subscribe opens a channel and starts consuming changes on it
+func (l *ChangeListener) subscribe() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := l.Connection.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs, err := l.consume(ch)
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	return ch, msgs, nil
+}
+
+// consume binds a queue (exclusive to this Read View instance) to the change exchange and starts consuming it
+func (l *ChangeListener) consume(ch *amqp.Channel) (<-chan amqp.Delivery, error) {
+	err := ch.ExchangeDeclare(l.ExchangeName, "fanout", true, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ch.QueueBind(q.Name, "", l.ExchangeName, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ch.Qos(1, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return ch.Consume(q.Name, "", false, true, false, false, nil)
+}
+
+// listen applies changes until the channel is closed
+// A change that cannot be applied is logged and dropped since applying it again would fail the same way
+func (l *ChangeListener) listen(msgs <-chan amqp.Delivery) {
+	for d := range msgs {
+		l.mu.Lock()
+		err := l.apply(d)
+		if err != nil {
+			ae := apperror.FromError(err)
+			log.Printf("Failed to apply %s change %s: %s (code: %s, reason: %s)", d.Type, d.MessageId, ae.Message, ae.Kind.Code(), ae.Reason)
+		}
+
+		// changes recorded in the event store carry the position of their event, which the data store has now caught up to
+		if position, ok := d.Headers[positionHeader].(int64); ok {
+			l.Datastore.Advance(position)
+		}
+		l.mu.Unlock()
+
+		err = d.Ack(false)
+		if err != nil {
+			log.Printf("Failed to acknowledge %s change %s: %s", d.Type, d.MessageId, err)
+		}
+	}
+}
+
+// apply decodes a change published by the outbox relay and applies it to the data store
+func (l *ChangeListener) apply(d amqp.Delivery) error {
+	unmarshal := protojson.UnmarshalOptions{DiscardUnknown: true}
+
+	var in proto.Message
+	switch d.Type {
+	case "UserSaved":
+		in = &dbaccesspb.User{}
+	case "FollowSaved", "FollowDeleted":
+		in = &dbaccesspb.Follow{}
+	case "TweetSaved":
+		in = &dbaccesspb.Tweet{}
+	case "TweetDeleted":
+		in = &dbaccesspb.TweetDeletion{}
+	default:
+		return apperror.NewInvalidArgument("INVALID_CHANGE_TYPE", "Invalid change type")
+	}
+
+	err := unmarshal.Unmarshal(d.Body, in)
+	if err != nil {
+		return apperror.Wrap(apperror.InvalidArgument, "INVALID_CHANGE_PAYLOAD", "Invalid change payload", err)
+	}
+
+	return applyChange(l.Datastore, d.Type, in)
+}
+
+// applyChange applies a change (holding the changed entity as it is returned by the DatabaseAccess service) to a data store
+func applyChange(ds datastore.Datastore, t string, payload proto.Message) error {
+	switch in := payload.(type) {
+	case *dbaccesspb.User:
+		u := user.User{
+			ID:           user.ID(in.ID),
+			Username:     in.Username,
+			PasswordHash: in.PasswordHash,
+			CreatedAt:    fromPBTimestamp(in.CreatedAt),
+		}
+
+		_, err := ds.GetUserByUserID(u.ID)
+		if apperror.Is(err, apperror.NotFound) {
+			return ds.AddUser(u)
+		}
+
+		return ds.UpdateUser(u)
+	case *dbaccesspb.Follow:
+		if t == "FollowDeleted" {
+			err := ds.RemoveFollow(user.ID(in.FollowerUserID), user.ID(in.FolloweeUserID))
+			if apperror.Is(err, apperror.NotFound) {
+				return nil
+			}
+
+			return err
+		}
+
+		f := follow.Follow{
+			FollowerUserID:   user.ID(in.FollowerUserID),
+			FollowerUsername: in.FollowerUsername,
+			FolloweeUserID:   user.ID(in.FolloweeUserID),
+			FolloweeUsername: in.FolloweeUsername,
+			CreatedAt:        fromPBTimestamp(in.CreatedAt),
+		}
+
+		_, err := ds.GetFollow(f.FollowerUserID, f.FolloweeUserID)
+		if apperror.Is(err, apperror.NotFound) {
+			return ds.AddFollow(f)
+		}
+
+		return err
+	case *dbaccesspb.Tweet:
+		tw := tweet.Tweet{
+			ID:        in.ID,
+			UserID:    user.ID(in.UserID),
+			Username:  in.Username,
+			Text:      in.Text,
+			CreatedAt: fromPBTimestamp(in.CreatedAt),
+			EditedAt:  fromPBTimestamp(in.EditedAt),
+		}
+
+		for _, r := range in.Revisions {
+			tw.Revisions = append(tw.Revisions, tweet.Revision{Text: r.Text, CreatedAt: fromPBTimestamp(r.CreatedAt)})
+		}
+
+		_, err := ds.GetTweet(tw.ID)
+		if apperror.Is(err, apperror.NotFound) {
+			return ds.AddTweet(tw)
+		}
+
+		return ds.UpdateTweet(tw)
+	case *dbaccesspb.TweetDeletion:
+		err := ds.RemoveTweet(in.TweetID)
+		if apperror.Is(err, apperror.NotFound) {
+			return nil
+		}
+
+		return err
+	default:
+		return apperror.NewInvalidArgument("INVALID_CHANGE_PAYLOAD", "Invalid change payload")
+	}
+}
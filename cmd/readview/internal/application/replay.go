@@ -0,0 +1,223 @@
+package application
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/datastore"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/event"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+	pb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// replayBatchSize is how many events are read from the event store at once
+const replayBatchSize = 500
+
+// Replayer applies events from the Database Access service's event store to the data store
+// It can replay events onto the live data store, or rebuild a fresh data store beside it (from the event store, or from
+// the database and then the events recorded since) and swap it in once it has caught up, so reads are served throughout
+type Replayer struct {
+	Datastore datastore.Datastore
+	Events    event.Repository
+	Syncer    Syncer // optional, its changes are held while a rebuilt data store is swapped in
+
+	mu sync.Mutex // replays run one at a time
+}
+
+// ReplayEvents applies the events recorded after the given position to the live data store, up to the head of the event store
+// Applying an event the data store already includes leaves it as it is, so replaying from an earlier position is safe
+func (r *Replayer) ReplayEvents(afterPosition int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log.Printf("Replaying events after position %d", afterPosition)
+
+	return r.catchUp(r.Datastore, afterPosition)
+}
+
+// Rebuild builds a fresh data store from the event store (or, if fromDatabase is set, by loading the database and then
+// applying the events recorded since) and swaps it in for the live data store
+// Changes are held during the last catch-up and the swap, so the rebuilt data store includes every change the live one applied
+func (r *Replayer) Rebuild(fromDatabase bool) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log.Printf("Rebuilding data store (from database: %t)", fromDatabase)
+
+	next := r.Datastore.Fresh()
+	if fromDatabase {
+		err := next.Initialize()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.catchUp(next, next.Checkpoint())
+	if err != nil {
+		return n, err
+	}
+
+	swap := func() error {
+		m, err := r.catchUp(next, next.Checkpoint())
+		n += m
+		if err != nil {
+			return err
+		}
+
+		return r.Datastore.Swap(next)
+	}
+
+	if r.Syncer != nil {
+		err = r.Syncer.Hold(swap)
+	} else {
+		err = swap()
+	}
+	if err != nil {
+		return n, err
+	}
+
+	log.Printf("Data store rebuilt (%d events applied, checkpoint: %d)", n, r.Datastore.Checkpoint())
+
+	return n, nil
+}
+
+// catchUp applies the events recorded after the given position to a data store, up to the head of the event store
+// An event that cannot be applied is logged and skipped, like a change that cannot be applied
+func (r *Replayer) catchUp(ds datastore.Datastore, afterPosition int64) (int, error) {
+	n := 0
+	for {
+		events, err := r.Events.Read(afterPosition, replayBatchSize)
+		if err != nil {
+			return n, err
+		}
+
+		for _, e := range events {
+			err := applyEvent(ds, e)
+			if err != nil {
+				ae := apperror.FromError(err)
+				log.Printf("Failed to apply %s event %d: %s (code: %s, reason: %s)", e.Type, e.Position, ae.Message, ae.Kind.Code(), ae.Reason)
+			}
+
+			ds.Advance(e.Position)
+			afterPosition = e.Position
+			n++
+		}
+
+		if len(events) < replayBatchSize {
+			return n, nil
+		}
+	}
+}
+
+// applyEvent applies an event to a data store, leaving the data store as it is if it already includes the event
+// (e.g., because it was loaded from the database after the event was recorded)
+func applyEvent(ds datastore.Datastore, e event.Event) error {
+	switch e.Type {
+	case event.UserCreated:
+		_, err := ds.GetUserByUserID(e.User.ID)
+		if apperror.Is(err, apperror.NotFound) {
+			return ds.AddUser(e.User)
+		}
+
+		return err
+	case event.UserPasswordUpdated:
+		u, err := ds.GetUserByUserID(e.User.ID)
+		if err != nil {
+			return err
+		}
+
+		u.PasswordHash = e.User.PasswordHash
+		return ds.UpdateUser(u)
+	case event.FollowCreated:
+		_, err := ds.GetFollow(e.Follow.FollowerUserID, e.Follow.FolloweeUserID)
+		if apperror.Is(err, apperror.NotFound) {
+			return ds.AddFollow(e.Follow)
+		}
+
+		return err
+	case event.FollowDeleted:
+		err := ds.RemoveFollow(e.Follow.FollowerUserID, e.Follow.FolloweeUserID)
+		if apperror.Is(err, apperror.NotFound) {
+			return nil
+		}
+
+		return err
+	case event.TweetCreated:
+		_, err := ds.GetTweet(e.Tweet.ID)
+		if apperror.Is(err, apperror.NotFound) {
+			return ds.AddTweet(e.Tweet)
+		}
+
+		return err
+	case event.TweetEdited:
+		t, err := ds.GetTweet(e.Tweet.ID)
+		if err != nil {
+			return err
+		}
+
+		// the tweet already includes the edit (or a later one)
+		if !t.EditedAt.Before(e.Tweet.EditedAt) {
+			return nil
+		}
+
+		// the previous text becomes a revision, like when the database projects the edit
+		revisedAt := t.EditedAt
+		if revisedAt.IsZero() {
+			revisedAt = t.CreatedAt
+		}
+
+		t.Revisions = append(append([]tweet.Revision{}, t.Revisions...), tweet.Revision{Text: t.Text, CreatedAt: revisedAt})
+		t.Text = e.Tweet.Text
+		t.EditedAt = e.Tweet.EditedAt
+
+		return ds.UpdateTweet(t)
+	case event.TweetDeleted:
+		err := ds.RemoveTweet(e.Tweet.ID)
+		if apperror.Is(err, apperror.NotFound) {
+			return nil
+		}
+
+		return err
+	default:
+		return apperror.NewInvalidArgument("INVALID_EVENT_TYPE", "Invalid event type")
+	}
+}
+
+// AdminServer implements the gRPC ReadViewAdminServer, which is kept apart from the ReadViewServer so that replays are not
+// exposed to the other services
+type AdminServer struct {
+	pb.UnimplementedReadViewAdminServer
+	Replayer *Replayer
+}
+
+// Replay replays events onto the live data store, or rebuilds the data store beside it and swaps it in
+func (s *AdminServer) Replay(ctx context.Context, in *pb.ReplayParam) (*pb.ReplayResponse, error) {
+	var n int
+	var err error
+	switch {
+	case in.Source == pb.ReplaySource_DATABASE || in.Rebuild:
+		if in.FromPosition != 0 {
+			return nil, apperror.NewInvalidArgument(
+				"INVALID_REPLAY",
+				"A rebuild cannot start from a position",
+				apperror.FieldViolation{Field: "FromPosition", Description: "must not be set when rebuilding"},
+			)
+		}
+
+		n, err = s.Replayer.Rebuild(in.Source == pb.ReplaySource_DATABASE)
+	default:
+		from := in.FromPosition
+		if from == 0 {
+			from = s.Replayer.Datastore.Checkpoint()
+		}
+
+		n, err = s.Replayer.ReplayEvents(from)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ReplayResponse{Applied: int32(n), Checkpoint: s.Replayer.Datastore.Checkpoint()}, nil
+}
@@ -2,172 +2,233 @@ package application
 
 import (
 	"context"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/datastore"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
 	pb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/pagination"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
 // ReadViewServer implements the gRPC ReadViewServer
 type ReadViewServer struct {
 	pb.UnimplementedReadViewServer
 	Datastore datastore.Datastore
+
+	// Pages encodes and decodes the page tokens of the list methods
+	Pages pagination.Codec
 }
 
-// AddUser adds a user to the ReadViewServer's  data store
-func (s *ReadViewServer) AddUser(ctx context.Context, in *pb.User) (*pb.SimpleResponse, error) {
-	u := user.User{
-		ID:       user.ID(in.ID),
-		Username: in.Username,
-		Password: in.Password,
+// GetUserByUserID returns the user (if any) of the given UserID
+func (s *ReadViewServer) GetUserByUserID(ctx context.Context, in *pb.UserID) (*pb.User, error) {
+	u, err := s.Datastore.GetUserByUserID(user.ID(in.UserID))
+	if err != nil {
+		return nil, err
 	}
-	err := s.Datastore.AddUser(u)
+
+	return &pb.User{
+		ID:           string(u.ID),
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    toPBTimestamp(u.CreatedAt),
+	}, nil
+}
+
+// GetUserByUsername returns the user (if any) of the given Username
+func (s *ReadViewServer) GetUserByUsername(ctx context.Context, in *pb.Username) (*pb.User, error) {
+	u, err := s.Datastore.GetUserByUsername(in.Username)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Failed to add user to read view"}, err
+		return nil, err
 	}
 
-	return &pb.SimpleResponse{}, nil
+	return &pb.User{
+		ID:           string(u.ID),
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    toPBTimestamp(u.CreatedAt),
+	}, nil
 }
 
-// AddTweet adds a tweet to the ReadViewServer's data store
-func (s *ReadViewServer) AddTweet(ctx context.Context, in *pb.Tweet) (*pb.SimpleResponse, error) {
-	t := tweet.Tweet{
-		ID:       in.ID,
-		UserID:   user.ID(in.UserID),
-		Username: in.Username,
-		Text:     in.Text,
+// GetFollowers returns a page of the followers of the given UserID, newest first
+func (s *ReadViewServer) GetFollowers(ctx context.Context, in *pb.PageParam) (*pb.Follows, error) {
+	scope := "followers/" + in.UserID
+	after, err := s.Pages.Decode(scope, in.PageToken)
+	if err != nil {
+		return nil, err
 	}
 
-	err := s.Datastore.AddTweet(t)
+	size := pagination.PageSize(in.PageSize, defaultPageSize, maxPageSize)
+	followers, err := s.Datastore.GetFollowers(user.ID(in.UserID), after, size+1)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Failed to add tweet to read view"}, err
+		return nil, err
 	}
 
-	return &pb.SimpleResponse{Message: "Successfully added tweet to read view"}, nil
+	var pbFollows pb.Follows
+	if len(followers) > size {
+		followers = followers[:size]
+		last := followers[size-1]
+		pbFollows.NextPageToken = s.Pages.Encode(scope, pagination.Cursor{Time: last.CreatedAt, ID: string(last.FollowerUserID)})
+	}
+
+	for _, f := range followers {
+		pbFollows.Follows = append(pbFollows.Follows, toPBFollow(f))
+	}
+
+	return &pbFollows, nil
 }
 
-// AddFollow adds a user/follower pair to the ReadViewServer's data store
-func (s *ReadViewServer) AddFollow(ctx context.Context, in *pb.Follow) (*pb.SimpleResponse, error) {
-	f := follow.Follow{
-		FollowerUserID:   user.ID(in.FollowerUserID),
-		FollowerUsername: in.FollowerUsername,
-		FolloweeUserID:   user.ID(in.FolloweeUserID),
-		FolloweeUsername: in.FolloweeUsername,
+// GetFollowees returns a page of the followees (i.e., users that the user follows) of the given UserID, newest first
+func (s *ReadViewServer) GetFollowees(ctx context.Context, in *pb.PageParam) (*pb.Follows, error) {
+	scope := "followees/" + in.UserID
+	after, err := s.Pages.Decode(scope, in.PageToken)
+	if err != nil {
+		return nil, err
 	}
-	err := s.Datastore.AddFollow(f)
+
+	size := pagination.PageSize(in.PageSize, defaultPageSize, maxPageSize)
+	followees, err := s.Datastore.GetFollowees(user.ID(in.UserID), after, size+1)
 	if err != nil {
-		return &pb.SimpleResponse{Message: "Failed to add follower to read view"}, err
+		return nil, err
+	}
+
+	var pbFollows pb.Follows
+	if len(followees) > size {
+		followees = followees[:size]
+		last := followees[size-1]
+		pbFollows.NextPageToken = s.Pages.Encode(scope, pagination.Cursor{Time: last.CreatedAt, ID: string(last.FolloweeUserID)})
 	}
 
-	return &pb.SimpleResponse{Message: "Successfully added follower to read view"}, nil
+	for _, f := range followees {
+		pbFollows.Follows = append(pbFollows.Follows, toPBFollow(f))
+	}
+
+	return &pbFollows, nil
 }
 
-// GetUserByUserID returns the user (if any) of the given UserID
-func (s *ReadViewServer) GetUserByUserID(ctx context.Context, in *pb.UserID) (*pb.User, error) {
-	u, err := s.Datastore.GetUserByUserID(user.ID(in.UserID))
+// GetFollow returns the follow between the given follower and followee (or a NotFound error if there is none)
+func (s *ReadViewServer) GetFollow(ctx context.Context, in *pb.Follow) (*pb.Follow, error) {
+	f, err := s.Datastore.GetFollow(user.ID(in.FollowerUserID), user.ID(in.FolloweeUserID))
 	if err != nil {
-		return &pb.User{}, err
+		return nil, err
 	}
 
-	return &pb.User{
-		ID:       string(u.ID),
-		Username: u.Username,
-		Password: u.Password,
-	}, nil
+	return toPBFollow(f), nil
 }
 
-// GetUserByUsername returns the user (if any) of the given Username
-func (s *ReadViewServer) GetUserByUsername(ctx context.Context, in *pb.Username) (*pb.User, error) {
-	u, err := s.Datastore.GetUserByUsername(in.Username)
+// GetTweet returns the tweet (including its revisions) of the given TweetID
+func (s *ReadViewServer) GetTweet(ctx context.Context, in *pb.TweetID) (*pb.Tweet, error) {
+	t, err := s.Datastore.GetTweet(in.TweetID)
 	if err != nil {
-		return &pb.User{}, err
+		return nil, err
 	}
 
-	return &pb.User{
-		ID:       string(u.ID),
-		Username: u.Username,
-		Password: u.Password,
-	}, nil
+	return toPBTweet(t), nil
 }
 
-// GetFollowers TO DO
-func (s *ReadViewServer) GetFollowers(ctx context.Context, in *pb.UserID) (*pb.Follows, error) {
-	followers, err := s.Datastore.GetFollowers(user.ID(in.UserID))
+// GetTweets returns a page of the tweets of the given UserID, newest first
+func (s *ReadViewServer) GetTweets(ctx context.Context, in *pb.PageParam) (*pb.Tweets, error) {
+	scope := "tweets/" + in.UserID
+	after, err := s.Pages.Decode(scope, in.PageToken)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
-	var pbFollows pb.Follows
-	for _, f := range followers {
-		pbFollows.Follows = append(pbFollows.Follows, &pb.Follow{
-			FollowerUserID:   string(f.FollowerUserID),
-			FollowerUsername: f.FollowerUsername,
-			FolloweeUserID:   string(f.FolloweeUserID),
-			FolloweeUsername: f.FolloweeUsername,
-		})
+	size := pagination.PageSize(in.PageSize, defaultPageSize, maxPageSize)
+	tweets, err := s.Datastore.GetTweets(user.ID(in.UserID), after, size+1)
+	if err != nil {
+		return nil, err
 	}
 
-	return &pbFollows, nil
+	return s.tweetsPage(scope, tweets, size), nil
 }
 
-// GetFollowees TO DO
-func (s *ReadViewServer) GetFollowees(ctx context.Context, in *pb.UserID) (*pb.Follows, error) {
-	followees, err := s.Datastore.GetFollowees(user.ID(in.UserID))
+// GetTimeline returns a page of the tweets of users that the given UserID follows, newest first
+func (s *ReadViewServer) GetTimeline(ctx context.Context, in *pb.PageParam) (*pb.Tweets, error) {
+	scope := "timeline/" + in.UserID
+	after, err := s.Pages.Decode(scope, in.PageToken)
 	if err != nil {
-		return &pb.Follows{}, err
+		return nil, err
 	}
 
-	var pbFollows pb.Follows
-	for _, f := range followees {
-		pbFollows.Follows = append(pbFollows.Follows, &pb.Follow{
-			FollowerUserID:   string(f.FollowerUserID),
-			FollowerUsername: f.FollowerUsername,
-			FolloweeUserID:   string(f.FolloweeUserID),
-			FolloweeUsername: f.FolloweeUsername,
-		})
+	size := pagination.PageSize(in.PageSize, defaultPageSize, maxPageSize)
+	timeline, err := s.Datastore.GetTimeline(user.ID(in.UserID), after, size+1)
+	if err != nil {
+		return nil, err
 	}
 
-	return &pbFollows, nil
+	return s.tweetsPage(scope, timeline, size), nil
 }
 
-// GetTweets returns the tweets of the given UserID
-func (s *ReadViewServer) GetTweets(ctx context.Context, in *pb.UserID) (*pb.Tweets, error) {
-	tweets, err := s.Datastore.GetTweets(user.ID(in.UserID))
-	if err != nil {
-		return &pb.Tweets{}, err
+// tweetsPage converts up to size tweets to a page, with a token for the next page if there are more tweets
+func (s *ReadViewServer) tweetsPage(scope string, tweets []tweet.Tweet, size int) *pb.Tweets {
+	var nextPageToken string
+	if len(tweets) > size {
+		tweets = tweets[:size]
+		last := tweets[size-1]
+		nextPageToken = s.Pages.Encode(scope, pagination.Cursor{Time: last.CreatedAt, ID: last.ID})
 	}
 
 	pbTweets := []*pb.Tweet{}
 	for _, t := range tweets {
-		pbTweets = append(pbTweets, &pb.Tweet{
-			ID:       t.ID,
-			UserID:   string(t.UserID),
-			Username: t.Username,
-			Text:     t.Text,
-		})
+		pbTweets = append(pbTweets, toPBTweet(t))
 	}
 
-	return &pb.Tweets{Tweets: pbTweets}, nil
+	return &pb.Tweets{Tweets: pbTweets, NextPageToken: nextPageToken}
 }
 
-// GetTimeline returns the tweets of users that the given UserID follows
-func (s *ReadViewServer) GetTimeline(ctx context.Context, in *pb.UserID) (*pb.Tweets, error) {
-	timeline, err := s.Datastore.GetTimeline(user.ID(in.UserID))
-	if err != nil {
-		return &pb.Tweets{}, err
+func toPBFollow(f follow.Follow) *pb.Follow {
+	return &pb.Follow{
+		FollowerUserID:   string(f.FollowerUserID),
+		FollowerUsername: f.FollowerUsername,
+		FolloweeUserID:   string(f.FolloweeUserID),
+		FolloweeUsername: f.FolloweeUsername,
+		CreatedAt:        toPBTimestamp(f.CreatedAt),
 	}
+}
 
-	pbTweets := []*pb.Tweet{}
-	for _, t := range timeline {
-		pbTweets = append(pbTweets, &pb.Tweet{
-			ID:       t.ID,
-			UserID:   string(t.UserID),
-			Username: t.Username,
-			Text:     t.Text,
+func toPBTweet(t tweet.Tweet) *pb.Tweet {
+	pbTweet := pb.Tweet{
+		ID:        t.ID,
+		UserID:    string(t.UserID),
+		Username:  t.Username,
+		Text:      t.Text,
+		CreatedAt: toPBTimestamp(t.CreatedAt),
+		EditedAt:  toPBTimestamp(t.EditedAt),
+	}
+
+	for _, r := range t.Revisions {
+		pbTweet.Revisions = append(pbTweet.Revisions, &pb.TweetRevision{
+			Text:      r.Text,
+			CreatedAt: toPBTimestamp(r.CreatedAt),
 		})
 	}
 
-	return &pb.Tweets{Tweets: pbTweets}, nil
+	return &pbTweet
+}
+
+// toPBTimestamp converts a time to a protobuf timestamp, leaving zero times unset
+func toPBTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+// fromPBTimestamp converts a protobuf timestamp to a time, converting unset timestamps to the zero time
+func fromPBTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+
+	return ts.AsTime()
 }
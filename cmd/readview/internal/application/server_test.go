@@ -0,0 +1,193 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/infrastructure/datastore"
+	pb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/pagination"
+)
+
+const (
+	testUsers   = 20
+	testWriters = 4
+	testReaders = 8
+	testRounds  = 200
+)
+
+func newTestServer() *ReadViewServer {
+	return &ReadViewServer{
+		Datastore: &datastore.Datastore{
+			Users:       map[user.ID]user.User{},
+			Followers:   map[user.ID][]follow.Follow{},
+			Followees:   map[user.ID][]follow.Follow{},
+			Tweets:      map[user.ID][]tweet.Tweet{},
+			Usernames:   map[string]user.ID{},
+			TweetOwners: map[string]user.ID{},
+		},
+		Pages: pagination.Codec{Key: []byte("test-page-token-key")},
+	}
+}
+
+func testUserID(i int) string {
+	return fmt.Sprintf("user-%d", i)
+}
+
+func testFollow(follower int, followee int) follow.Follow {
+	return follow.Follow{
+		FollowerUserID:   user.ID(testUserID(follower)),
+		FollowerUsername: fmt.Sprintf("user%d", follower),
+		FolloweeUserID:   user.ID(testUserID(followee)),
+		FolloweeUsername: fmt.Sprintf("user%d", followee),
+		CreatedAt:        time.Now(),
+	}
+}
+
+// TestConcurrentRequests applies changes to the data store (as the change listener and the replayer do) while timelines, tweets
+// and followers are paged through, and is meant to be run with -race
+func TestConcurrentRequests(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer()
+
+	for i := 0; i < testUsers; i++ {
+		err := s.Datastore.AddUser(user.User{ID: user.ID(testUserID(i)), Username: fmt.Sprintf("user%d", i), CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < testWriters; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < testRounds; i++ {
+				author := (w + i) % testUsers
+				follower := (w + testWriters*i) % testUsers // each writer follows and unfollows on behalf of its own users
+				if follower == author {
+					follower = (follower + testWriters) % testUsers
+				}
+				tweetID := fmt.Sprintf("tweet-%d-%d", w, i)
+
+				err := s.Datastore.AddTweet(tweet.Tweet{
+					ID:        tweetID,
+					UserID:    user.ID(testUserID(author)),
+					Username:  fmt.Sprintf("user%d", author),
+					Text:      "Hello world",
+					CreatedAt: time.Now(),
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				_, err = s.GetFollow(ctx, &pb.Follow{FollowerUserID: testUserID(follower), FolloweeUserID: testUserID(author)})
+				if apperror.Is(err, apperror.NotFound) {
+					err = s.Datastore.AddFollow(testFollow(follower, author))
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if i%3 == 0 {
+					err = s.Datastore.RemoveTweet(tweetID)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+
+				if i%5 == 0 {
+					err = s.Datastore.RemoveFollow(user.ID(testUserID(follower)), user.ID(testUserID(author)))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < testReaders; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+
+			for i := 0; i < testRounds; i++ {
+				userID := testUserID((r + i) % testUsers)
+
+				err := pageTweets(func(token string) (*pb.Tweets, error) {
+					return s.GetTimeline(ctx, &pb.PageParam{UserID: userID, PageSize: 5, PageToken: token})
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				err = pageTweets(func(token string) (*pb.Tweets, error) {
+					return s.GetTweets(ctx, &pb.PageParam{UserID: userID, PageSize: 5, PageToken: token})
+				})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				token := ""
+				for {
+					page, err := s.GetFollowers(ctx, &pb.PageParam{UserID: userID, PageSize: 3, PageToken: token})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if page.NextPageToken == "" {
+						break
+					}
+					token = page.NextPageToken
+				}
+			}
+		}(r)
+	}
+
+	wg.Wait()
+}
+
+// pageTweets pages through a list of tweets until its last page, checking that each page is newest first and that no tweet is repeated
+func pageTweets(getPage func(token string) (*pb.Tweets, error)) error {
+	seen := map[string]bool{}
+	var last *pb.Tweet
+
+	token := ""
+	for {
+		page, err := getPage(token)
+		if err != nil {
+			return err
+		}
+
+		for _, tw := range page.Tweets {
+			if seen[tw.ID] {
+				return fmt.Errorf("tweet %s was returned twice", tw.ID)
+			}
+			seen[tw.ID] = true
+
+			if last != nil && tw.CreatedAt.AsTime().After(last.CreatedAt.AsTime()) {
+				return fmt.Errorf("tweet %s is newer than the tweet before it", tw.ID)
+			}
+			last = tw
+		}
+
+		if page.NextPageToken == "" {
+			return nil
+		}
+		token = page.NextPageToken
+	}
+}
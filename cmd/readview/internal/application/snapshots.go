@@ -0,0 +1,85 @@
+package application
+
+import (
+	"log"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/datastore"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/snapshot"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// Snapshotter saves snapshots of the data store at every interval, and loads the data store from its latest snapshot
+// (or its current data) plus the events recorded since, rather than fetching every user, follow and tweet again
+type Snapshotter struct {
+	Datastore datastore.Datastore
+	Snapshots snapshot.Store
+	Replayer  *Replayer // catches the data store up with the events recorded since its checkpoint
+	Interval  time.Duration
+}
+
+// Run saves a snapshot of the data store at every interval, unless its checkpoint has not moved since the last one
+func (s *Snapshotter) Run() {
+	var last int64
+	for {
+		time.Sleep(s.Interval)
+
+		snap := s.Datastore.Snapshot()
+		if snap.Checkpoint == 0 || snap.Checkpoint == last {
+			continue
+		}
+
+		err := s.Snapshots.Save(snap)
+		if err != nil {
+			log.Printf("Failed to save snapshot: %s", err)
+			continue
+		}
+
+		log.Printf("Saved snapshot at checkpoint %d", snap.Checkpoint)
+		last = snap.Checkpoint
+	}
+}
+
+// Load loads the data store, which the Syncer does before it applies changes
+// On start, the data store is restored from the latest snapshot; after that, it already holds the data as of its checkpoint.
+// Either way, only the events recorded since its checkpoint are then applied. The data store is fully initialized instead
+// if it has no checkpoint (e.g., no snapshot was saved yet) or catching up fails
+func (s *Snapshotter) Load() error {
+	if s.Datastore.Checkpoint() == 0 {
+		s.restore()
+	}
+
+	from := s.Datastore.Checkpoint()
+	if from > 0 {
+		n, err := s.Replayer.ReplayEvents(from)
+		if err == nil {
+			log.Printf("Data store caught up from checkpoint %d (%d events applied)", from, n)
+			return nil
+		}
+
+		ae := apperror.FromError(err)
+		log.Printf("Failed to catch up from checkpoint %d, initializing data store: %s (code: %s, reason: %s)", from, ae.Message, ae.Kind.Code(), ae.Reason)
+	}
+
+	return s.Datastore.Initialize()
+}
+
+// restore restores the data store from the latest snapshot, if there is one
+func (s *Snapshotter) restore() {
+	snap, err := s.Snapshots.Latest()
+	if apperror.Is(err, apperror.NotFound) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read snapshot: %s", err)
+		return
+	}
+
+	err = s.Datastore.Restore(snap)
+	if err != nil {
+		log.Printf("Failed to restore snapshot: %s", err)
+		return
+	}
+
+	log.Printf("Data store restored from snapshot taken at %s (checkpoint: %d)", snap.TakenAt.Format(time.RFC3339), snap.Checkpoint)
+}
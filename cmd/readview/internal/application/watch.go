@@ -0,0 +1,138 @@
+package application
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/datastore"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// A Syncer keeps the data store in sync with the database (i.e., a ChangeWatcher or a ChangeListener)
+type Syncer interface {
+	Run()
+	Synced() bool
+	Hold(fn func() error) error
+}
+
+// ChangeWatcher applies the changes streamed by the DatabaseAccess service's watchChanges method to the data store
+// A change's resume token is the event store position the data store's checkpoint is made of, so the checkpoint is the resume token
+// the ChangeWatcher picks up from after a lost stream, or after a restart once the data store is restored from its latest snapshot
+type ChangeWatcher struct {
+	Client    dbaccesspb.DatabaseAccessClient
+	Datastore datastore.Datastore
+	Load      func() error // optional, loads the data store (defaults to initializing it)
+
+	synced int32
+	mu     sync.Mutex // held while a change is applied
+}
+
+// Run keeps the data store in sync with the database: it loads the data store, then watches the changes made since its checkpoint
+// Whenever the stream is lost, Run watches again from the checkpoint; the data store is only loaded again if the changes
+// since its checkpoint are no longer available
+func (w *ChangeWatcher) Run() {
+	loaded := false
+	for {
+		if !loaded {
+			err := w.load()
+			if err != nil {
+				log.Printf("Failed to load data store: %s", err)
+				time.Sleep(resyncDelay)
+				continue
+			}
+			loaded = true
+		}
+
+		err := w.watch()
+		atomic.StoreInt32(&w.synced, 0)
+
+		ae := apperror.FromError(err)
+		log.Printf("Stopped receiving database changes, watching again: %s (code: %s, reason: %s)", ae.Message, ae.Kind.Code(), ae.Reason)
+		if ae.Reason == "RESUME_TOKEN_EXPIRED" {
+			loaded = false
+		}
+
+		time.Sleep(resyncDelay)
+	}
+}
+
+func (w *ChangeWatcher) load() error {
+	if w.Load != nil {
+		return w.Load()
+	}
+
+	return w.Datastore.Initialize()
+}
+
+// Synced returns whether the data store is loaded and receiving changes
+func (w *ChangeWatcher) Synced() bool {
+	return atomic.LoadInt32(&w.synced) == 1
+}
+
+// Hold runs fn while no change is being applied, holding the changes received meanwhile until fn returns
+func (w *ChangeWatcher) Hold(fn func() error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return fn()
+}
+
+// watch applies changes from the data store's checkpoint on until the stream fails
+// A change that cannot be applied is logged and skipped since applying it again would fail the same way
+func (w *ChangeWatcher) watch() error {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	var resumeToken string
+	if checkpoint := w.Datastore.Checkpoint(); checkpoint > 0 {
+		resumeToken = strconv.FormatInt(checkpoint, 10)
+	}
+
+	stream, err := w.Client.WatchChanges(ctx, &dbaccesspb.WatchChangesParam{ResumeToken: resumeToken})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Watching database changes (resume token: %q)", resumeToken)
+	atomic.StoreInt32(&w.synced, 1)
+
+	for {
+		c, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		w.mu.Lock()
+		err = applyChange(w.Datastore, c.Type, changePayload(c))
+		if err != nil {
+			ae := apperror.FromError(err)
+			log.Printf("Failed to apply %s change %s: %s (code: %s, reason: %s)", c.Type, c.ResumeToken, ae.Message, ae.Kind.Code(), ae.Reason)
+		}
+
+		w.Datastore.Advance(c.Position)
+		w.mu.Unlock()
+	}
+}
+
+// changePayload returns the changed entity a change holds
+func changePayload(c *dbaccesspb.Change) proto.Message {
+	switch {
+	case c.User != nil:
+		return c.User
+	case c.Follow != nil:
+		return c.Follow
+	case c.Tweet != nil:
+		return c.Tweet
+	case c.TweetDeletion != nil:
+		return c.TweetDeletion
+	default:
+		return nil
+	}
+}
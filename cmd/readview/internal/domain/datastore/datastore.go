@@ -2,20 +2,36 @@ package datastore
 
 import (
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/snapshot"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/pagination"
 )
 
 // Datastore is the data store interface
+// Its checkpoint is the position of the last event store event it includes, and only ever moves forward
+// Fresh returns an empty data store, which can be built beside this one and then swapped in
 type Datastore interface {
 	Initialize() error
+	Snapshot() snapshot.Snapshot
+	Restore(s snapshot.Snapshot) error
+	Fresh() Datastore
+	Swap(next Datastore) error
+	Checkpoint() int64
+	Advance(position int64)
 	AddUser(user.User) error
 	AddFollow(follow.Follow) error
+	RemoveFollow(followerUserID user.ID, followeeUserID user.ID) error
 	AddTweet(tweet.Tweet) error
+	UpdateTweet(tweet.Tweet) error
+	RemoveTweet(tweetID string) error
+	UpdateUser(user.User) error
 	GetUserByUserID(user.ID) (user.User, error)
 	GetUserByUsername(username string) (user.User, error)
-	GetTweets(user.ID) ([]tweet.Tweet, error)
-	GetTimeline(user.ID) ([]tweet.Tweet, error)
-	GetFollowers(user.ID) ([]follow.Follow, error)
-	GetFollowees(user.ID) ([]follow.Follow, error)
+	GetTweet(tweetID string) (tweet.Tweet, error)
+	GetTweets(userID user.ID, after *pagination.Cursor, limit int) ([]tweet.Tweet, error)
+	GetTimeline(userID user.ID, after *pagination.Cursor, limit int) ([]tweet.Tweet, error)
+	GetFollow(followerUserID user.ID, followeeUserID user.ID) (follow.Follow, error)
+	GetFollowers(userID user.ID, after *pagination.Cursor, limit int) ([]follow.Follow, error)
+	GetFollowees(userID user.ID, after *pagination.Cursor, limit int) ([]follow.Follow, error)
 }
@@ -0,0 +1,41 @@
+package event
+
+import (
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+)
+
+// Type specifies the type of an event recorded in the Database Access service's event store
+type Type string
+
+// Types of the events recorded in the event store
+const (
+	UserCreated         Type = "UserCreated"
+	UserPasswordUpdated Type = "UserPasswordUpdated"
+	FollowCreated       Type = "FollowCreated"
+	FollowDeleted       Type = "FollowDeleted"
+	TweetCreated        Type = "TweetCreated"
+	TweetEdited         Type = "TweetEdited"
+	TweetDeleted        Type = "TweetDeleted"
+)
+
+// An Event is a change to a user, follow or tweet read from the event store, which the data store can be rebuilt from
+// Only the entity matching the event's type is set, with the fields the change sets (e.g., a TweetEdited event's tweet only
+// has its ID, UserID, text and EditedAt)
+type Event struct {
+	Position   int64
+	Type       Type
+	User       user.User
+	Follow     follow.Follow
+	Tweet      tweet.Tweet
+	RecordedAt time.Time
+}
+
+// Repository is the Event Repository interface
+type Repository interface {
+	Head() (int64, error)
+	Read(afterPosition int64, limit int) ([]Event, error)
+}
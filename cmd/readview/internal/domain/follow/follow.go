@@ -1,6 +1,10 @@
 package follow
 
-import "github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+import (
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+)
 
 // A Follow represents a unique follower/followee relationship between two users
 type Follow struct {
@@ -8,6 +12,7 @@ type Follow struct {
 	FollowerUsername string
 	FolloweeUserID   user.ID
 	FolloweeUsername string
+	CreatedAt        time.Time
 }
 
 // Repository is the Follow Repository interface
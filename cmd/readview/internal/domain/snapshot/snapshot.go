@@ -0,0 +1,26 @@
+package snapshot
+
+import (
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+)
+
+// A Snapshot is a copy of the data store's data as of its checkpoint (the position of the last event store event it includes),
+// which the data store can be restored from and then caught up with only the events recorded since
+type Snapshot struct {
+	Checkpoint int64
+	TakenAt    time.Time
+	Users      []user.User
+	Follows    []follow.Follow
+	Tweets     []tweet.Tweet
+}
+
+// Store is the snapshot store interface
+// Latest returns the most recent snapshot that is intact, or a NotFound error if there is none
+type Store interface {
+	Save(s Snapshot) error
+	Latest() (Snapshot, error)
+}
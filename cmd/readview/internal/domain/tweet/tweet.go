@@ -1,12 +1,25 @@
 package tweet
 
-import "github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+import (
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+)
 
 type Tweet struct {
-	ID       string
-	UserID   user.ID
-	Username string
-	Text     string
+	ID        string
+	UserID    user.ID
+	Username  string
+	Text      string
+	CreatedAt time.Time
+	EditedAt  time.Time
+	Revisions []Revision
+}
+
+// A Revision is a previous version of a tweet's text, along with when that version was written
+type Revision struct {
+	Text      string
+	CreatedAt time.Time
 }
 
 type Repository interface {
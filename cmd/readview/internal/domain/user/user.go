@@ -1,18 +1,22 @@
 package user
 
+import "time"
+
 type User struct {
-	ID       ID
-	Username string
-	Password string
+	ID           ID
+	Username     string
+	PasswordHash string
+	CreatedAt    time.Time
 }
 
 type ID string
 
 type Config struct {
-	Username string
-	Password string
+	Username     string
+	PasswordHash string
 }
 
 type Repository interface {
 	FindAll() ([]User, error)
+	FindByID(id ID) (User, error)
 }
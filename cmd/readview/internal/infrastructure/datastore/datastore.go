@@ -1,30 +1,62 @@
 package datastore
 
 import (
-	"errors"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/datastore"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/event"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/snapshot"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/pagination"
 )
 
 // Datastore is an in-memory object that stores a copy of all the app's data
+// It is safe for concurrent use: reads (i.e., every gRPC method serving the API Gateway) share a read lock while writes (the
+// database changes applied by the ChangeWatcher or ChangeListener, and the events applied by the Replayer) take the write lock. A single lock is used rather than per-user shards since timelines read the tweets
+// of many users at once, and each critical section is short (reads only copy out a page, writes only touch one or two lists)
 type Datastore struct {
 	UserRepository   user.Repository
 	FollowRepository follow.Repository
 	TweetRepository  tweet.Repository
+	EventRepository  event.Repository // optional, used to set the checkpoint when the data store is initialized
+
+	mu         sync.RWMutex
+	checkpoint int64
 
 	Users     map[user.ID]user.User
-	Followers map[user.ID][]follow.Follow
+	Followers map[user.ID][]follow.Follow // each user's followers and followees are kept sorted oldest first
 	Followees map[user.ID][]follow.Follow
-	Tweets    map[user.ID][]tweet.Tweet
+	Tweets    map[user.ID][]tweet.Tweet // each user's tweets are kept sorted oldest first
+
+	// Usernames indexes each user's ID by (case-insensitive) username, so users can be looked up by username without scanning every user
+	Usernames map[string]user.ID
+
+	// TweetOwners indexes each tweet's author by tweet ID so individual tweets can be looked up without scanning every user's tweets
+	TweetOwners map[string]user.ID
 }
 
-// Initialize populates the in-memory data store by fetching data via the Database Access service (only called when the server starts)
+// Initialize (re)populates the data store by fetching data via the Database Access service (called whenever the Read View subscribes to changes)
+// The data is loaded into a fresh data store, which is then swapped in, so reads are served from the previous data until the load is done
+// The checkpoint is the event store's head as of before the load, since the load may include later changes but includes every earlier one
 func (ds *Datastore) Initialize() error {
 	log.Println("Initializing data store")
 
+	var head int64
+	if ds.EventRepository != nil {
+		var err error
+		head, err = ds.EventRepository.Head()
+		if err != nil {
+			return err
+		}
+	}
+
 	users, err := ds.UserRepository.FindAll()
 	if err != nil {
 		return err
@@ -38,64 +70,204 @@ func (ds *Datastore) Initialize() error {
 		return err
 	}
 
-	ds.Users = map[user.ID]user.User{}
-	ds.Followers = map[user.ID][]follow.Follow{}
-	ds.Followees = map[user.ID][]follow.Follow{}
-	ds.Tweets = map[user.ID][]tweet.Tweet{}
+	err = ds.Swap(ds.build(head, users, follows, tweets))
+	if err != nil {
+		return err
+	}
+
+	log.Println("Data store initialized")
+
+	return nil
+}
+
+// Snapshot returns a copy of the data store's data as of its checkpoint
+// Password hashes are left out so they are never written to disk; users restored from a snapshot load theirs on demand
+func (ds *Datastore) Snapshot() snapshot.Snapshot {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	s := snapshot.Snapshot{
+		Checkpoint: ds.checkpoint,
+		TakenAt:    time.Now(),
+		Users:      make([]user.User, 0, len(ds.Users)),
+		Follows:    []follow.Follow{},
+		Tweets:     make([]tweet.Tweet, 0, len(ds.TweetOwners)),
+	}
+
+	for _, u := range ds.Users {
+		u.PasswordHash = ""
+		s.Users = append(s.Users, u)
+	}
+
+	// every follow is in exactly one list of followers
+	for _, followers := range ds.Followers {
+		s.Follows = append(s.Follows, followers...)
+	}
+
+	for _, tweets := range ds.Tweets {
+		s.Tweets = append(s.Tweets, tweets...)
+	}
+
+	return s
+}
+
+// Restore replaces the data store's data (and checkpoint) with that of a snapshot
+func (ds *Datastore) Restore(s snapshot.Snapshot) error {
+	return ds.Swap(ds.build(s.Checkpoint, s.Users, s.Follows, s.Tweets))
+}
+
+// build returns a fresh data store holding the given data, as of the given checkpoint
+func (ds *Datastore) build(checkpoint int64, users []user.User, follows []follow.Follow, tweets []tweet.Tweet) *Datastore {
+	next := ds.fresh()
+	next.checkpoint = checkpoint
 
 	for _, u := range users {
-		ds.Users[u.ID] = u
+		next.Users[u.ID] = u
+		next.Usernames[usernameKey(u.Username)] = u.ID
 	}
 
 	for _, f := range follows {
 		// add the follow to the followee's list of followers
-		followers, ok := ds.Followers[f.FolloweeUserID]
-		if !ok {
-			followers = []follow.Follow{}
-		}
-		ds.Followers[f.FolloweeUserID] = append(followers, f)
+		next.Followers[f.FolloweeUserID] = insertFollow(next.Followers[f.FolloweeUserID], f, follower)
 
 		// add the follow to the follower's list of followees
-		followees, ok := ds.Followees[f.FollowerUserID]
-		if !ok {
-			followees = []follow.Follow{}
-		}
-		ds.Followees[f.FollowerUserID] = append(followees, f)
+		next.Followees[f.FollowerUserID] = insertFollow(next.Followees[f.FollowerUserID], f, followee)
 	}
 
 	for _, t := range tweets {
-		_, ok := ds.Tweets[t.UserID]
-		if !ok {
-			ds.Tweets[t.UserID] = []tweet.Tweet{}
-		}
-		ds.Tweets[t.UserID] = append(ds.Tweets[t.UserID], t)
+		next.Tweets[t.UserID] = append(next.Tweets[t.UserID], t)
+		next.TweetOwners[t.ID] = t.UserID
 	}
 
-	log.Println("Data store initialized")
+	for _, tweets := range next.Tweets {
+		sort.SliceStable(tweets, func(i, j int) bool { return newer(tweets[j], tweets[i]) })
+	}
+
+	return next
+}
+
+// Fresh returns an empty data store that loads from the same repositories
+func (ds *Datastore) Fresh() datastore.Datastore {
+	return ds.fresh()
+}
+
+func (ds *Datastore) fresh() *Datastore {
+	return &Datastore{
+		UserRepository:   ds.UserRepository,
+		FollowRepository: ds.FollowRepository,
+		TweetRepository:  ds.TweetRepository,
+		EventRepository:  ds.EventRepository,
+		Users:            map[user.ID]user.User{},
+		Followers:        map[user.ID][]follow.Follow{},
+		Followees:        map[user.ID][]follow.Follow{},
+		Tweets:           map[user.ID][]tweet.Tweet{},
+		Usernames:        map[string]user.ID{},
+		TweetOwners:      map[string]user.ID{},
+	}
+}
+
+// Swap replaces the data (and checkpoint) of the data store with that of another one, built beside it with Fresh
+// Only the maps are swapped, so reads are blocked for as long as it takes to take the lock rather than to copy the data
+// The other data store must not be used afterwards
+func (ds *Datastore) Swap(next datastore.Datastore) error {
+	n, ok := next.(*Datastore)
+	if !ok || n == ds {
+		return apperror.New(apperror.Internal, "INVALID_DATASTORE", "Data store can only be swapped with a fresh data store")
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.Users = n.Users
+	ds.Followers = n.Followers
+	ds.Followees = n.Followees
+	ds.Tweets = n.Tweets
+	ds.Usernames = n.Usernames
+	ds.TweetOwners = n.TweetOwners
+	ds.checkpoint = n.checkpoint
 
 	return nil
 }
 
+// Checkpoint returns the position of the last event store event the data store includes
+func (ds *Datastore) Checkpoint() int64 {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return ds.checkpoint
+}
+
+// Advance moves the checkpoint forward to the given position (a position at or before the checkpoint leaves it as it is)
+func (ds *Datastore) Advance(position int64) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if position > ds.checkpoint {
+		ds.checkpoint = position
+	}
+}
+
 // AddUser adds a user to the datastore
 func (ds *Datastore) AddUser(u user.User) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	if u.ID == "" || u.Username == "" {
-		return errors.New("Invalid user")
+		return apperror.NewInvalidArgument("INVALID_USER", "Invalid user")
 	}
 
 	_, ok := ds.Users[u.ID]
 	if ok {
-		return errors.New("User already exists")
+		return apperror.NewAlreadyExists("USER_ALREADY_EXISTS", "User already exists")
+	}
+
+	_, ok = ds.Usernames[usernameKey(u.Username)]
+	if ok {
+		return apperror.NewAlreadyExists("USERNAME_TAKEN", "Username already exists")
+	}
+
+	ds.Users[u.ID] = u
+	ds.Usernames[usernameKey(u.Username)] = u.ID
+
+	return nil
+}
+
+// UpdateUser replaces an existing user in the datastore
+func (ds *Datastore) UpdateUser(u user.User) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if u.ID == "" || u.Username == "" {
+		return apperror.NewInvalidArgument("INVALID_USER", "Invalid user")
+	}
+
+	existing, ok := ds.Users[u.ID]
+	if !ok {
+		return apperror.NewNotFound("USER_NOT_FOUND", "User does not exist")
+	}
+
+	uid, ok := ds.Usernames[usernameKey(u.Username)]
+	if ok && uid != u.ID {
+		return apperror.NewAlreadyExists("USERNAME_TAKEN", "Username already exists")
 	}
 
+	delete(ds.Usernames, usernameKey(existing.Username))
 	ds.Users[u.ID] = u
+	ds.Usernames[usernameKey(u.Username)] = u.ID
 
 	return nil
 }
 
 // AddTweet adds a tweets to the datastore
 func (ds *Datastore) AddTweet(t tweet.Tweet) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	if t.ID == "" || t.UserID == "" || t.Username == "" || t.Text == "" {
-		return errors.New("Invalid tweet")
+		return apperror.NewInvalidArgument("INVALID_TWEET", "Invalid tweet")
 	}
 
 	tweets, ok := ds.Tweets[t.UserID]
@@ -103,103 +275,248 @@ func (ds *Datastore) AddTweet(t tweet.Tweet) error {
 		tweets = []tweet.Tweet{}
 	}
 
-	ds.Tweets[t.UserID] = append(tweets, t)
+	// tweets are almost always added in order, but events are not guaranteed to be consumed in the order they were produced
+	i := sort.Search(len(tweets), func(i int) bool { return newer(tweets[i], t) })
+	tweets = append(tweets, tweet.Tweet{})
+	copy(tweets[i+1:], tweets[i:])
+	tweets[i] = t
+
+	ds.Tweets[t.UserID] = tweets
+	ds.TweetOwners[t.ID] = t.UserID
+
+	return nil
+}
+
+// UpdateTweet replaces an existing tweet in the datastore (e.g., after it has been edited)
+func (ds *Datastore) UpdateTweet(t tweet.Tweet) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if t.ID == "" || t.UserID == "" || t.Username == "" || t.Text == "" {
+		return apperror.NewInvalidArgument("INVALID_TWEET", "Invalid tweet")
+	}
+
+	i, ok := ds.findTweet(t.ID)
+	if !ok || ds.TweetOwners[t.ID] != t.UserID {
+		return apperror.NewNotFound("TWEET_NOT_FOUND", "Tweet not found")
+	}
+
+	// the tweet keeps its place in its author's list of tweets since it keeps its creation time
+	t.CreatedAt = ds.Tweets[t.UserID][i].CreatedAt
+	ds.Tweets[t.UserID][i] = t
 
 	return nil
 }
 
+// RemoveTweet removes a tweet from the datastore
+func (ds *Datastore) RemoveTweet(tweetID string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	i, ok := ds.findTweet(tweetID)
+	if !ok {
+		return apperror.NewNotFound("TWEET_NOT_FOUND", "Tweet not found")
+	}
+
+	userID := ds.TweetOwners[tweetID]
+	tweets := ds.Tweets[userID]
+	ds.Tweets[userID] = append(tweets[:i:i], tweets[i+1:]...)
+	delete(ds.TweetOwners, tweetID)
+
+	return nil
+}
+
+// findTweet returns the index of a tweet within its author's list of tweets (the caller must hold the lock)
+func (ds *Datastore) findTweet(tweetID string) (int, bool) {
+	userID, ok := ds.TweetOwners[tweetID]
+	if !ok {
+		return 0, false
+	}
+
+	for i, t := range ds.Tweets[userID] {
+		if t.ID == tweetID {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
 // AddFollow adds a follow to the datastore (in both the follower's list of followees and followee's list of followers)
 func (ds *Datastore) AddFollow(f follow.Follow) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	if f.FollowerUserID == "" || f.FollowerUsername == "" || f.FolloweeUserID == "" || f.FolloweeUsername == "" {
-		return errors.New("Invalid follow")
+		return apperror.NewInvalidArgument("INVALID_FOLLOW", "Invalid follow")
 	}
 
 	followers, ok := ds.Followers[f.FolloweeUserID]
 	if !ok {
 		followers = []follow.Follow{}
 	}
-	ds.Followers[f.FolloweeUserID] = append(followers, f)
+	ds.Followers[f.FolloweeUserID] = insertFollow(followers, f, follower)
 
 	followees, ok := ds.Followees[f.FollowerUserID]
 	if !ok {
 		followees = []follow.Follow{}
 	}
-	ds.Followees[f.FollowerUserID] = append(followees, f)
+	ds.Followees[f.FollowerUserID] = insertFollow(followees, f, followee)
 
 	return nil
 }
 
+// RemoveFollow removes a follow from the datastore (from both the follower's list of followees and followee's list of followers)
+// The follower's timeline stops including the followee's tweets immediately since timelines are built from the list of followees
+func (ds *Datastore) RemoveFollow(followerUserID user.ID, followeeUserID user.ID) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if followerUserID == "" || followeeUserID == "" {
+		return apperror.NewInvalidArgument("INVALID_FOLLOW", "Invalid follow")
+	}
+
+	followers := ds.Followers[followeeUserID]
+	for i, f := range followers {
+		if f.FollowerUserID == followerUserID {
+			ds.Followers[followeeUserID] = append(followers[:i:i], followers[i+1:]...)
+			break
+		}
+	}
+
+	followees := ds.Followees[followerUserID]
+	for i, f := range followees {
+		if f.FolloweeUserID == followeeUserID {
+			ds.Followees[followerUserID] = append(followees[:i:i], followees[i+1:]...)
+			return nil
+		}
+	}
+
+	return apperror.NewNotFound("FOLLOW_NOT_FOUND", "Follow not found")
+}
+
 // GetUserByUserID returns a user given a userID
 func (ds *Datastore) GetUserByUserID(userID user.ID) (user.User, error) {
+	ds.mu.RLock()
 	u, ok := ds.Users[userID]
+	ds.mu.RUnlock()
+
 	if !ok {
-		return user.User{}, errors.New("Invalid UserID")
+		return user.User{}, apperror.NewNotFound("USER_NOT_FOUND", "Invalid UserID")
 	}
 
-	return user.User{
-		ID:       userID,
-		Username: u.Username,
-		Password: u.Password,
-	}, nil
+	return ds.withPasswordHash(u)
 }
 
 // GetUserByUsername returns a user given a username
 func (ds *Datastore) GetUserByUsername(username string) (user.User, error) {
-	for uid, u := range ds.Users {
-		if u.Username == username {
-			return user.User{
-				ID:       uid,
-				Username: u.Username,
-				Password: u.Password,
-			}, nil
-		}
+	ds.mu.RLock()
+	uid, ok := ds.Usernames[usernameKey(username)]
+	u := ds.Users[uid]
+	ds.mu.RUnlock()
+
+	if !ok {
+		return user.User{}, nil
 	}
 
-	return user.User{}, nil
+	return ds.withPasswordHash(u)
 }
 
-// GetFollowers TO DO
-func (ds *Datastore) GetFollowers(userID user.ID) ([]follow.Follow, error) {
-	followers, ok := ds.Followers[userID]
-	if !ok {
-		return []follow.Follow{}, nil
+// withPasswordHash returns a user with its password hash, which is fetched from the Database Access service (and kept)
+// if the user was restored from a snapshot
+func (ds *Datastore) withPasswordHash(u user.User) (user.User, error) {
+	if u.PasswordHash != "" || ds.UserRepository == nil {
+		return u, nil
 	}
 
-	return followers, nil
-}
+	found, err := ds.UserRepository.FindByID(u.ID)
+	if err != nil {
+		return user.User{}, err
+	}
 
-// GetFollowees returns the tweets of the users that the given user follows
-func (ds *Datastore) GetFollowees(userID user.ID) ([]follow.Follow, error) {
-	followees, ok := ds.Followees[userID]
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	// the user may have changed their password (or been replaced by a swap) in the meantime
+	current, ok := ds.Users[u.ID]
 	if !ok {
-		return []follow.Follow{}, nil
+		u.PasswordHash = found.PasswordHash
+		return u, nil
+	}
+
+	if current.PasswordHash == "" {
+		current.PasswordHash = found.PasswordHash
+		ds.Users[u.ID] = current
 	}
 
-	return followees, nil
+	return current, nil
 }
 
-// GetTweets TO DO
-func (ds *Datastore) GetTweets(userID user.ID) ([]tweet.Tweet, error) {
-	tweets, ok := ds.Tweets[userID]
-	if !ok {
-		return []tweet.Tweet{}, nil
+// usernameKey returns the key of a username in the username index (usernames are unique regardless of case)
+func usernameKey(username string) string {
+	return strings.ToLower(username)
+}
+
+// GetFollow returns the follow between the given follower and followee
+func (ds *Datastore) GetFollow(followerUserID user.ID, followeeUserID user.ID) (follow.Follow, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	for _, f := range ds.Followees[followerUserID] {
+		if f.FolloweeUserID == followeeUserID {
+			return f, nil
+		}
 	}
 
-	return tweets, nil
+	return follow.Follow{}, apperror.NewNotFound("FOLLOW_NOT_FOUND", "Follow not found")
 }
 
-// GetTimeline returns the tweets of the users that the given user follows
-func (ds *Datastore) GetTimeline(userID user.ID) ([]tweet.Tweet, error) {
-	followees, ok := ds.Followees[userID]
+// GetFollowers returns up to limit followers of the given user, newest first and starting after the given cursor
+func (ds *Datastore) GetFollowers(userID user.ID, after *pagination.Cursor, limit int) ([]follow.Follow, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return pageFollows(ds.Followers[userID], follower, after, limit), nil
+}
+
+// GetFollowees returns up to limit followees (i.e., users that the given user follows), newest first and starting after the given cursor
+func (ds *Datastore) GetFollowees(userID user.ID, after *pagination.Cursor, limit int) ([]follow.Follow, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return pageFollows(ds.Followees[userID], followee, after, limit), nil
+}
+
+// GetTweet returns a tweet given a tweet ID
+func (ds *Datastore) GetTweet(tweetID string) (tweet.Tweet, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	i, ok := ds.findTweet(tweetID)
 	if !ok {
-		return []tweet.Tweet{}, nil
+		return tweet.Tweet{}, apperror.NewNotFound("TWEET_NOT_FOUND", "Tweet not found")
 	}
 
-	var timeline []tweet.Tweet
-	for _, f := range followees {
-		tweets := ds.Tweets[f.FolloweeUserID]
-		timeline = append(timeline, tweets...)
+	return ds.Tweets[ds.TweetOwners[tweetID]][i], nil
+}
+
+// GetTweets returns up to limit tweets of the given user, newest first and starting after the given cursor
+func (ds *Datastore) GetTweets(userID user.ID, after *pagination.Cursor, limit int) ([]tweet.Tweet, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return pageTweets(ds.Tweets[userID], after, limit), nil
+}
+
+// GetTimeline returns up to limit tweets of the users that the given user follows, newest first and starting after the given cursor
+func (ds *Datastore) GetTimeline(userID user.ID, after *pagination.Cursor, limit int) ([]tweet.Tweet, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	lists := [][]tweet.Tweet{}
+	for _, f := range ds.Followees[userID] {
+		lists = append(lists, tweetsBefore(ds.Tweets[f.FolloweeUserID], after))
 	}
 
-	return timeline, nil
+	return mergeNewestFirst(lists, limit), nil
 }
@@ -0,0 +1,199 @@
+package datastore
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+)
+
+const (
+	benchUsers         = 1000
+	benchFolloweesEach = 50
+	benchTweetsEach    = 20
+	benchPageSize      = 20
+)
+
+var benchStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// seed returns a data store holding benchUsers users, who each follow benchFolloweesEach others and have benchTweetsEach tweets
+func seed(tb testing.TB) *Datastore {
+	tb.Helper()
+
+	ds := (&Datastore{}).fresh()
+	for i := 0; i < benchUsers; i++ {
+		err := ds.AddUser(user.User{ID: benchUserID(i), Username: fmt.Sprintf("user%d", i), CreatedAt: benchStart})
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	for i := 0; i < benchUsers; i++ {
+		for j := 1; j <= benchFolloweesEach; j++ {
+			err := ds.AddFollow(benchFollow(i, (i+j)%benchUsers, benchStart.Add(time.Duration(j)*time.Second)))
+			if err != nil {
+				tb.Fatal(err)
+			}
+		}
+
+		for j := 0; j < benchTweetsEach; j++ {
+			err := ds.AddTweet(benchTweet(fmt.Sprintf("tweet-%d-%d", i, j), i, benchStart.Add(time.Duration(j)*time.Minute)))
+			if err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+
+	return ds
+}
+
+func benchUserID(i int) user.ID {
+	return user.ID(fmt.Sprintf("user-%d", i))
+}
+
+func benchFollow(follower int, followee int, createdAt time.Time) follow.Follow {
+	return follow.Follow{
+		FollowerUserID:   benchUserID(follower),
+		FollowerUsername: fmt.Sprintf("user%d", follower),
+		FolloweeUserID:   benchUserID(followee),
+		FolloweeUsername: fmt.Sprintf("user%d", followee),
+		CreatedAt:        createdAt,
+	}
+}
+
+func benchTweet(id string, author int, createdAt time.Time) tweet.Tweet {
+	return tweet.Tweet{
+		ID:        id,
+		UserID:    benchUserID(author),
+		Username:  fmt.Sprintf("user%d", author),
+		Text:      "Hello world",
+		CreatedAt: createdAt,
+	}
+}
+
+// read serves a request of the API Gateway: mostly timelines, then tweets and followers
+func read(ds *Datastore, r *rand.Rand) error {
+	id := benchUserID(r.Intn(benchUsers))
+
+	var err error
+	switch n := r.Intn(10); {
+	case n < 6:
+		_, err = ds.GetTimeline(id, nil, benchPageSize)
+	case n < 8:
+		_, err = ds.GetTweets(id, nil, benchPageSize)
+	case n < 9:
+		_, err = ds.GetFollowers(id, nil, benchPageSize)
+	default:
+		_, err = ds.GetUserByUserID(id)
+	}
+
+	return err
+}
+
+var benchTweetSeq int64
+
+// write applies a database change, as the change watcher does: mostly new tweets, then follows and unfollows
+func write(ds *Datastore, r *rand.Rand) error {
+	follower := r.Intn(benchUsers)
+
+	var err error
+	switch n := r.Intn(10); {
+	case n < 6:
+		seq := atomic.AddInt64(&benchTweetSeq, 1)
+		err = ds.AddTweet(benchTweet(fmt.Sprintf("bench-tweet-%d", seq), follower, benchStart.Add(time.Duration(seq)*time.Millisecond)))
+	case n < 8:
+		// follows a user beyond the seeded followees, if not already following them
+		followee := (follower + benchFolloweesEach + 1 + r.Intn(benchUsers-benchFolloweesEach-1)) % benchUsers
+		if _, err = ds.GetFollow(benchUserID(follower), benchUserID(followee)); err != nil {
+			err = ds.AddFollow(benchFollow(follower, followee, time.Now()))
+		}
+	default:
+		followee := (follower + benchFolloweesEach + 1 + r.Intn(benchUsers-benchFolloweesEach-1)) % benchUsers
+		_ = ds.RemoveFollow(benchUserID(follower), benchUserID(followee)) // the follow may not exist
+	}
+
+	return err
+}
+
+// benchmarkWorkload runs reads and writes in parallel, writing in writePercent percent of operations
+func benchmarkWorkload(b *testing.B, writePercent int) {
+	ds := seed(b)
+	var src int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(atomic.AddInt64(&src, 1)))
+		for pb.Next() {
+			op := read
+			if r.Intn(100) < writePercent {
+				op = write
+			}
+
+			err := op(ds, r)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkReadHeavy(b *testing.B) {
+	benchmarkWorkload(b, 1)
+}
+
+func BenchmarkMixed(b *testing.B) {
+	benchmarkWorkload(b, 20)
+}
+
+func BenchmarkWriteHeavy(b *testing.B) {
+	benchmarkWorkload(b, 80)
+}
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	ds := seed(t)
+
+	done := make(chan struct{})
+	for g := 0; g < 8; g++ {
+		go func(g int) {
+			defer func() { done <- struct{}{} }()
+
+			r := rand.New(rand.NewSource(int64(g)))
+			op := read
+			if g%2 == 0 {
+				op = write
+			}
+
+			for i := 0; i < 500; i++ {
+				err := op(ds, r)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	for g := 0; g < 8; g++ {
+		<-done
+	}
+
+	for id, tweets := range ds.Tweets {
+		for i := 1; i < len(tweets); i++ {
+			if newer(tweets[i-1], tweets[i]) {
+				t.Fatalf("tweets of %s are out of order at %d", id, i)
+			}
+		}
+
+		for _, tw := range tweets {
+			if ds.TweetOwners[tw.ID] != id {
+				t.Fatalf("tweet %s is not indexed under its author %s", tw.ID, id)
+			}
+		}
+	}
+}
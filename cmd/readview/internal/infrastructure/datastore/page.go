@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/pagination"
+)
+
+// olderThan reports whether an item with the given creation time and ID comes after the cursor when sorted newest first
+func olderThan(t time.Time, id string, c pagination.Cursor) bool {
+	if t.Equal(c.Time) {
+		return id < c.ID
+	}
+
+	return t.Before(c.Time)
+}
+
+// tweetsBefore returns the tweets of a list sorted oldest first that come after the cursor when sorted newest first
+func tweetsBefore(tweets []tweet.Tweet, after *pagination.Cursor) []tweet.Tweet {
+	if after == nil {
+		return tweets
+	}
+
+	end := sort.Search(len(tweets), func(i int) bool { return !olderThan(tweets[i].CreatedAt, tweets[i].ID, *after) })
+
+	return tweets[:end]
+}
+
+// pageTweets returns up to limit tweets of a list sorted oldest first, newest first and starting after the cursor
+func pageTweets(tweets []tweet.Tweet, after *pagination.Cursor, limit int) []tweet.Tweet {
+	tweets = tweetsBefore(tweets, after)
+
+	page := []tweet.Tweet{}
+	for i := len(tweets) - 1; i >= 0 && len(page) < limit; i-- {
+		page = append(page, tweets[i])
+	}
+
+	return page
+}
+
+// pageFollows returns up to limit follows of a list sorted oldest first, newest first and starting after the cursor
+// id returns the ID that breaks ties between follows created at the same time (i.e., the ID of the other user in the list)
+func pageFollows(follows []follow.Follow, id func(follow.Follow) user.ID, after *pagination.Cursor, limit int) []follow.Follow {
+	end := len(follows)
+	if after != nil {
+		end = sort.Search(len(follows), func(i int) bool { return !olderThan(follows[i].CreatedAt, string(id(follows[i])), *after) })
+	}
+
+	page := []follow.Follow{}
+	for i := end - 1; i >= 0 && len(page) < limit; i-- {
+		page = append(page, follows[i])
+	}
+
+	return page
+}
+
+// insertFollow inserts a follow into a list sorted oldest first
+func insertFollow(follows []follow.Follow, f follow.Follow, id func(follow.Follow) user.ID) []follow.Follow {
+	i := sort.Search(len(follows), func(i int) bool {
+		return !olderThan(follows[i].CreatedAt, string(id(follows[i])), pagination.Cursor{Time: f.CreatedAt, ID: string(id(f))})
+	})
+
+	follows = append(follows, follow.Follow{})
+	copy(follows[i+1:], follows[i:])
+	follows[i] = f
+
+	return follows
+}
+
+func follower(f follow.Follow) user.ID { return f.FollowerUserID }
+func followee(f follow.Follow) user.ID { return f.FolloweeUserID }
@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"container/heap"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
+)
+
+// mergeNewestFirst merges lists of tweets that are each sorted oldest first into a single list of up to limit tweets sorted newest first
+// It is a k-way merge, so building a page of a timeline takes O(k + limit log k) time for k followees
+func mergeNewestFirst(lists [][]tweet.Tweet, limit int) []tweet.Tweet {
+	h := tweetHeap{}
+	size := 0
+	for _, l := range lists {
+		if len(l) > 0 {
+			h = append(h, cursor{tweets: l, next: len(l) - 1})
+			size += len(l)
+		}
+	}
+	heap.Init(&h)
+
+	if size > limit {
+		size = limit
+	}
+
+	merged := make([]tweet.Tweet, 0, size)
+	for h.Len() > 0 && len(merged) < limit {
+		c := &h[0]
+		merged = append(merged, c.tweets[c.next])
+
+		c.next--
+		if c.next < 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+
+	return merged
+}
+
+// newer orders tweets by creation time, breaking ties by ID so that timelines are deterministic
+func newer(a tweet.Tweet, b tweet.Tweet) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.ID > b.ID
+	}
+
+	return a.CreatedAt.After(b.CreatedAt)
+}
+
+// a cursor points to the newest tweet of a list that has not been merged yet
+type cursor struct {
+	tweets []tweet.Tweet
+	next   int
+}
+
+// tweetHeap is a max-heap of cursors ordered by the creation time of the tweet they point to
+type tweetHeap []cursor
+
+func (h tweetHeap) Len() int           { return len(h) }
+func (h tweetHeap) Less(i, j int) bool { return newer(h[i].tweets[h[i].next], h[j].tweets[h[j].next]) }
+func (h tweetHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *tweetHeap) Push(x interface{}) {
+	*h = append(*h, x.(cursor))
+}
+
+func (h *tweetHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	*h = old[:n-1]
+
+	return c
+}
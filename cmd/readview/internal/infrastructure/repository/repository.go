@@ -2,35 +2,75 @@ package repository
 
 import (
 	"context"
+	"io"
+	"log"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	dbaccesspb "github.com/martinmhan/tweet-app-api/cmd/databaseaccess/proto"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/event"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/follow"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/tweet"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/user"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
 )
 
+// maxResumes is how many times in a row a bulk load resumes after its stream is interrupted without receiving anything
+const maxResumes = 3
+
 // UserRepository implements the User repository
 type UserRepository struct {
 	dbaccesspb.DatabaseAccessClient
 }
 
-// FindAll TO DO
+// FindAll streams every user from the Database Access service
 func (ur *UserRepository) FindAll() ([]user.User, error) {
-	pbUsers, err := ur.DatabaseAccessClient.GetAllUsers(context.TODO(), &dbaccesspb.GetAllUsersParam{})
+	users := []user.User{}
+	err := receiveAll(func(afterID string) (string, error) {
+		stream, err := ur.DatabaseAccessClient.GetAllUsers(context.TODO(), &dbaccesspb.BulkLoadParam{AfterID: afterID})
+		if err != nil {
+			return afterID, err
+		}
+
+		for {
+			u, err := stream.Recv()
+			if err == io.EOF {
+				return afterID, nil
+			}
+			if err != nil {
+				return afterID, err
+			}
+
+			users = append(users, user.User{
+				ID:           user.ID(u.ID),
+				Username:     u.Username,
+				PasswordHash: u.PasswordHash,
+				CreatedAt:    timeOf(u.CreatedAt),
+			})
+			afterID = u.ID
+		}
+	})
 	if err != nil {
 		return []user.User{}, err
 	}
 
-	var users []user.User
-	for _, u := range pbUsers.Users {
-		users = append(users, user.User{
-			ID:       user.ID(u.ID),
-			Username: u.Username,
-			Password: u.Password,
-		})
+	return users, nil
+}
+
+// FindByID gets a user (including its password hash) from the Database Access service
+func (ur *UserRepository) FindByID(id user.ID) (user.User, error) {
+	u, err := ur.DatabaseAccessClient.GetUser(context.TODO(), &dbaccesspb.UserID{UserID: string(id)})
+	if err != nil {
+		return user.User{}, err
 	}
 
-	return users, nil
+	return user.User{
+		ID:           user.ID(u.ID),
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		CreatedAt:    timeOf(u.CreatedAt),
+	}, nil
 }
 
 // FollowRepository implements the Follow repository
@@ -38,23 +78,38 @@ type FollowRepository struct {
 	dbaccesspb.DatabaseAccessClient
 }
 
-// FindAll TO DO
+// FindAll streams every follow from the Database Access service
 func (ur *FollowRepository) FindAll() ([]follow.Follow, error) {
-	pbFollows, err := ur.DatabaseAccessClient.GetAllFollows(context.TODO(), &dbaccesspb.GetAllFollowsParam{})
+	follows := []follow.Follow{}
+	err := receiveAll(func(afterID string) (string, error) {
+		stream, err := ur.DatabaseAccessClient.GetAllFollows(context.TODO(), &dbaccesspb.BulkLoadParam{AfterID: afterID})
+		if err != nil {
+			return afterID, err
+		}
+
+		for {
+			f, err := stream.Recv()
+			if err == io.EOF {
+				return afterID, nil
+			}
+			if err != nil {
+				return afterID, err
+			}
+
+			follows = append(follows, follow.Follow{
+				FollowerUserID:   user.ID(f.FollowerUserID),
+				FollowerUsername: f.FollowerUsername,
+				FolloweeUserID:   user.ID(f.FolloweeUserID),
+				FolloweeUsername: f.FolloweeUsername,
+				CreatedAt:        timeOf(f.CreatedAt),
+			})
+			afterID = f.ID
+		}
+	})
 	if err != nil {
 		return []follow.Follow{}, err
 	}
 
-	var follows []follow.Follow
-	for _, f := range pbFollows.Follows {
-		follows = append(follows, follow.Follow{
-			FollowerUserID:   user.ID(f.FollowerUserID),
-			FollowerUsername: f.FollowerUsername,
-			FolloweeUserID:   user.ID(f.FolloweeUserID),
-			FolloweeUsername: f.FolloweeUsername,
-		})
-	}
-
 	return follows, nil
 }
 
@@ -63,22 +118,142 @@ type TweetRepository struct {
 	dbaccesspb.DatabaseAccessClient
 }
 
-// FindAll TO DO
+// FindAll streams every tweet from the Database Access service
 func (ur *TweetRepository) FindAll() ([]tweet.Tweet, error) {
-	pbTweets, err := ur.DatabaseAccessClient.GetAllTweets(context.TODO(), &dbaccesspb.GetAllTweetsParam{})
+	tweets := []tweet.Tweet{}
+	err := receiveAll(func(afterID string) (string, error) {
+		stream, err := ur.DatabaseAccessClient.GetAllTweets(context.TODO(), &dbaccesspb.BulkLoadParam{AfterID: afterID})
+		if err != nil {
+			return afterID, err
+		}
+
+		for {
+			t, err := stream.Recv()
+			if err == io.EOF {
+				return afterID, nil
+			}
+			if err != nil {
+				return afterID, err
+			}
+
+			tw := tweet.Tweet{
+				ID:        t.ID,
+				UserID:    user.ID(t.UserID),
+				Username:  t.Username,
+				Text:      t.Text,
+				CreatedAt: timeOf(t.CreatedAt),
+				EditedAt:  timeOf(t.EditedAt),
+			}
+
+			for _, r := range t.Revisions {
+				tw.Revisions = append(tw.Revisions, tweet.Revision{Text: r.Text, CreatedAt: timeOf(r.CreatedAt)})
+			}
+
+			tweets = append(tweets, tw)
+			afterID = t.ID
+		}
+	})
 	if err != nil {
 		return []tweet.Tweet{}, err
 	}
 
-	var tweets []tweet.Tweet
-	for _, t := range pbTweets.Tweets {
-		tweets = append(tweets, tweet.Tweet{
-			ID:       t.ID,
-			UserID:   user.ID(t.UserID),
-			Username: t.Username,
-			Text:     t.Text,
-		})
+	return tweets, nil
+}
+
+// receiveAll runs a bulk load, which receives items from a stream (starting after the given ID) and returns the ID of the
+// last item it received. Items are streamed in ID order, so when the stream is interrupted (i.e., the Database Access service
+// or the connection to it failed), the bulk load resumes after that ID rather than starting over
+func receiveAll(load func(afterID string) (lastID string, err error)) error {
+	afterID := ""
+	resumes := 0
+	for {
+		lastID, err := load(afterID)
+		if err == nil {
+			return nil
+		}
+
+		if lastID != afterID {
+			resumes = 0
+		}
+		if !apperror.Is(err, apperror.Unavailable) || resumes == maxResumes {
+			return err
+		}
+
+		log.Printf("Bulk load interrupted, resuming after %q: %s", lastID, err)
+		afterID = lastID
+		resumes++
+	}
+}
+
+// EventRepository implements the Event repository
+type EventRepository struct {
+	dbaccesspb.DatabaseAccessClient
+}
+
+// Head fetches the position of the last event recorded in the Database Access service's event store
+func (er *EventRepository) Head() (int64, error) {
+	head, err := er.DatabaseAccessClient.GetEventStoreHead(context.TODO(), &dbaccesspb.GetEventStoreHeadParam{})
+	if err != nil {
+		return 0, err
 	}
 
-	return tweets, nil
+	return head.Position, nil
+}
+
+// Read fetches up to limit events recorded after the given position from the Database Access service's event store, oldest first
+func (er *EventRepository) Read(afterPosition int64, limit int) ([]event.Event, error) {
+	pbEvents, err := er.DatabaseAccessClient.GetEvents(
+		context.TODO(),
+		&dbaccesspb.GetEventsParam{AfterPosition: afterPosition, PageSize: int32(limit)},
+	)
+	if err != nil {
+		return []event.Event{}, err
+	}
+
+	events := []event.Event{}
+	for _, e := range pbEvents.Events {
+		ev := event.Event{Position: e.Position, Type: event.Type(e.Type), RecordedAt: e.RecordedAt.AsTime()}
+		if e.User != nil {
+			ev.User = user.User{
+				ID:           user.ID(e.User.ID),
+				Username:     e.User.Username,
+				PasswordHash: e.User.PasswordHash,
+				CreatedAt:    timeOf(e.User.CreatedAt),
+			}
+		}
+
+		if e.Follow != nil {
+			ev.Follow = follow.Follow{
+				FollowerUserID:   user.ID(e.Follow.FollowerUserID),
+				FollowerUsername: e.Follow.FollowerUsername,
+				FolloweeUserID:   user.ID(e.Follow.FolloweeUserID),
+				FolloweeUsername: e.Follow.FolloweeUsername,
+				CreatedAt:        timeOf(e.Follow.CreatedAt),
+			}
+		}
+
+		if e.Tweet != nil {
+			ev.Tweet = tweet.Tweet{
+				ID:        e.Tweet.ID,
+				UserID:    user.ID(e.Tweet.UserID),
+				Username:  e.Tweet.Username,
+				Text:      e.Tweet.Text,
+				CreatedAt: timeOf(e.Tweet.CreatedAt),
+				EditedAt:  timeOf(e.Tweet.EditedAt),
+			}
+		}
+
+		events = append(events, ev)
+	}
+
+	return events, nil
+}
+
+// timeOf converts a protobuf timestamp to a time, leaving unset timestamps as the zero time
+func timeOf(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+
+	return ts.AsTime()
 }
@@ -0,0 +1,164 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/domain/snapshot"
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// magic starts every snapshot file, followed by the CRC-32 checksum of the rest of the file (the gzipped, gob-encoded snapshot)
+const magic = "RVSNAP1\n"
+
+// DefaultKeep is how many snapshots a FileStore with no Keep keeps
+const DefaultKeep = 3
+
+// FileStore keeps snapshots as files in a directory, named by when they were taken so the latest sorts last
+// Each file is written to a temporary file and renamed into place, and has a checksum, so a snapshot that was only partly
+// written (or was corrupted since) is skipped in favor of the one before it. Only the latest Keep snapshots are kept
+// Snapshots hold every user's data, so the directory and files are only accessible to the service's own user
+type FileStore struct {
+	Dir  string
+	Keep int
+}
+
+// Save writes a snapshot and removes the snapshots older than the ones kept
+func (fs *FileStore) Save(s snapshot.Snapshot) error {
+	var payload bytes.Buffer
+	zw := gzip.NewWriter(&payload)
+	err := gob.NewEncoder(zw).Encode(s)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, "SNAPSHOT_UNENCODABLE", "Failed to encode snapshot", err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(magic)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(payload.Bytes()))
+	b.Write(payload.Bytes())
+
+	err = os.MkdirAll(fs.Dir, 0700)
+	if err == nil {
+		err = os.Chmod(fs.Dir, 0700) // the directory may have been created with wider permissions
+	}
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, "SNAPSHOT_UNWRITABLE", "Failed to create snapshot directory", err)
+	}
+
+	path := filepath.Join(fs.Dir, fmt.Sprintf("snapshot-%020d.snap", s.TakenAt.UnixNano()))
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, b.Bytes(), 0600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		return apperror.Wrap(apperror.Internal, "SNAPSHOT_UNWRITABLE", "Failed to save snapshot", err)
+	}
+
+	fs.prune()
+
+	return nil
+}
+
+// Latest reads the most recent intact snapshot
+func (fs *FileStore) Latest() (snapshot.Snapshot, error) {
+	paths, err := fs.paths()
+	if err != nil {
+		return snapshot.Snapshot{}, apperror.Wrap(apperror.Internal, "SNAPSHOT_UNREADABLE", "Failed to list snapshots", err)
+	}
+
+	for i := len(paths) - 1; i >= 0; i-- {
+		s, err := read(paths[i])
+		if err != nil {
+			log.Printf("Skipping snapshot %s: %s", paths[i], err)
+			continue
+		}
+
+		return s, nil
+	}
+
+	return snapshot.Snapshot{}, apperror.NewNotFound("SNAPSHOT_NOT_FOUND", "No snapshot found")
+}
+
+// read reads and verifies a snapshot file
+func read(path string) (snapshot.Snapshot, error) {
+	var s snapshot.Snapshot
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+
+	if len(b) < len(magic)+4 || string(b[:len(magic)]) != magic {
+		return s, fmt.Errorf("not a snapshot file")
+	}
+
+	payload := b[len(magic)+4:]
+	if binary.BigEndian.Uint32(b[len(magic):]) != crc32.ChecksumIEEE(payload) {
+		return s, fmt.Errorf("checksum mismatch")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return s, err
+	}
+
+	err = gob.NewDecoder(zr).Decode(&s)
+	return s, err
+}
+
+// paths returns the paths of the snapshot files, oldest first
+func (fs *FileStore) paths() ([]string, error) {
+	files, err := ioutil.ReadDir(fs.Dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasPrefix(f.Name(), "snapshot-") && strings.HasSuffix(f.Name(), ".snap") {
+			paths = append(paths, filepath.Join(fs.Dir, f.Name()))
+		}
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// prune removes all but the latest Keep snapshots
+func (fs *FileStore) prune() {
+	keep := fs.Keep
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+
+	paths, err := fs.paths()
+	if err != nil {
+		log.Printf("Failed to list snapshots: %s", err)
+		return
+	}
+
+	for i := 0; i < len(paths)-keep; i++ {
+		err := os.Remove(paths[i])
+		if err != nil {
+			log.Printf("Failed to remove snapshot %s: %s", paths[i], err)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"log"
 	"net"
 	"os"
@@ -14,7 +13,12 @@ import (
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/application"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/infrastructure/datastore"
 	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/infrastructure/repository"
+	"github.com/martinmhan/tweet-app-api/cmd/readview/internal/infrastructure/snapshot"
 	pb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/broker/rabbitmq"
+	"github.com/martinmhan/tweet-app-api/internal/grpcclient"
+	"github.com/martinmhan/tweet-app-api/internal/pagination"
+	"github.com/martinmhan/tweet-app-api/internal/readiness"
 )
 
 func main() {
@@ -23,15 +27,44 @@ func main() {
 	port := os.Getenv("RV_PORT")
 	daHost := os.Getenv("DA_HOST")
 	daPort := os.Getenv("DA_PORT")
-	if port == "" || daHost == "" || daPort == "" {
+	pageTokenKey := os.Getenv("PAGE_TOKEN_KEY")
+	mqHost := os.Getenv("MQ_HOST")
+	mqPort := os.Getenv("MQ_PORT")
+	mqName := os.Getenv("MQ_NAME")
+	snapshotDir := os.Getenv("RV_SNAPSHOT_DIR")
+	snapshotInterval := os.Getenv("RV_SNAPSHOT_INTERVAL") // optional, defaults to 1m
+	changeFeed := os.Getenv("RV_CHANGE_FEED")             // optional, defaults to watch
+	adminPort := os.Getenv("RV_ADMIN_PORT")               // optional, defaults to 8085
+	if port == "" || daHost == "" || daPort == "" || pageTokenKey == "" || snapshotDir == "" {
 		log.Fatal("Missing environment variable(s). Please edit .env file")
 	}
 
-	target := daHost + ":" + daPort
-	ctx, cancel := context.WithTimeout(context.TODO(), 1000*time.Millisecond)
-	defer cancel()
+	if changeFeed == "" {
+		changeFeed = "watch"
+	}
+
+	if adminPort == "" {
+		adminPort = "8085"
+	}
 
-	conn, err := grpc.DialContext(ctx, target, grpc.WithInsecure(), grpc.WithBlock())
+	if changeFeed != "watch" && changeFeed != "rabbitmq" {
+		log.Fatal("Invalid RV_CHANGE_FEED: ", changeFeed)
+	}
+
+	if changeFeed == "rabbitmq" && (mqHost == "" || mqPort == "" || mqName == "") {
+		log.Fatal("Missing environment variable(s). Please edit .env file")
+	}
+
+	snapshotEvery := time.Minute
+	if snapshotInterval != "" {
+		d, err := time.ParseDuration(snapshotInterval)
+		if err != nil || d <= 0 {
+			log.Fatal("Invalid RV_SNAPSHOT_INTERVAL: ", snapshotInterval)
+		}
+		snapshotEvery = d
+	}
+
+	conn, err := grpcclient.Dial(daHost + ":" + daPort)
 	if err != nil {
 		log.Fatal("Failed to connect to Database Access service")
 	}
@@ -42,22 +75,65 @@ func main() {
 	ur := repository.UserRepository{DatabaseAccessClient: daClient}
 	fr := repository.FollowRepository{DatabaseAccessClient: daClient}
 	tr := repository.TweetRepository{DatabaseAccessClient: daClient}
+	er := repository.EventRepository{DatabaseAccessClient: daClient}
 
 	ds := datastore.Datastore{
 		UserRepository:   &ur,
 		FollowRepository: &fr,
 		TweetRepository:  &tr,
+		EventRepository:  &er,
 	}
 
-	err = ds.Initialize()
-	if err != nil {
-		log.Fatal("Failed to initialize data store: ", err)
+	replayer := &application.Replayer{Datastore: &ds, Events: &er}
+
+	// the data store is loaded from the latest snapshot and the events recorded since, rather than fetched in full
+	snapshotter := &application.Snapshotter{
+		Datastore: &ds,
+		Snapshots: &snapshot.FileStore{Dir: snapshotDir},
+		Replayer:  replayer,
+		Interval:  snapshotEvery,
 	}
 
-	g := grpc.NewServer()
-	s := &application.ReadViewServer{Datastore: &ds}
+	// changes are watched via the Database Access service's change feed, or consumed from the exchange its outbox relay publishes to
+	var syncer application.Syncer
+	switch changeFeed {
+	case "rabbitmq":
+		mqConn := rabbitmq.Supervise(rabbitmq.URL(mqHost, mqPort))
+		defer mqConn.Close()
+
+		syncer = &application.ChangeListener{Connection: mqConn, ExchangeName: mqName + ".changes", Datastore: &ds, Load: snapshotter.Load}
+	default:
+		syncer = &application.ChangeWatcher{Client: daClient, Datastore: &ds, Load: snapshotter.Load}
+	}
+	replayer.Syncer = syncer
+
+	go snapshotter.Run()
+	go syncer.Run()
+
+	// reads are rejected until the data store is loaded and receiving changes
+	gate := readiness.NewGate(syncer.Synced)
+	go gate.Run()
+
+	g := grpc.NewServer(grpc.UnaryInterceptor(gate.Unary()))
+	gate.Register(g)
+	s := &application.ReadViewServer{Datastore: &ds, Pages: pagination.Codec{Key: []byte(pageTokenKey)}}
 	pb.RegisterReadViewServer(g, s)
 
+	// replays are only served on the loopback interface, to the replay command run on the same host
+	adminLis, err := net.Listen("tcp", "127.0.0.1:"+adminPort)
+	if err != nil {
+		log.Fatal("Failed to start Read View admin server: ", err)
+	}
+
+	ag := grpc.NewServer()
+	pb.RegisterReadViewAdminServer(ag, &application.AdminServer{Replayer: replayer})
+	go func() {
+		err := ag.Serve(adminLis)
+		if err != nil {
+			log.Fatal("Failed to start Read View admin server: ", err)
+		}
+	}()
+
 	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		log.Fatal("Failed to start Read View server: ", err)
@@ -0,0 +1,59 @@
+// Command replay replays events onto a running Read View, or rebuilds its data store beside the live one and swaps it in
+// It calls the Read View's admin service, which only listens on the loopback interface, so it must run on the same host
+// The Read View's checkpoint is only persisted in its snapshots, so -from is needed to replay from before the latest one
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	pb "github.com/martinmhan/tweet-app-api/cmd/readview/proto"
+	"github.com/martinmhan/tweet-app-api/internal/grpcclient"
+)
+
+func main() {
+	godotenv.Load()
+
+	source := flag.String("source", "events", "where to replay from: events (the event store) or database")
+	rebuild := flag.Bool("rebuild", false, "build a fresh data store and swap it in (always the case for -source=database)")
+	from := flag.Int64("from", 0, "replay the events after this position onto the live data store (defaults to its checkpoint)")
+	timeout := flag.Duration("timeout", time.Hour, "how long to wait for the replay to finish")
+	flag.Parse()
+
+	adminPort := os.Getenv("RV_ADMIN_PORT") // optional, defaults to 8085
+	if adminPort == "" {
+		adminPort = "8085"
+	}
+
+	param := &pb.ReplayParam{Rebuild: *rebuild, FromPosition: *from}
+	switch *source {
+	case "events":
+		param.Source = pb.ReplaySource_EVENT_STORE
+	case "database":
+		param.Source = pb.ReplaySource_DATABASE
+	default:
+		log.Fatal("Invalid -source: ", *source)
+	}
+
+	conn, err := grpcclient.Dial("127.0.0.1:" + adminPort)
+	if err != nil {
+		log.Fatal("Failed to connect to Read View admin service")
+	}
+
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	res, err := pb.NewReadViewAdminClient(conn).Replay(ctx, param)
+	if err != nil {
+		log.Fatal("Failed to replay: ", err)
+	}
+
+	log.Printf("Applied %d event(s), the Read View's checkpoint is now %d", res.Applied, res.Checkpoint)
+}
@@ -0,0 +1,212 @@
+// Package apperror defines the domain errors shared by every service and their mapping to gRPC statuses
+// Handlers can return an *Error directly: gRPC converts it to a status (with ErrorInfo and BadRequest details) via its GRPCStatus method
+package apperror
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain is the ErrorInfo domain of every error produced by this app's services
+const Domain = "tweet-app-api"
+
+// Kind is the category of an error, which determines its gRPC status code
+type Kind int
+
+const (
+	// Internal is an unexpected error
+	Internal Kind = iota
+	// NotFound means the requested entity does not exist
+	NotFound
+	// AlreadyExists means the entity being created already exists
+	AlreadyExists
+	// InvalidArgument means the request is invalid (see the error's field violations)
+	InvalidArgument
+	// Unauthenticated means the request does not have valid credentials
+	Unauthenticated
+	// PermissionDenied means the caller is not allowed to perform the request
+	PermissionDenied
+	// Unavailable means a dependency (e.g., another service, the database or the message queue) could not be reached
+	Unavailable
+	// Aborted means the request conflicted with a concurrent request (e.g., both appended to the same event stream) and can be retried
+	Aborted
+	// DeadlineExceeded means the request's deadline passed before it completed (it may still have been applied)
+	DeadlineExceeded
+	// Canceled means the request was canceled by its caller
+	Canceled
+	// FailedPrecondition means the system is not in the state the request requires
+	FailedPrecondition
+	// ResourceExhausted means a limit was reached (e.g., a rate limit or a message size limit)
+	ResourceExhausted
+)
+
+var kindCodes = [...]codes.Code{
+	codes.Internal,
+	codes.NotFound,
+	codes.AlreadyExists,
+	codes.InvalidArgument,
+	codes.Unauthenticated,
+	codes.PermissionDenied,
+	codes.Unavailable,
+	codes.Aborted,
+	codes.DeadlineExceeded,
+	codes.Canceled,
+	codes.FailedPrecondition,
+	codes.ResourceExhausted,
+}
+
+// Code returns the gRPC status code of the kind
+func (k Kind) Code() codes.Code {
+	return kindCodes[k]
+}
+
+func kindOf(c codes.Code) Kind {
+	for k, code := range kindCodes {
+		if code == c {
+			return Kind(k)
+		}
+	}
+
+	return Internal
+}
+
+// A FieldViolation describes why a request field is invalid
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error is a domain error with a machine-readable reason (e.g., "USERNAME_TAKEN") that clients can branch on
+type Error struct {
+	Kind       Kind
+	Reason     string
+	Message    string
+	Violations []FieldViolation
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying error (if any)
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus converts the error to a gRPC status with ErrorInfo and (if there are field violations) BadRequest details
+func (e *Error) GRPCStatus() *status.Status {
+	s := status.New(e.Kind.Code(), e.Message)
+	if e.Reason != "" {
+		withInfo, err := s.WithDetails(&errdetails.ErrorInfo{Reason: e.Reason, Domain: Domain})
+		if err == nil {
+			s = withInfo
+		}
+	}
+
+	if len(e.Violations) > 0 {
+		br := errdetails.BadRequest{}
+		for _, v := range e.Violations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       v.Field,
+				Description: v.Description,
+			})
+		}
+
+		withBadRequest, err := s.WithDetails(&br)
+		if err == nil {
+			s = withBadRequest
+		}
+	}
+
+	return s
+}
+
+// New returns an error of the given kind
+func New(kind Kind, reason string, message string) *Error {
+	return &Error{Kind: kind, Reason: reason, Message: message}
+}
+
+// Wrap returns an error of the given kind caused by err
+func Wrap(kind Kind, reason string, message string, err error) *Error {
+	return &Error{Kind: kind, Reason: reason, Message: message, Err: err}
+}
+
+// NewNotFound returns a NotFound error
+func NewNotFound(reason string, message string) *Error {
+	return New(NotFound, reason, message)
+}
+
+// NewAlreadyExists returns an AlreadyExists error
+func NewAlreadyExists(reason string, message string) *Error {
+	return New(AlreadyExists, reason, message)
+}
+
+// NewInvalidArgument returns an InvalidArgument error with the given field violations
+func NewInvalidArgument(reason string, message string, violations ...FieldViolation) *Error {
+	return &Error{Kind: InvalidArgument, Reason: reason, Message: message, Violations: violations}
+}
+
+// NewUnauthenticated returns an Unauthenticated error
+func NewUnauthenticated(reason string, message string) *Error {
+	return New(Unauthenticated, reason, message)
+}
+
+// NewPermissionDenied returns a PermissionDenied error
+func NewPermissionDenied(reason string, message string) *Error {
+	return New(PermissionDenied, reason, message)
+}
+
+// NewUnavailable returns an Unavailable error caused by err
+func NewUnavailable(reason string, message string, err error) *Error {
+	return Wrap(Unavailable, reason, message, err)
+}
+
+// FromError converts any error into an *Error
+// Errors returned by gRPC clients keep their status code, reason and field violations so that they propagate faithfully between services
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return Wrap(DeadlineExceeded, "", err.Error(), err)
+		case errors.Is(err, context.Canceled):
+			return Wrap(Canceled, "", err.Error(), err)
+		}
+
+		return Wrap(Internal, "", err.Error(), err)
+	}
+
+	e = Wrap(kindOf(s.Code()), "", s.Message(), err)
+	for _, d := range s.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			e.Reason = d.Reason
+		case *errdetails.BadRequest:
+			for _, v := range d.FieldViolations {
+				e.Violations = append(e.Violations, FieldViolation{Field: v.Field, Description: v.Description})
+			}
+		}
+	}
+
+	return e
+}
+
+// Is checks if err is (or was converted from) an error of the given kind
+func Is(err error, kind Kind) bool {
+	e := FromError(err)
+	return e != nil && e.Kind == kind
+}
@@ -0,0 +1,44 @@
+// Package broker defines the messages exchanged between the event producer and the event consumer through a message broker
+// Its subpackages implement the transports behind the event domain's Publisher and Subscriber interfaces:
+// RabbitMQ (rabbitmq), an embedded NATS server with JetStream (embeddednats) and an in-process broker (inmemory)
+package broker
+
+import "time"
+
+// Transports that can be selected with the MQ_TRANSPORT environment variable
+const (
+	RabbitMQ     = "rabbitmq"
+	EmbeddedNATS = "nats"
+	InMemory     = "inmemory"
+)
+
+// A Message is an encoded event (along with its delivery headers) as published to, or received from, a message broker
+// Header values are strings so that every transport can carry them as is
+type Message struct {
+	ID          string
+	Type        string
+	ContentType string
+	Timestamp   time.Time
+	Headers     map[string]string
+	Body        []byte
+}
+
+// Clone returns a copy of the message with its own headers, which can be modified without changing the original's
+func (m Message) Clone() Message {
+	headers := make(map[string]string, len(m.Headers))
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+
+	m.Headers = headers
+
+	return m
+}
+
+// A Delivery is a message received from a message broker, which stays unacknowledged until it is settled
+// Settle must be called once: with nil to acknowledge the message, or with an error to have it redelivered
+// Deliveries can be settled from any goroutine and in any order
+type Delivery struct {
+	Message
+	Settle func(err error)
+}
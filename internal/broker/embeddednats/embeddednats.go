@@ -0,0 +1,329 @@
+package embeddednats
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// Headers holding a message's fields (NATS messages only have a subject, headers and data)
+const (
+	idHeader          = "x-message-id"
+	typeHeader        = "x-message-type"
+	contentTypeHeader = "x-content-type"
+	timestampHeader   = "x-timestamp"
+	notBeforeHeader   = "x-not-before"
+)
+
+// RunServer starts a NATS server with JetStream enabled in this process, storing streams in storeDir
+// It lets the event producer and consumer run without an external broker: one service runs the server and every service connects to it
+func RunServer(host string, port int, storeDir string) (*server.Server, error) {
+	s, err := server.NewServer(&server.Options{Host: host, Port: port, JetStream: true, StoreDir: storeDir})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.Start()
+
+	if !s.ReadyForConnections(5 * time.Second) {
+		s.Shutdown()
+		return nil, errors.New("NATS server is not ready for connections")
+	}
+
+	return s, nil
+}
+
+// Broker publishes events to, and consumes them from, JetStream streams on a NATS server
+// Events are stored in a stream named after the queue and consumed by a durable consumer of the same name;
+// dead letters are stored in a separate stream (named with a "_dead" suffix) until they are removed
+type Broker struct {
+	Name       string
+	Connection *nats.Conn
+	js         nats.JetStreamContext
+}
+
+// Connect connects to the NATS server at the given host and port
+// The connection keeps retrying (whether the server is not up yet or restarts) and subscriptions resume once it reconnects
+func Connect(host string, port string, name string) (*Broker, error) {
+	conn, err := nats.Connect("nats://"+host+":"+port, nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Broker{Name: name, Connection: conn, js: js}, nil
+}
+
+// Close closes the connection to the NATS server
+func (b *Broker) Close() error {
+	b.Connection.Close()
+	return nil
+}
+
+// IsConnected returns whether the Broker is currently connected to the NATS server
+func (b *Broker) IsConnected() bool {
+	return b.Connection.IsConnected()
+}
+
+// Publish publishes a message to the event stream and waits for JetStream to store it
+func (b *Broker) Publish(m broker.Message) error {
+	return b.publish(b.eventSubject(), m)
+}
+
+// PublishDelayed publishes a message to the event stream, to be handled once the given delay has passed
+// JetStream cannot delay a message, so the message is stored right away and held back by the subscriber until then
+func (b *Broker) PublishDelayed(m broker.Message, delay time.Duration) error {
+	m = m.Clone()
+	m.Headers[notBeforeHeader] = time.Now().Add(delay).UTC().Format(time.RFC3339Nano)
+
+	return b.Publish(m)
+}
+
+// DeadLetter publishes a message to the dead-letter stream
+func (b *Broker) DeadLetter(m broker.Message) error {
+	return b.publish(b.deadLetterSubject(), m)
+}
+
+// Subscribe consumes the event stream, calling handle with each delivery (one at a time) until the connection is closed
+// Up to prefetch deliveries are left unsettled at once; a delivery settled with an error is redelivered
+// Messages are pulled one at a time once handle returns, so none are fetched (and left to time out) while handle blocks
+func (b *Broker) Subscribe(prefetch int, handle func(broker.Delivery)) error {
+	if prefetch <= 0 {
+		prefetch = 1
+	}
+
+	err := b.declare()
+	if err != nil {
+		return err
+	}
+
+	err = b.declareConsumer(prefetch)
+	if err != nil {
+		return err
+	}
+
+	sub, err := b.js.PullSubscribe(b.eventSubject(), b.Name, nats.Bind(b.Name, b.Name))
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to subscribe to event stream", err)
+	}
+
+	for {
+		msgs, err := sub.Fetch(1, nats.MaxWait(time.Minute))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Event stream subscription closed", err)
+		}
+
+		msg := msgs[0]
+
+		m := toMessage(msg.Header, msg.Data)
+		if notBefore, err := time.Parse(time.RFC3339Nano, m.Headers[notBeforeHeader]); err == nil && time.Now().Before(notBefore) {
+			msg.NakWithDelay(time.Until(notBefore))
+			continue
+		}
+
+		delete(m.Headers, notBeforeHeader)
+		handle(broker.Delivery{Message: m, Settle: func(err error) {
+			if err != nil {
+				err = msg.Nak()
+			} else {
+				err = msg.Ack()
+			}
+
+			if err != nil {
+				log.Printf("Failed to settle %s message %s: %s", m.Type, m.ID, err)
+			}
+		}})
+	}
+}
+
+// ScanDeadLetters calls fn with each dead letter (oldest first) until fn returns an error, removing those for which fn returns true
+func (b *Broker) ScanDeadLetters(fn func(broker.Message) (bool, error)) error {
+	err := b.declare()
+	if err != nil {
+		return err
+	}
+
+	info, err := b.js.StreamInfo(b.deadLetterStream())
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to fetch dead-letter stream", err)
+	}
+
+	if info.State.Msgs == 0 {
+		return nil
+	}
+
+	for seq := info.State.FirstSeq; seq <= info.State.LastSeq; seq++ {
+		raw, err := b.js.GetMsg(b.deadLetterStream(), seq)
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			continue
+		}
+		if err != nil {
+			return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to fetch dead letter", err)
+		}
+
+		remove, err := fn(toMessage(raw.Header, raw.Data))
+		if err != nil {
+			return err
+		}
+
+		if remove {
+			err = b.js.DeleteMsg(b.deadLetterStream(), seq)
+			if err != nil {
+				return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to remove dead letter", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *Broker) publish(subject string, m broker.Message) error {
+	if !b.Connection.IsConnected() {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Message queue is not connected", nil)
+	}
+
+	err := b.declare()
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(subject)
+	for k, v := range m.Headers {
+		msg.Header.Set(headerKey(k), v)
+	}
+	msg.Header.Set(idHeader, m.ID)
+	msg.Header.Set(typeHeader, m.Type)
+	msg.Header.Set(contentTypeHeader, m.ContentType)
+	msg.Header.Set(timestampHeader, m.Timestamp.UTC().Format(time.RFC3339Nano))
+	msg.Data = m.Body
+
+	_, err = b.js.PublishMsg(msg)
+	if err != nil {
+		return apperror.NewUnavailable("EVENT_NOT_CONFIRMED", "Failed to store message", err)
+	}
+
+	return nil
+}
+
+// declare adds the event and dead-letter streams if they do not exist yet
+func (b *Broker) declare() error {
+	streams := map[string]string{
+		b.Name:               b.eventSubject(),
+		b.deadLetterStream(): b.deadLetterSubject(),
+	}
+
+	for name, subject := range streams {
+		_, err := b.js.StreamInfo(name)
+		if errors.Is(err, nats.ErrStreamNotFound) {
+			_, err = b.js.AddStream(&nats.StreamConfig{Name: name, Subjects: []string{subject}, Storage: nats.FileStorage})
+		}
+		if err != nil {
+			return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to declare stream "+name, err)
+		}
+	}
+
+	return nil
+}
+
+// ackWait is how long a delivery can stay unsettled before it is redelivered, which leaves subscribers time to retry a failing
+// message (with backoff) before settling it
+const ackWait = 10 * time.Minute
+
+// declareConsumer adds the durable pull consumer of the event stream if it does not exist yet
+// Earlier versions consumed the stream with a push consumer of the same name, which is replaced by a pull consumer that resumes
+// after the last message it acknowledged (messages acknowledged out of order after that are redelivered, and skipped as duplicates)
+func (b *Broker) declareConsumer(prefetch int) error {
+	conf := &nats.ConsumerConfig{
+		Durable:       b.Name,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxAckPending: prefetch,
+		FilterSubject: b.eventSubject(),
+	}
+
+	info, err := b.js.ConsumerInfo(b.Name, b.Name)
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+	case err != nil:
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to fetch event stream consumer", err)
+	case info.Config.DeliverSubject == "":
+		return nil
+	default:
+		err = b.js.DeleteConsumer(b.Name, b.Name)
+		if err != nil {
+			return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to remove push consumer of event stream", err)
+		}
+
+		conf.DeliverPolicy = nats.DeliverByStartSequencePolicy
+		conf.OptStartSeq = info.AckFloor.Stream + 1
+	}
+
+	_, err = b.js.AddConsumer(b.Name, conf)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to add event stream consumer", err)
+	}
+
+	return nil
+}
+
+func (b *Broker) eventSubject() string {
+	return b.Name + ".events"
+}
+
+func (b *Broker) deadLetterStream() string {
+	return b.Name + "_dead"
+}
+
+func (b *Broker) deadLetterSubject() string {
+	return b.Name + ".dead"
+}
+
+func toMessage(h nats.Header, data []byte) broker.Message {
+	m := broker.Message{Headers: map[string]string{}, Body: data}
+	for k := range h {
+		switch k {
+		case idHeader:
+			m.ID = h.Get(k)
+		case typeHeader:
+			m.Type = h.Get(k)
+		case contentTypeHeader:
+			m.ContentType = h.Get(k)
+		case timestampHeader:
+			m.Timestamp, _ = time.Parse(time.RFC3339Nano, h.Get(k))
+		default:
+			m.Headers[fromHeaderKey(k)] = h.Get(k)
+		}
+	}
+
+	return m
+}
+
+// headerKey escapes colons in a header key (e.g., the "cloudEvents:" prefix), which NATS reads as the end of the key
+func headerKey(k string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(k, "%", "%25"), ":", "%3A")
+}
+
+func fromHeaderKey(k string) string {
+	unescaped, err := url.PathUnescape(k)
+	if err != nil {
+		return k
+	}
+
+	return unescaped
+}
@@ -0,0 +1,166 @@
+package inmemory
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// DefaultCapacity is the number of messages a Broker created with a capacity of 0 can hold
+const DefaultCapacity = 1024
+
+// retryDelay is how long a delayed or requeued message waits before it is published again while the queue is full
+const retryDelay = 100 * time.Millisecond
+
+// Broker is an in-process message broker, so that the event producer and consumer can be tested without an external broker
+// Messages are held in memory, so they are lost when the process exits, and only reach subscribers in the same process
+// (the producer and consumer must run in one process). Publish fails while the queue is full, but delayed and requeued
+// messages (which have already been accepted) are held until there is room for them
+type Broker struct {
+	mu     sync.Mutex
+	queue  chan broker.Message
+	closed bool
+
+	deadMu sync.Mutex
+	dead   []broker.Message
+}
+
+// New returns a Broker that can hold up to capacity messages
+func New(capacity int) *Broker {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+
+	return &Broker{queue: make(chan broker.Message, capacity)}
+}
+
+// Close stops accepting messages and ends the subscription once the queued messages are handled
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+
+	return nil
+}
+
+// IsConnected returns whether the Broker is open (an in-process Broker is always reachable)
+func (b *Broker) IsConnected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !b.closed
+}
+
+// Publish adds a message to the queue
+func (b *Broker) Publish(m broker.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Message queue is closed", nil)
+	}
+
+	select {
+	case b.queue <- m.Clone():
+		return nil
+	default:
+		return apperror.NewUnavailable("BROKER_FULL", "Message queue is full", nil)
+	}
+}
+
+// PublishDelayed adds a message to the queue after the given delay
+func (b *Broker) PublishDelayed(m broker.Message, delay time.Duration) error {
+	b.publishLater(m.Clone(), delay)
+
+	return nil
+}
+
+// publishLater adds a message to the queue after the given delay, trying again every retryDelay while the queue is full
+// The message is only dropped if the Broker is closed in the meantime
+func (b *Broker) publishLater(m broker.Message, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		err := b.Publish(m)
+		if err == nil {
+			return
+		}
+
+		if apperror.FromError(err).Reason == "BROKER_FULL" {
+			b.publishLater(m, retryDelay)
+			return
+		}
+
+		log.Printf("Failed to publish %s message %s: %s", m.Type, m.ID, err)
+	})
+}
+
+// DeadLetter adds a message to the dead letters
+func (b *Broker) DeadLetter(m broker.Message) error {
+	b.deadMu.Lock()
+	defer b.deadMu.Unlock()
+
+	b.dead = append(b.dead, m.Clone())
+
+	return nil
+}
+
+// Subscribe calls handle with each message (one at a time) until the Broker is closed
+// Up to prefetch deliveries are left unsettled at once; a delivery settled with an error is queued again
+func (b *Broker) Subscribe(prefetch int, handle func(broker.Delivery)) error {
+	if prefetch <= 0 {
+		prefetch = 1
+	}
+
+	unsettled := make(chan struct{}, prefetch)
+	for m := range b.queue {
+		m := m
+		unsettled <- struct{}{}
+		handle(broker.Delivery{Message: m, Settle: func(err error) {
+			<-unsettled
+			if err == nil {
+				return
+			}
+
+			// the message is requeued once there is room for it, even if the queue is full
+			b.publishLater(m, 0)
+		}})
+	}
+
+	return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Message queue is closed", nil)
+}
+
+// ScanDeadLetters calls fn with each dead letter (oldest first) until fn returns an error, removing those for which fn returns true
+func (b *Broker) ScanDeadLetters(fn func(broker.Message) (bool, error)) error {
+	b.deadMu.Lock()
+	pending := b.dead
+	b.dead = nil
+	b.deadMu.Unlock()
+
+	kept := []broker.Message{}
+	var err error
+	for i, m := range pending {
+		var remove bool
+		remove, err = fn(m.Clone())
+		if err != nil {
+			kept = append(kept, pending[i:]...)
+			break
+		}
+
+		if !remove {
+			kept = append(kept, m)
+		}
+	}
+
+	// dead letters added during the scan go after the ones that were kept
+	b.deadMu.Lock()
+	b.dead = append(kept, b.dead...)
+	b.deadMu.Unlock()
+
+	return err
+}
@@ -0,0 +1,420 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+	"github.com/martinmhan/tweet-app-api/internal/broker"
+)
+
+// DefaultConfirmTimeout is how long a publish waits for the broker to confirm a message if no ConfirmTimeout is set
+const DefaultConfirmTimeout = 5 * time.Second
+
+// Broker publishes events to, and consumes them from, RabbitMQ
+// Events are published as persistent messages to a durable direct exchange (named after the queue) bound to a durable queue,
+// and are only considered published once the broker has confirmed them, so accepted events survive a broker restart
+// Delayed messages wait in a delay queue per delay (whose TTL dead-letters them back to the exchange),
+// and dead letters are published to a fanout exchange bound to a dead-letter queue
+// Messages are published one at a time on a long-lived channel in confirm mode, which is reopened after it fails or the connection is lost
+type Broker struct {
+	QueueName      string
+	Connection     *Supervisor
+	ConfirmTimeout time.Duration
+
+	mu       sync.Mutex
+	ch       *amqp.Channel
+	closes   chan *amqp.Error
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	declared map[string]bool // the delay queues declared on ch
+}
+
+// Dial starts connecting to the RabbitMQ server at the given host and port (see Supervisor), without waiting for the connection
+func Dial(host string, port string, queueName string) *Broker {
+	return &Broker{QueueName: queueName, Connection: Supervise(URL(host, port))}
+}
+
+// Close closes the connection to RabbitMQ
+func (b *Broker) Close() error {
+	return b.Connection.Close()
+}
+
+// IsConnected returns whether the Broker is currently connected to RabbitMQ
+func (b *Broker) IsConnected() bool {
+	return b.Connection.IsConnected()
+}
+
+// Publish publishes a message to the event queue and waits for the broker to confirm it
+func (b *Broker) Publish(m broker.Message) error {
+	return b.publish(b.QueueName, b.QueueName, m, nil)
+}
+
+// PublishDelayed publishes a message to the event queue after the given delay
+func (b *Broker) PublishDelayed(m broker.Message, delay time.Duration) error {
+	if delay <= 0 {
+		return b.Publish(m)
+	}
+
+	// the delay is part of the queue's name since a queue's TTL cannot change once it is declared
+	q := b.QueueName + ".retry." + delay.String()
+
+	return b.publish("", q, m, func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclare(q, true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    b.QueueName,
+			"x-dead-letter-routing-key": b.QueueName,
+		})
+
+		return err
+	})
+}
+
+// DeadLetter publishes a message to the dead-letter queue
+func (b *Broker) DeadLetter(m broker.Message) error {
+	return b.publish(b.deadLetterExchangeName(), "", m, nil)
+}
+
+// Subscribe consumes the event queue, calling handle with each delivery (one at a time) until the Broker is closed
+// Up to prefetch deliveries are left unsettled at once; a delivery settled with an error is requeued
+// Whenever the connection is lost, Subscribe waits for the Supervisor to reconnect, then declares the queues again and resumes consuming
+// (deliveries that were unsettled when the connection was lost are redelivered by RabbitMQ)
+func (b *Broker) Subscribe(prefetch int, handle func(broker.Delivery)) error {
+	for b.Connection.Wait() {
+		err := b.consume(prefetch, handle)
+		log.Printf("Stopped consuming %s: %s", b.QueueName, err)
+
+		time.Sleep(minReconnectDelay)
+	}
+
+	return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Message queue connection closed", nil)
+}
+
+// consume consumes the event queue on a new channel until the channel is closed
+func (b *Broker) consume(prefetch int, handle func(broker.Delivery)) error {
+	ch, err := b.Connection.Channel()
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to open message queue channel", err)
+	}
+
+	defer ch.Close()
+
+	err = b.declare(ch)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to declare message queue", err)
+	}
+
+	err = b.declareDeadLetters(ch)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to declare dead-letter queue", err)
+	}
+
+	if prefetch <= 0 {
+		prefetch = 1
+	}
+
+	err = ch.Qos(prefetch, 0, false)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to set message queue prefetch", err)
+	}
+
+	msgs, err := ch.Consume(
+		b.QueueName, // queue
+		"",          // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
+	)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to consume message queue", err)
+	}
+
+	for d := range msgs {
+		d := d
+		handle(broker.Delivery{Message: toMessage(d), Settle: func(err error) {
+			if err != nil {
+				err = d.Nack(false, true)
+			} else {
+				err = d.Ack(false)
+			}
+
+			if err != nil {
+				log.Printf("Failed to settle %s message %s: %s", d.Type, d.MessageId, err)
+			}
+		}})
+	}
+
+	return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Message queue channel closed", nil)
+}
+
+// ScanDeadLetters fetches dead letters (oldest first) and calls fn with each until the queue is exhausted or fn returns an error
+// A dead letter is removed from the queue if fn returns true, or else requeued once the scan is over
+func (b *Broker) ScanDeadLetters(fn func(broker.Message) (bool, error)) error {
+	ch, err := b.Connection.Channel()
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to open message queue channel", err)
+	}
+
+	// closing the channel requeues every dead letter that was fetched but not acknowledged
+	defer ch.Close()
+
+	err = b.declareDeadLetters(ch)
+	if err != nil {
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to declare dead-letter queue", err)
+	}
+
+	for {
+		d, ok, err := ch.Get(b.deadLetterQueueName(), false)
+		if err != nil {
+			return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to fetch dead letter", err)
+		}
+
+		if !ok {
+			return nil
+		}
+
+		remove, err := fn(toMessage(d))
+		if err != nil {
+			return err
+		}
+
+		if remove {
+			err = d.Ack(false)
+			if err != nil {
+				return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to remove dead letter", err)
+			}
+		}
+	}
+}
+
+// publish publishes a message as a persistent message (after declaring what it is published to, unless it already has been on the
+// current channel) and waits for the broker to confirm it
+func (b *Broker) publish(exchange string, key string, m broker.Message, declare func(*amqp.Channel) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch, err := b.channel()
+	if err != nil {
+		return err
+	}
+
+	if declare != nil && !b.declared[key] {
+		err = declare(ch)
+		if err != nil {
+			b.discardChannel()
+			return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to declare message queue", err)
+		}
+		b.declared[key] = true
+	}
+
+	err = ch.Publish(
+		exchange,
+		key,
+		true,  // mandatory (i.e., return the message if it cannot be routed to a queue)
+		false, // immediate
+		toPublishing(m),
+	)
+	if err != nil {
+		b.discardChannel()
+		return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to publish message", err)
+	}
+
+	err = AwaitConfirm(b.confirms, b.returns, b.ConfirmTimeout)
+	if err != nil {
+		// a late confirm or return would be taken for the next message's, so the next message is published on a new channel
+		b.discardChannel()
+	}
+
+	return err
+}
+
+// channel returns the channel that messages are published on, opening it in confirm mode and declaring the event and dead-letter
+// queues on it if it is not open yet (or was closed, e.g., because the connection was lost). The caller must hold b.mu
+func (b *Broker) channel() (*amqp.Channel, error) {
+	if b.ch != nil {
+		select {
+		case <-b.closes:
+			b.ch = nil
+		default:
+			return b.ch, nil
+		}
+	}
+
+	ch, err := b.Connection.Channel()
+	if err != nil {
+		return nil, apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to open message queue channel", err)
+	}
+
+	err = b.declare(ch)
+	if err == nil {
+		err = b.declareDeadLetters(ch)
+	}
+	if err != nil {
+		ch.Close()
+		return nil, apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to declare message queue", err)
+	}
+
+	err = ch.Confirm(false)
+	if err != nil {
+		ch.Close()
+		return nil, apperror.NewUnavailable("BROKER_UNAVAILABLE", "Failed to put channel in confirm mode", err)
+	}
+
+	b.ch = ch
+	b.closes = ch.NotifyClose(make(chan *amqp.Error, 1))
+	b.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	b.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	b.declared = map[string]bool{}
+
+	return ch, nil
+}
+
+// discardChannel closes the channel that messages are published on, so that the next message opens a new one. The caller must hold b.mu
+func (b *Broker) discardChannel() {
+	if b.ch == nil {
+		return
+	}
+
+	b.ch.Close()
+	b.ch = nil
+}
+
+// declare declares the durable exchange and queue that events are published to, and binds them
+func (b *Broker) declare(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(
+		b.QueueName, // name
+		"direct",    // type
+		true,        // durable
+		false,       // auto-deleted
+		false,       // internal
+		false,       // no-wait
+		nil,         // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	q, err := ch.QueueDeclare(
+		b.QueueName, // name
+		true,        // durable
+		false,       // delete when unused
+		false,       // exclusive
+		false,       // no-wait
+		nil,         // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	return ch.QueueBind(q.Name, b.QueueName, b.QueueName, false, nil)
+}
+
+func (b *Broker) declareDeadLetters(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(b.deadLetterExchangeName(), "fanout", true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDeclare(b.deadLetterQueueName(), true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	return ch.QueueBind(b.deadLetterQueueName(), "", b.deadLetterExchangeName(), false, nil)
+}
+
+func (b *Broker) deadLetterExchangeName() string {
+	return b.QueueName + ".dlx"
+}
+
+func (b *Broker) deadLetterQueueName() string {
+	return b.QueueName + ".dead"
+}
+
+// AwaitConfirm waits up to timeout (DefaultConfirmTimeout if unset) for the broker to confirm a message published on a channel in confirm mode
+// An unroutable mandatory message is returned before it is confirmed, so a confirmed message that was returned is still a failure
+// (returns may be nil if the message is not mandatory)
+func AwaitConfirm(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	returned := false
+	for {
+		select {
+		case r, ok := <-returns:
+			if ok {
+				log.Printf("Message returned by the broker: %s (code: %d)", r.ReplyText, r.ReplyCode)
+				returned = true
+			}
+			returns = nil
+		case c, ok := <-confirms:
+			if !ok {
+				return apperror.NewUnavailable("BROKER_UNAVAILABLE", "Channel closed before the message was confirmed", nil)
+			}
+
+			if returned {
+				return apperror.New(apperror.Internal, "EVENT_UNROUTABLE", "Message could not be routed to the message queue")
+			}
+
+			if !c.Ack {
+				return apperror.NewUnavailable("EVENT_NOT_CONFIRMED", "Broker failed to accept the message", nil)
+			}
+
+			return nil
+		case <-timer.C:
+			return apperror.NewUnavailable("CONFIRM_TIMEOUT", "Timed out waiting for the broker to confirm the message", nil)
+		}
+	}
+}
+
+func toPublishing(m broker.Message) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+
+	return amqp.Publishing{
+		ContentType:  m.ContentType,
+		Type:         m.Type,
+		MessageId:    m.ID,
+		Timestamp:    m.Timestamp,
+		Headers:      headers,
+		Body:         m.Body,
+		DeliveryMode: amqp.Persistent,
+	}
+}
+
+// toMessage converts a delivery to a Message, formatting scalar header values as strings
+// Other header values (e.g., the x-death header RabbitMQ sets on dead-lettered messages) are dropped
+func toMessage(d amqp.Delivery) broker.Message {
+	headers := map[string]string{}
+	for k, v := range d.Headers {
+		switch v := v.(type) {
+		case string:
+			headers[k] = v
+		case time.Time:
+			headers[k] = v.UTC().Format(time.RFC3339Nano)
+		case bool, int8, int16, int32, int64, float32, float64:
+			headers[k] = fmt.Sprint(v)
+		}
+	}
+
+	return broker.Message{
+		ID:          d.MessageId,
+		Type:        d.Type,
+		ContentType: d.ContentType,
+		Timestamp:   d.Timestamp,
+		Headers:     headers,
+		Body:        d.Body,
+	}
+}
@@ -0,0 +1,148 @@
+package rabbitmq
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// Delays between attempts to connect to RabbitMQ (doubling from the minimum up to the maximum)
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// URL returns the URL of the RabbitMQ server at the given host and port
+func URL(host string, port string) string {
+	return "amqp://guest:guest@" + host + ":" + port + "/"
+}
+
+// Supervisor keeps a connection to RabbitMQ open: it dials in the background, and dials again (with exponential backoff)
+// whenever the connection closes, so that services can start before RabbitMQ and survive broker restarts
+// Channels are opened from the current connection; users of a Supervisor re-declare their topology on every new channel
+type Supervisor struct {
+	url string
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	ready  chan struct{} // closed once connected (and replaced when the connection is lost)
+	done   chan struct{} // closed once the Supervisor is closed
+	closed bool
+}
+
+// Supervise starts connecting to the RabbitMQ server at the given URL, without waiting for the connection
+func Supervise(url string) *Supervisor {
+	s := &Supervisor{url: url, ready: make(chan struct{}), done: make(chan struct{})}
+	go s.run()
+
+	return s
+}
+
+func (s *Supervisor) run() {
+	delay := minReconnectDelay
+	for {
+		conn, err := amqp.Dial(s.url)
+		if err != nil {
+			log.Printf("Failed to connect to RabbitMQ (retrying in %s): %s", delay, err)
+
+			select {
+			case <-s.done:
+				return
+			case <-time.After(delay):
+			}
+
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+
+		closes := conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conn = conn
+		close(s.ready)
+		s.mu.Unlock()
+
+		log.Println("Connected to RabbitMQ")
+		delay = minReconnectDelay
+
+		reason := <-closes
+
+		s.mu.Lock()
+		s.conn = nil
+		s.ready = make(chan struct{})
+		closed := s.closed
+		s.mu.Unlock()
+
+		if closed {
+			return
+		}
+
+		log.Printf("Lost connection to RabbitMQ (%v), reconnecting", reason)
+	}
+}
+
+// Wait blocks until the Supervisor is connected, and returns false if it is closed instead
+func (s *Supervisor) Wait() bool {
+	s.mu.Lock()
+	ready := s.ready
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// IsConnected returns whether the Supervisor is currently connected
+func (s *Supervisor) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn != nil && !s.conn.IsClosed()
+}
+
+// Channel opens a channel on the current connection
+func (s *Supervisor) Channel() (*amqp.Channel, error) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return nil, apperror.NewUnavailable("BROKER_UNAVAILABLE", "Not connected to RabbitMQ", nil)
+	}
+
+	return conn.Channel()
+}
+
+// Close closes the connection and stops reconnecting
+func (s *Supervisor) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.Close()
+}
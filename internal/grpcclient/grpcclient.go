@@ -0,0 +1,94 @@
+// Package grpcclient dials the gRPC services of this app without blocking, so that services can start in any order
+// Calls wait for their connection to be ready (up to their deadline, or DefaultTimeout if they have none), and calls that are
+// safe to repeat (i.e., reads) are retried with exponential backoff if the service is unavailable
+package grpcclient
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// DefaultTimeout bounds unary calls made without a deadline
+const DefaultTimeout = 10 * time.Second
+
+// serviceConfig makes every call wait for the connection to be ready rather than fail fast, and retries the calls that fail with
+// UNAVAILABLE (e.g., because the service is restarting) if they are read-only: the Read View's and the Database Access service's
+// reads. Writes are not retried, since UNAVAILABLE does not mean they were not applied (e.g., the event producer returns it when
+// the broker does not confirm a message, which it may still have stored)
+const serviceConfig = `{
+	"methodConfig": [{
+		"name": [{}],
+		"waitForReady": true
+	}, {
+		"name": [
+			{"service": "readview.ReadView", "method": "getUserByUserID"},
+			{"service": "readview.ReadView", "method": "getUserByUsername"},
+			{"service": "readview.ReadView", "method": "getFollow"},
+			{"service": "readview.ReadView", "method": "getFollowers"},
+			{"service": "readview.ReadView", "method": "getFollowees"},
+			{"service": "readview.ReadView", "method": "getTweet"},
+			{"service": "readview.ReadView", "method": "getTweets"},
+			{"service": "readview.ReadView", "method": "getTimeline"},
+			{"service": "database.DatabaseAccess", "method": "getTweet"},
+			{"service": "database.DatabaseAccess", "method": "getUser"},
+			{"service": "database.DatabaseAccess", "method": "getFollowers"},
+			{"service": "database.DatabaseAccess", "method": "getFollowees"},
+			{"service": "database.DatabaseAccess", "method": "getTweets"},
+			{"service": "database.DatabaseAccess", "method": "getAllUsers"},
+			{"service": "database.DatabaseAccess", "method": "getAllFollows"},
+			{"service": "database.DatabaseAccess", "method": "getAllTweets"},
+			{"service": "database.DatabaseAccess", "method": "getRefreshToken"},
+			{"service": "database.DatabaseAccess", "method": "isAccessTokenRevoked"},
+			{"service": "database.DatabaseAccess", "method": "getSigningKeys"},
+			{"service": "database.DatabaseAccess", "method": "isEventProcessed"},
+			{"service": "database.DatabaseAccess", "method": "getStreamEvents"},
+			{"service": "database.DatabaseAccess", "method": "getEvents"},
+			{"service": "database.DatabaseAccess", "method": "getEventStoreHead"},
+			{"service": "database.DatabaseAccess", "method": "watchChanges"}
+		],
+		"waitForReady": true,
+		"retryPolicy": {
+			"maxAttempts": 5,
+			"initialBackoff": "0.1s",
+			"maxBackoff": "2s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["UNAVAILABLE"]
+		}
+	}]
+}`
+
+// Dial returns a connection to the gRPC service at the given target, which connects (and reconnects) in the background
+func Dial(target string) (*grpc.ClientConn, error) {
+	return grpc.Dial(
+		target,
+		grpc.WithInsecure(),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithUnaryInterceptor(defaultTimeout),
+	)
+}
+
+// Ready returns a readiness check that passes while the connection is ready (an idle connection is asked to connect)
+func Ready(conn *grpc.ClientConn) func() bool {
+	return func() bool {
+		state := conn.GetState()
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+
+		return state == connectivity.Ready
+	}
+}
+
+// defaultTimeout sets DefaultTimeout on unary calls without a deadline, since they would otherwise wait forever for a service that is down
+func defaultTimeout(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
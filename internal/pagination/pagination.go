@@ -0,0 +1,99 @@
+// Package pagination defines the cursors and signed page tokens used by every paginated list RPC
+// Pages are keyed on the creation time and ID of the last item returned (rather than an offset), so items inserted
+// while a client is paging through a list do not cause items to be skipped or repeated
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// A Cursor marks the position of the last item of a page, so that the next page starts right after it
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// Codec encodes cursors into opaque page tokens signed with a secret key, and decodes (and verifies) them
+type Codec struct {
+	Key []byte
+}
+
+type payload struct {
+	Scope string `json:"s"`
+	Time  int64  `json:"t"`
+	ID    string `json:"i"`
+}
+
+// Encode returns the page token of a cursor
+// The scope identifies the list being paged through (e.g., "tweets/<userID>") so that a token cannot be used to page through another list
+func (c Codec) Encode(scope string, cur Cursor) string {
+	b, _ := json.Marshal(payload{Scope: scope, Time: cur.Time.UnixNano(), ID: cur.ID})
+	p := base64.RawURLEncoding.EncodeToString(b)
+
+	return p + "." + base64.RawURLEncoding.EncodeToString(c.sign(p))
+}
+
+// Decode returns the cursor of a page token, or nil if the token is empty (i.e., the first page is requested)
+func (c Codec) Decode(scope string, token string) (*Cursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, invalidTokenError()
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, c.sign(parts[0])) {
+		return nil, invalidTokenError()
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalidTokenError()
+	}
+
+	var p payload
+	err = json.Unmarshal(b, &p)
+	if err != nil || p.Scope != scope {
+		return nil, invalidTokenError()
+	}
+
+	return &Cursor{Time: time.Unix(0, p.Time).UTC(), ID: p.ID}, nil
+}
+
+func (c Codec) sign(p string) []byte {
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write([]byte(p))
+
+	return mac.Sum(nil)
+}
+
+func invalidTokenError() error {
+	return apperror.NewInvalidArgument(
+		"INVALID_PAGE_TOKEN",
+		"Invalid page token",
+		apperror.FieldViolation{Field: "PageToken", Description: "Page token must be a token returned as NextPageToken by a previous call of the same method"},
+	)
+}
+
+// PageSize returns the number of items to return given the requested page size, defaulting to def and capped at max
+func PageSize(requested int32, def int, max int) int {
+	if requested <= 0 {
+		return def
+	}
+
+	if int(requested) > max {
+		return max
+	}
+
+	return int(requested)
+}
@@ -0,0 +1,82 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// TestDecode decodes page tokens that were tampered with, signed with another key or issued for another list
+func TestDecode(t *testing.T) {
+	c := Codec{Key: []byte("test-page-token-key")}
+	cur := Cursor{Time: time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC), ID: "tweet-1"}
+	token := c.Encode("tweets/user-1", cur)
+	parts := strings.Split(token, ".")
+
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"tweets/user-2","t":0,"i":"tweet-1"}`))
+
+	tests := []struct {
+		name  string
+		scope string
+		token string
+		valid bool
+	}{
+		{name: "valid", scope: "tweets/user-1", token: token, valid: true},
+		{name: "first page", scope: "tweets/user-1", token: "", valid: true},
+		{name: "other scope", scope: "tweets/user-2", token: token},
+		{name: "other key", scope: "tweets/user-1", token: Codec{Key: []byte("other-key")}.Encode("tweets/user-1", cur)},
+		{name: "forged payload", scope: "tweets/user-2", token: forged + "." + parts[1]},
+		{name: "no signature", scope: "tweets/user-1", token: parts[0]},
+		{name: "invalid signature encoding", scope: "tweets/user-1", token: parts[0] + ".!!"},
+		{name: "extra part", scope: "tweets/user-1", token: token + ".x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Decode(tt.scope, tt.token)
+			if !tt.valid {
+				if !apperror.Is(err, apperror.InvalidArgument) {
+					t.Fatalf("got error %v, want an InvalidArgument error", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.token == "" {
+				if got != nil {
+					t.Errorf("got cursor %+v for the first page", got)
+				}
+				return
+			}
+
+			if got == nil || !got.Time.Equal(cur.Time) || got.ID != cur.ID {
+				t.Errorf("got cursor %+v, want %+v", got, cur)
+			}
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		requested int32
+		want      int
+	}{
+		{requested: -1, want: 20},
+		{requested: 0, want: 20},
+		{requested: 5, want: 5},
+		{requested: 100, want: 100},
+		{requested: 101, want: 100},
+	}
+
+	for _, tt := range tests {
+		if got := PageSize(tt.requested, 20, 100); got != tt.want {
+			t.Errorf("PageSize(%d) = %d, want %d", tt.requested, got, tt.want)
+		}
+	}
+}
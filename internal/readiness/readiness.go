@@ -0,0 +1,95 @@
+// Package readiness reports whether a service is ready via the standard gRPC health service (grpc.health.v1.Health),
+// so that clients and orchestrators can tell a running service apart from one that can serve requests
+package readiness
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/martinmhan/tweet-app-api/internal/apperror"
+)
+
+// DefaultInterval is how often a Gate with no Interval runs its checks
+const DefaultInterval = time.Second
+
+// A Check returns whether a dependency of the service (e.g., a connection to another service or to the message broker) is ready
+type Check func() bool
+
+// Gate reports the service as SERVING while all of its checks pass, and as NOT_SERVING otherwise
+type Gate struct {
+	Checks   []Check
+	Interval time.Duration
+
+	health *health.Server
+	ready  int32
+}
+
+// NewGate returns a Gate (reporting NOT_SERVING until Run is called and its checks pass)
+func NewGate(checks ...Check) *Gate {
+	g := &Gate{Checks: checks, health: health.NewServer()}
+	g.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return g
+}
+
+// Register registers the health service on a gRPC server
+func (g *Gate) Register(s *grpc.Server) {
+	healthpb.RegisterHealthServer(s, g.health)
+}
+
+// Run runs the checks at every interval and updates the serving status accordingly
+func (g *Gate) Run() {
+	interval := g.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	for {
+		g.set(g.check())
+		time.Sleep(interval)
+	}
+}
+
+// Ready returns whether the service is ready, as of the last run of the checks
+func (g *Gate) Ready() bool {
+	return atomic.LoadInt32(&g.ready) == 1
+}
+
+// Unary returns a server interceptor that rejects calls (other than health checks) with UNAVAILABLE while the service is not ready
+func (g *Gate) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := info.Server.(healthpb.HealthServer); !ok && !g.Ready() {
+			return nil, apperror.NewUnavailable("SERVICE_NOT_READY", "Service is not ready yet", nil)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (g *Gate) check() bool {
+	for _, c := range g.Checks {
+		if !c() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (g *Gate) set(ready bool) {
+	if ready {
+		if atomic.SwapInt32(&g.ready, 1) == 0 {
+			g.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		}
+		return
+	}
+
+	if atomic.SwapInt32(&g.ready, 0) == 1 {
+		g.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
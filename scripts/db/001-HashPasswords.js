@@ -0,0 +1,33 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// Passwords are hashed by the API gateway before they are stored, so the users collection now stores a
+// "passwordHash" (which can be much longer than a plaintext password) instead of a "password"
+db.runCommand({
+  collMod: 'users',
+  validator: {
+    $jsonSchema: {
+      bsonType: 'object',
+      required: ['username', 'passwordHash'],
+      properties: {
+        username: {
+          bsonType: 'string',
+          minLength: 6,
+          maxLength: 30,
+          description: 'is required and must be a string with length between 8 and 30',
+        },
+        passwordHash: {
+          bsonType: 'string',
+          description: 'is required and must be an encoded password hash (including its algorithm and parameters)',
+        },
+      },
+    },
+  },
+});
+
+// Existing plaintext passwords are moved to "passwordHash" as-is, and must then be hashed by running the API gateway's
+// hashpasswords command (`make hash-passwords`), since the API gateway does not accept plaintext passwords
+db.users.updateMany(
+  { password: { $exists: true } },
+  { $rename: { password: 'passwordHash' } },
+);
@@ -0,0 +1,79 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+const collectionNames = db.getCollectionNames();
+
+if (!collectionNames.includes('refreshTokens')) {
+  db.createCollection(
+    'refreshTokens',
+    {
+      validator: {
+        $jsonSchema: {
+          bsonType: 'object',
+          required: ['tokenHash', 'userID', 'username', 'familyID', 'expiresAt', 'used', 'revoked'],
+          properties: {
+            tokenHash: {
+              bsonType: 'string',
+              description: 'SHA-256 hash of the refresh token (the token itself is never stored)',
+            },
+            userID: {
+              bsonType: 'string',
+              description: 'references the _id of a user in the "users" collection',
+            },
+            username: {
+              bsonType: 'string',
+              description: 'is the username of the user with the given userID',
+            },
+            familyID: {
+              bsonType: 'string',
+              description: 'is shared by every refresh token issued by rotating the same original token',
+            },
+            expiresAt: {
+              bsonType: 'date',
+              description: 'is when the refresh token expires',
+            },
+            used: {
+              bsonType: 'bool',
+              description: 'is true once the refresh token has been exchanged for a new one',
+            },
+            revoked: {
+              bsonType: 'bool',
+              description: 'is true once the refresh token (or its family) has been revoked',
+            },
+          },
+        },
+      },
+    },
+  );
+}
+
+if (!collectionNames.includes('revokedTokens')) {
+  db.createCollection(
+    'revokedTokens',
+    {
+      validator: {
+        $jsonSchema: {
+          bsonType: 'object',
+          required: ['tokenID', 'expiresAt'],
+          properties: {
+            tokenID: {
+              bsonType: 'string',
+              description: 'is the ID (jti claim) of a revoked access token',
+            },
+            expiresAt: {
+              bsonType: 'date',
+              description: 'is when the access token expires (after which it no longer needs to be on the revocation list)',
+            },
+          },
+        },
+      },
+    },
+  );
+}
+
+db.refreshTokens.createIndex({ tokenHash: 1 }, { unique: true });
+db.refreshTokens.createIndex({ familyID: 1 });
+db.refreshTokens.createIndex({ expiresAt: 1 }, { expireAfterSeconds: 0 });
+
+db.revokedTokens.createIndex({ tokenID: 1 }, { unique: true });
+db.revokedTokens.createIndex({ expiresAt: 1 }, { expireAfterSeconds: 0 });
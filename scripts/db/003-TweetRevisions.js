@@ -0,0 +1,71 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// Tweets can now be edited (previous versions are kept in "revisions") and soft deleted
+db.runCommand({
+  collMod: 'tweets',
+  validator: {
+    $jsonSchema: {
+      bsonType: 'object',
+      required: ['userID', 'username', 'text'],
+      properties: {
+        userID: {
+          bsonType: 'string',
+          description: 'references the _id of a user in the "users" collection',
+        },
+        username: {
+          bsonType: 'string',
+          description: 'is the username of the user with the given userID',
+        },
+        text: {
+          bsonType: 'string',
+          minLength: 1,
+          maxLength: 100,
+          description: 'is required and must be a string with length between 1 and 100',
+        },
+        createdAt: {
+          bsonType: 'date',
+          description: 'is when the tweet was created',
+        },
+        editedAt: {
+          bsonType: 'date',
+          description: 'is when the tweet was last edited (if ever)',
+        },
+        deleted: {
+          bsonType: 'bool',
+          description: 'is true once the tweet has been deleted',
+        },
+        deletedAt: {
+          bsonType: 'date',
+          description: 'is when the tweet was deleted',
+        },
+        revisions: {
+          bsonType: 'array',
+          description: 'contains the previous versions of the tweet text, oldest first',
+          items: {
+            bsonType: 'object',
+            required: ['text', 'createdAt'],
+            properties: {
+              text: {
+                bsonType: 'string',
+              },
+              createdAt: {
+                bsonType: 'date',
+              },
+            },
+          },
+        },
+      },
+    },
+  },
+});
+
+// Backfill the creation time of existing tweets from their ObjectIDs
+db.tweets.find({ createdAt: { $exists: false } }).forEach((t) => {
+  db.tweets.updateOne(
+    { _id: t._id },
+    { $set: { createdAt: t._id.getTimestamp(), deleted: false, revisions: [] } },
+  );
+});
+
+db.tweets.createIndex({ userID: 1, deleted: 1 });
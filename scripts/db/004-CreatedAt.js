@@ -0,0 +1,40 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// Users and follows now store when they were created (set when their creation event is produced)
+db.runCommand({
+  collMod: 'users',
+  validator: {
+    $jsonSchema: {
+      bsonType: 'object',
+      required: ['username', 'passwordHash'],
+      properties: {
+        username: {
+          bsonType: 'string',
+          minLength: 6,
+          maxLength: 30,
+          description: 'is required and must be a string with length between 8 and 30',
+        },
+        passwordHash: {
+          bsonType: 'string',
+          description: 'is required and must be an encoded password hash (including its algorithm and parameters)',
+        },
+        createdAt: {
+          bsonType: 'date',
+          description: 'is when the user was created',
+        },
+      },
+    },
+  },
+});
+
+// Backfill the creation time of existing users and follows from their ObjectIDs
+// (follows are stored by the Database Access service in the "followers" collection)
+['users', 'followers'].forEach((name) => {
+  db.getCollection(name).find({ createdAt: { $exists: false } }).forEach((d) => {
+    db.getCollection(name).updateOne({ _id: d._id }, { $set: { createdAt: d._id.getTimestamp() } });
+  });
+});
+
+// Timelines are read newest first
+db.tweets.createIndex({ userID: 1, createdAt: -1 });
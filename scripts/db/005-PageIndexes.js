@@ -0,0 +1,7 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// The getAll* methods of the Database Access service page through collections sorted by creation time and _id
+db.users.createIndex({ createdAt: 1, _id: 1 });
+db.followers.createIndex({ createdAt: 1, _id: 1 });
+db.tweets.createIndex({ createdAt: 1, _id: 1 });
@@ -0,0 +1,10 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// Usernames are unique regardless of case (strength 2 compares letters but ignores case), so that two concurrent
+// UserCreation events for the same username cannot both be saved
+// Creating the index fails if there are already duplicate usernames, which must then be renamed by hand
+db.users.createIndex(
+  { username: 1 },
+  { unique: true, collation: { locale: 'en', strength: 2 }, name: 'username_unique' },
+);
@@ -0,0 +1,44 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// Changes to users, follows and tweets are recorded in the outbox in the same transaction as the change itself
+// (transactions require MongoDB to run as a replica set, and the collection must exist before it is written to in a transaction)
+const collectionNames = db.getCollectionNames();
+
+if (!collectionNames.includes('outbox')) {
+  db.createCollection(
+    'outbox',
+    {
+      validator: {
+        $jsonSchema: {
+          bsonType: 'object',
+          required: ['type', 'payload', 'createdAt', 'publishedAt'],
+          properties: {
+            type: {
+              enum: ['UserSaved', 'FollowSaved', 'FollowDeleted', 'TweetSaved', 'TweetDeleted'],
+              description: 'is the type of change',
+            },
+            payload: {
+              bsonType: 'object',
+              description: 'is the changed record (or, for deletions, the fields identifying it)',
+            },
+            createdAt: {
+              bsonType: 'date',
+              description: 'is when the change was recorded',
+            },
+            publishedAt: {
+              bsonType: ['date', 'null'],
+              description: 'is when the outbox relay published the change (null until then)',
+            },
+          },
+        },
+      },
+    },
+  );
+}
+
+// The outbox relay fetches unpublished changes in the order they were recorded
+db.outbox.createIndex({ publishedAt: 1, _id: 1 });
+
+// Published changes are kept for a week (unpublished changes have a null publishedAt, so they never expire)
+db.outbox.createIndex({ publishedAt: 1 }, { expireAfterSeconds: 7 * 24 * 60 * 60 });
@@ -0,0 +1,24 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// The ID (or idempotency key) of every processed event is recorded in the same transaction as the event's writes,
+// so that an event that is redelivered or replayed is a no-op
+const collectionNames = db.getCollectionNames();
+
+if (!collectionNames.includes('processedEvents')) {
+  db.createCollection('processedEvents');
+}
+
+// Events are only redelivered within days at most, so processed events are kept for 30 days
+db.processedEvents.createIndex({ processedAt: 1 }, { expireAfterSeconds: 30 * 24 * 60 * 60 });
+
+// A follower/followee pair is unique, so duplicate follows (from redelivered FollowCreation events) are removed first, keeping the oldest
+db.followers.aggregate([
+  { $sort: { _id: 1 } },
+  { $group: { _id: { followerUserID: '$followerUserID', followeeUserID: '$followeeUserID' }, ids: { $push: '$_id' } } },
+  { $match: { 'ids.1': { $exists: true } } },
+]).forEach((group) => {
+  db.followers.deleteMany({ _id: { $in: group.ids.slice(1) } });
+});
+
+db.followers.createIndex({ followerUserID: 1, followeeUserID: 1 }, { unique: true, name: 'follow_unique' });
@@ -0,0 +1,84 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// Every write to users, followers and tweets appends an event to the stream of its aggregate in the events collection,
+// in the same transaction as the write, so that these collections can be rebuilt by replaying the events
+// An event's _id is its position across every stream (taken from the events counter), and its version is its position in its stream
+const collectionNames = db.getCollectionNames();
+
+if (!collectionNames.includes('events')) {
+  db.createCollection('events');
+}
+
+if (!collectionNames.includes('counters')) {
+  db.createCollection('counters');
+}
+
+// appends to a stream are optimistic: two events cannot have the same version in the same stream
+db.events.createIndex({ streamID: 1, version: 1 }, { unique: true, name: 'stream_version_unique' });
+
+// Existing data is backfilled with the events that would have produced it (in the order they happened), only once
+if (db.events.countDocuments({}) === 0) {
+  const events = [];
+  const addEvent = (streamID, type, data, recordedAt) => events.push({ streamID, type, data, recordedAt: recordedAt || new Date(0) });
+
+  db.users.find().forEach((u) => {
+    const createdAt = u.createdAt || u._id.getTimestamp();
+    addEvent('user-' + u._id.str, 'UserCreated', {
+      userID: u._id.str, username: u.username, passwordHash: u.passwordHash, createdAt,
+    }, createdAt);
+  });
+
+  db.followers.find().forEach((f) => {
+    const createdAt = f.createdAt || f._id.getTimestamp();
+    addEvent('follow-' + f.followerUserID + '-' + f.followeeUserID, 'FollowCreated', {
+      followID: f._id.str,
+      followerUserID: f.followerUserID,
+      followerUsername: f.followerUsername,
+      followeeUserID: f.followeeUserID,
+      followeeUsername: f.followeeUsername,
+      createdAt,
+    }, createdAt);
+  });
+
+  // a tweet's revisions are its previous texts (oldest first), so it was created with the first and edited to each of the others
+  db.tweets.find().forEach((t) => {
+    const streamID = 'tweet-' + t._id.str;
+    const createdAt = t.createdAt || t._id.getTimestamp();
+    const texts = (t.revisions || []).map((r) => r.text).concat([t.text]);
+    const editedAts = (t.revisions || []).slice(1).map((r) => r.createdAt).concat([t.editedAt]).map((d) => d || createdAt);
+
+    addEvent(streamID, 'TweetCreated', {
+      tweetID: t._id.str, userID: t.userID, username: t.username, text: texts[0], createdAt,
+    }, createdAt);
+
+    for (let i = 1; i < texts.length; i++) {
+      addEvent(streamID, 'TweetEdited', {
+        tweetID: t._id.str, userID: t.userID, text: texts[i], editedAt: editedAts[i - 1],
+      }, editedAts[i - 1]);
+    }
+
+    if (t.deleted) {
+      const deletedAt = t.deletedAt || (texts.length > 1 ? editedAts[texts.length - 2] : createdAt);
+      addEvent(streamID, 'TweetDeleted', { tweetID: t._id.str, userID: t.userID }, deletedAt);
+    }
+  });
+
+  events.sort((a, b) => a.recordedAt - b.recordedAt);
+
+  const versions = {};
+  events.forEach((e, i) => {
+    versions[e.streamID] = (versions[e.streamID] || 0) + 1;
+    db.events.insertOne({
+      _id: NumberLong(i + 1),
+      streamID: e.streamID,
+      version: NumberLong(versions[e.streamID]),
+      type: e.type,
+      eventID: '',
+      data: e.data,
+      recordedAt: e.recordedAt,
+    });
+  });
+
+  db.counters.updateOne({ _id: 'events' }, { $set: { position: NumberLong(events.length) } }, { upsert: true });
+}
@@ -0,0 +1,23 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// Every write to users, followers and tweets sets updatedAt, so bulk loads can be limited to the documents written since a given time
+// Existing documents are backfilled with the time they were last written, as far as it is known
+db.users.updateMany(
+  { updatedAt: { $exists: false } },
+  [{ $set: { updatedAt: { $ifNull: ['$createdAt', { $toDate: '$_id' }] } } }],
+);
+
+db.followers.updateMany(
+  { updatedAt: { $exists: false } },
+  [{ $set: { updatedAt: { $ifNull: ['$createdAt', { $toDate: '$_id' }] } } }],
+);
+
+// a tweet was last written when it was deleted, or else when it was last edited
+const tweetUpdatedAt = { $ifNull: ['$deletedAt', { $ifNull: ['$editedAt', { $ifNull: ['$createdAt', { $toDate: '$_id' }] }] }] };
+db.tweets.updateMany({ updatedAt: { $exists: false } }, [{ $set: { updatedAt: tweetUpdatedAt } }]);
+
+// bulk loads are streamed in _id order (so they can resume after the last _id received), optionally since a given updatedAt
+['users', 'followers', 'tweets'].forEach((name) => {
+  db[name].createIndex({ updatedAt: 1, _id: 1 }, { name: 'updated_at' });
+});
@@ -0,0 +1,6 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+// The change feed (watchChanges) streams the outbox in the order of the event store position of each change,
+// and resumes after the position of the last change a client received
+db.outbox.createIndex({ position: 1 }, { name: 'outbox_position' });
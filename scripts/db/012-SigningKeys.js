@@ -0,0 +1,54 @@
+conn = new Mongo();
+db = conn.getDB(dbName);
+
+const collectionNames = db.getCollectionNames();
+
+// The API Gateway's JWT signing keys are shared by every instance (and survive restarts), so tokens signed by one
+// instance can be verified by the others. Only one key is active at a time; retired keys expire once the tokens they signed have
+if (!collectionNames.includes('signingKeys')) {
+  db.createCollection(
+    'signingKeys',
+    {
+      validator: {
+        $jsonSchema: {
+          bsonType: 'object',
+          required: ['keyID', 'algorithm', 'encryptedPrivateKey', 'createdAt'],
+          properties: {
+            keyID: {
+              bsonType: 'string',
+              description: 'is the key ID (kid header) of the tokens the key signs',
+            },
+            algorithm: {
+              bsonType: 'string',
+              description: 'is the JWT algorithm of the key (EdDSA or RS256)',
+            },
+            encryptedPrivateKey: {
+              bsonType: 'binData',
+              description: 'is the private key, encrypted by the API Gateway (the database never holds it in the clear)',
+            },
+            createdAt: {
+              bsonType: 'date',
+              description: 'is when the key was created',
+            },
+            active: {
+              bsonType: 'bool',
+              description: 'is only set (to true) on the key that signs new tokens',
+            },
+            retiredAt: {
+              bsonType: 'date',
+              description: 'is when the key was replaced by a new active key',
+            },
+            expiresAt: {
+              bsonType: 'date',
+              description: 'is when a retired key is removed (after every token it signed has expired)',
+            },
+          },
+        },
+      },
+    },
+  );
+}
+
+db.signingKeys.createIndex({ keyID: 1 }, { unique: true });
+db.signingKeys.createIndex({ active: 1 }, { unique: true, partialFilterExpression: { active: true } });
+db.signingKeys.createIndex({ expiresAt: 1 }, { expireAfterSeconds: 0 });
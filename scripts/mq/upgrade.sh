@@ -0,0 +1,34 @@
+# Use this script to upgrade the RabbitMQ queues made by earlier versions of the services
+# Earlier event producers declared the event queue as non-durable, and RabbitMQ refuses (with PRECONDITION_FAILED) to declare
+# an existing queue as durable, so the old queue is deleted for the services to declare it again as durable
+# Stop the event producer and let the event consumer drain the queue first: the queue is only deleted once it is empty
+# The script is idempotent, i.e., it does nothing once the queue is durable (or does not exist)
+
+set -e
+
+source ../../.env;
+
+QUEUE=`rabbitmqctl list_queues -q --no-table-headers name durable messages | awk -v q="$MQ_NAME" '$1 == q'`;
+
+if [ -z "$QUEUE" ]; then
+  echo "Queue $MQ_NAME does not exist";
+  exit 0;
+fi;
+
+DURABLE=`echo "$QUEUE" | awk '{ print $2 }'`;
+MESSAGES=`echo "$QUEUE" | awk '{ print $3 }'`;
+
+if [ "$DURABLE" = "true" ]; then
+  echo "Queue $MQ_NAME is already durable";
+  exit 0;
+fi;
+
+if [ "$MESSAGES" != "0" ]; then
+  echo "Queue $MQ_NAME still has $MESSAGES message(s). Stop the event producer and let the event consumer drain it, then run this script again";
+  exit 1;
+fi;
+
+rabbitmqctl delete_queue "$MQ_NAME";
+echo "Deleted non-durable queue $MQ_NAME, the services will declare it again as durable";
+
+exit 0;
\ No newline at end of file